@@ -0,0 +1,84 @@
+package main
+
+import (
+	"berlang/runtime/compiler"
+	"berlang/trace"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// buildCommand implements `berlang build`, which compiles a script to a
+// .blc file for `berlang run` to load. It returns the process exit code.
+func buildCommand(args []string) int {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: berlang build [-nocheck] [-o file.blc] <file.bl | ->")
+		fs.PrintDefaults()
+	}
+	noCheck := fs.Bool("nocheck", false, "skip the static type check")
+	output := fs.String("o", "", "the file to write, by default the script's name with a .blc extension")
+
+	// Allow the flags after the script too, as in build file.bl -o file.blc
+	fs.Parse(args)
+	var paths []string
+	for fs.NArg() > 0 {
+		paths = append(paths, fs.Arg(0))
+		fs.Parse(fs.Args()[1:])
+	}
+
+	if len(paths) != 1 || paths[0] == "-" && *output == "" {
+		fs.Usage()
+		return 2
+	}
+
+	path := paths[0]
+	if *output == "" {
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + ".blc"
+	}
+
+	input := os.Stdin
+	if path == "-" {
+		path = "<stdin>"
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "berlang: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	var src strings.Builder
+	program, err := buildSource(io.TeeReader(input, &src), !*noCheck)
+	if err != nil {
+		reportError(path, src.String(), err)
+		return 1
+	}
+	program.Source = path
+
+	var encoded bytes.Buffer
+	if err := compiler.Encode(&encoded, program); err != nil {
+		fmt.Fprintf(os.Stderr, "berlang: %s: %v\n", path, err)
+		return 1
+	}
+	if err := os.WriteFile(*output, encoded.Bytes(), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "berlang: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// buildSource parses, checks and compiles a script.
+func buildSource(input io.Reader, check bool) (*compiler.Program, error) {
+	program, err := parseSource(input, check, trace.Discard)
+	if err != nil {
+		return nil, err
+	}
+	return compiler.Compile(program)
+}
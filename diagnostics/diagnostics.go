@@ -0,0 +1,104 @@
+// Package diagnostics describes problems found in a Berlang program, from a
+// stray character in the lexer to a division by zero at run time, and renders
+// them next to the source they point at.
+package diagnostics
+
+import (
+	"berlang/utils"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+// Codes identify the stage that reported a diagnostic.
+const (
+	CodeLex     = "E0001"
+	CodeParse   = "E0002"
+	CodeType    = "E0003"
+	CodeRuntime = "E0004"
+	CodeCompile = "E0005"
+	CodeResolve = "E0006"
+)
+
+// Diagnostic is a single problem at a place in the source. It implements
+// error so it can be returned through the usual error paths.
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Message  string
+	Span     utils.Span
+	Notes    []string
+}
+
+// Errorf creates an error diagnostic with a formatted message.
+func Errorf(code string, span utils.Span, format string, args ...any) *Diagnostic {
+	return &Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Span:     span,
+	}
+}
+
+// At is the span of a single character, for problems that have no natural
+// extent like an unterminated string.
+func At(line, col int) utils.Span {
+	pos := utils.Position{Line: line, Column: col}
+	return utils.Span{Start: pos, End: pos}
+}
+
+// WithNote adds a note printed below the source snippet and returns d.
+func (d *Diagnostic) WithNote(format string, args ...any) *Diagnostic {
+	d.Notes = append(d.Notes, fmt.Sprintf(format, args...))
+	return d
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s at line: %d, col: %d", d.Message, d.Span.Start.Line, d.Span.Start.Column)
+}
+
+// List is several diagnostics reported together, like every error found by
+// the type checker.
+type List []*Diagnostic
+
+func (l List) Error() string {
+	msgs := make([]string, len(l))
+	for i, d := range l {
+		msgs[i] = d.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// From returns the diagnostics carried by err, or nil when err is a plain
+// error without a location.
+func From(err error) List {
+	var list List
+	if errors.As(err, &list) {
+		return list
+	}
+
+	var d *Diagnostic
+	if errors.As(err, &d) {
+		return List{d}
+	}
+	return nil
+}
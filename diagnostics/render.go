@@ -0,0 +1,120 @@
+package diagnostics
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// snippet is a diagnostic laid out for display, shared by the text and the
+// HTML renderers.
+type snippet struct {
+	severity  string
+	header    string
+	location  string
+	lineNo    string
+	line      string
+	underline string
+	notes     []string
+}
+
+func layout(d *Diagnostic, filename string, src string) snippet {
+	start, end := d.Span.Start, d.Span.End
+
+	s := snippet{
+		severity: d.Severity.String(),
+		header:   d.Message,
+		location: fmt.Sprintf("%s:%d:%d", filename, start.Line, start.Column),
+		notes:    d.Notes,
+	}
+	if d.Code != "" {
+		s.severity += "[" + d.Code + "]"
+	}
+
+	lines := strings.Split(src, "\n")
+	if src == "" || start.Line < 1 || start.Line > len(lines) {
+		return s
+	}
+
+	line := strings.TrimRight(lines[start.Line-1], "\r")
+	s.lineNo = strconv.Itoa(start.Line)
+	s.line = line
+
+	// Columns count runes. Keep tabs in the padding so the carets stay
+	// under the right characters however wide the tabs are drawn.
+	runes := []rune(line)
+	var pad strings.Builder
+	for i := 0; i < start.Column-1 && i < len(runes); i++ {
+		if runes[i] == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+
+	width := len(runes) - start.Column + 1
+	if end.Line == start.Line {
+		width = end.Column - start.Column + 1
+	}
+	width = max(width, 1)
+
+	s.underline = pad.String() + "^" + strings.Repeat("~", width-1)
+	return s
+}
+
+// Render writes d to w the way rustc does, with the offending line of src
+// underneath the message:
+//
+//	error[E0004]: division by zero
+//	 --> main.bl:2:18
+//	  |
+//	2 | let y: int = 2 + x / 0
+//	  |                  ^~~~~
+func Render(w io.Writer, d *Diagnostic, filename string, src string) {
+	s := layout(d, filename, src)
+	gutter := strings.Repeat(" ", len(s.lineNo))
+
+	fmt.Fprintf(w, "%s: %s\n", s.severity, s.header)
+	fmt.Fprintf(w, "%s--> %s\n", gutter, s.location)
+	if s.lineNo != "" {
+		fmt.Fprintf(w, "%s |\n", gutter)
+		fmt.Fprintf(w, "%s | %s\n", s.lineNo, s.line)
+		fmt.Fprintf(w, "%s | %s\n", gutter, s.underline)
+	}
+	for _, note := range s.notes {
+		fmt.Fprintf(w, "%s = note: %s\n", gutter, note)
+	}
+}
+
+// RenderString is Render into a string.
+func RenderString(d *Diagnostic, filename string, src string) string {
+	var sb strings.Builder
+	Render(&sb, d, filename, src)
+	return sb.String()
+}
+
+// RenderHTML lays d out like Render, escaped and wrapped in a <pre> with
+// classes for the web terminal to style.
+func RenderHTML(d *Diagnostic, filename string, src string) string {
+	s := layout(d, filename, src)
+	gutter := strings.Repeat(" ", len(s.lineNo))
+	esc := html.EscapeString
+
+	var sb strings.Builder
+	sb.WriteString(`<pre class="diagnostic">`)
+	fmt.Fprintf(&sb, `<span class="diagnostic-%s">%s</span>: <span class="diagnostic-message">%s</span>`+"\n",
+		esc(d.Severity.String()), esc(s.severity), esc(s.header))
+	fmt.Fprintf(&sb, `<span class="diagnostic-gutter">%s--&gt;</span> %s`+"\n", gutter, esc(s.location))
+	if s.lineNo != "" {
+		fmt.Fprintf(&sb, `<span class="diagnostic-gutter">%s |</span>`+"\n", gutter)
+		fmt.Fprintf(&sb, `<span class="diagnostic-gutter">%s |</span> %s`+"\n", s.lineNo, esc(s.line))
+		fmt.Fprintf(&sb, `<span class="diagnostic-gutter">%s |</span> <span class="diagnostic-underline">%s</span>`+"\n", gutter, esc(s.underline))
+	}
+	for _, note := range s.notes {
+		fmt.Fprintf(&sb, `<span class="diagnostic-gutter">%s =</span> note: %s`+"\n", gutter, esc(note))
+	}
+	sb.WriteString("</pre>")
+	return sb.String()
+}
@@ -0,0 +1,88 @@
+package diagnostics
+
+import (
+	"berlang/utils"
+	"io"
+	"strings"
+	"testing"
+)
+
+func span(startLine, startCol, endLine, endCol int) utils.Span {
+	return utils.Span{
+		Start: utils.Position{Line: startLine, Column: startCol},
+		End:   utils.Position{Line: endLine, Column: endCol},
+	}
+}
+
+func TestRender(t *testing.T) {
+	src := "let x: int = 1\nlet y: int = 2 + x / 0\n"
+	d := Errorf(CodeRuntime, span(2, 18, 2, 22), "division by zero").WithNote("x is 1 here")
+
+	expected := strings.Join([]string{
+		"error[E0004]: division by zero",
+		" --> main.bl:2:18",
+		"  |",
+		"2 | let y: int = 2 + x / 0",
+		"  |                  ^~~~~",
+		"  = note: x is 1 here",
+		"",
+	}, "\n")
+	if got := RenderString(d, "main.bl", src); got != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestRenderUnderline(t *testing.T) {
+	tests := []struct {
+		src       string
+		span      utils.Span
+		underline string
+	}{
+		// A single character gets a lone caret
+		{"a + b", span(1, 3, 1, 3), "  ^"},
+		// Spans running past the line are cut at its end
+		{"f(1,\n  2)", span(1, 1, 2, 4), "^~~~"},
+		// Tabs are kept so the carets line up with the source
+		{"\tx = y", span(1, 6, 1, 6), "\t    ^"},
+	}
+
+	for _, test := range tests {
+		s := layout(Errorf(CodeParse, test.span, "msg"), "main.bl", test.src)
+		if s.underline != test.underline {
+			t.Errorf("Underlining %+v in %q: expected %q, got %q", test.span, test.src, test.underline, s.underline)
+		}
+	}
+}
+
+func TestRenderHTMLEscapes(t *testing.T) {
+	d := Errorf(CodeLex, span(1, 5, 1, 5), "Unexpected character '<'")
+	got := RenderHTML(d, "<input>", "1 + <script>")
+
+	if strings.Contains(got, "<script>") || strings.Contains(got, "<input>") {
+		t.Errorf("Expected the source and file name to be escaped, got %s", got)
+	}
+	if !strings.Contains(got, "1 + &lt;script&gt;") {
+		t.Errorf("Expected the source line in the output, got %s", got)
+	}
+}
+
+func TestFrom(t *testing.T) {
+	d := Errorf(CodeType, span(1, 1, 1, 1), "msg")
+	if got := From(d); len(got) != 1 || got[0] != d {
+		t.Errorf("Expected a single diagnostic, got %v", got)
+	}
+	if got := From(List{d, d}); len(got) != 2 {
+		t.Errorf("Expected both diagnostics of a list, got %v", got)
+	}
+	if got := From(io.ErrUnexpectedEOF); got != nil {
+		t.Errorf("Expected no diagnostics from a plain error, got %v", got)
+	}
+}
+
+func TestRenderUnicode(t *testing.T) {
+	// Columns count runes, not bytes
+	s := layout(Errorf(CodeRuntime, span(1, 8, 1, 15), "msg"), "main.bl", "ağaç = sayı / 0")
+	if s.underline != "       ^~~~~~~~" {
+		t.Errorf("Expected the carets under the division, got %q", s.underline)
+	}
+}
@@ -1,5 +1,10 @@
 package ast
 
+import (
+	"berlang/utils"
+	"strings"
+)
+
 type NodeType string
 
 const (
@@ -8,11 +13,79 @@ const (
 	IdentifierType     NodeType = "Identifier"
 	BinaryExprType     NodeType = "BinaryExpr"
 	VarDeclType        NodeType = "VarDecl"
-    VarAssignType      NodeType = "VarAssign"
+	VarAssignType      NodeType = "VarAssign"
+	BooleanLiteralType NodeType = "BooleanLiteral"
+	UnaryExprType      NodeType = "UnaryExpr"
+	BlockStmtType      NodeType = "BlockStmt"
+	IfStmtType         NodeType = "IfStmt"
+	WhileStmtType      NodeType = "WhileStmt"
+	ForStmtType        NodeType = "ForStmt"
+	BreakStmtType      NodeType = "BreakStmt"
+	ContinueStmtType   NodeType = "ContinueStmt"
+	FunctionDeclType   NodeType = "FunctionDecl"
+	ReturnStmtType     NodeType = "ReturnStmt"
+	CallExprType       NodeType = "CallExpr"
+	FunctionLitType    NodeType = "FunctionLiteral"
+	StringLiteralType  NodeType = "StringLiteral"
+	IndexExprType      NodeType = "IndexExpr"
+	SliceExprType      NodeType = "SliceExpr"
+	BadStmtType        NodeType = "BadStmt"
+	ArrayLiteralType   NodeType = "ArrayLiteral"
+	IndexAssignType    NodeType = "IndexAssign"
+	MapLiteralType     NodeType = "MapLiteral"
+	ForInStmtType      NodeType = "ForInStmt"
+	StructDeclType     NodeType = "StructDecl"
+	StructLiteralType  NodeType = "StructLiteral"
+	FieldExprType      NodeType = "FieldExpr"
+	FieldAssignType    NodeType = "FieldAssign"
+	EnumDeclType       NodeType = "EnumDecl"
+	MatchExprType      NodeType = "MatchExpr"
+	WildcardPatType    NodeType = "WildcardPattern"
+	BindingPatType     NodeType = "BindingPattern"
+	LiteralPatType     NodeType = "LiteralPattern"
+	VariantPatType     NodeType = "VariantPattern"
 )
 
 type Node interface {
 	GetKind() NodeType
+	GetSpan() utils.Span
+	SetSpan(span utils.Span)
+}
+
+// Spanned records where in the source a node came from, from its first to
+// its last token. It is embedded in every node.
+type Spanned struct {
+	Span utils.Span
+}
+
+func (s Spanned) GetSpan() utils.Span      { return s.Span }
+func (s *Spanned) SetSpan(span utils.Span) { s.Span = span }
+
+// Binding says where the variable a node names lives.
+type Binding struct {
+	Global bool
+	// Depth is how many scopes out from the node the variable is declared,
+	// Slot its index in that scope. Both are 0 for globals.
+	Depth int
+	Slot  int
+}
+
+// Bound holds the Binding of a node that names a variable, filled in by the
+// resolver before the program runs. It is embedded in the identifiers,
+// assignments and declarations, struct literals, binding patterns and
+// variant patterns.
+type Bound struct {
+	Binding Binding
+}
+
+func (b Bound) GetBinding() Binding         { return b.Binding }
+func (b *Bound) SetBinding(binding Binding) { b.Binding = binding }
+
+// BoundNode is a node that names a variable.
+type BoundNode interface {
+	Node
+	GetBinding() Binding
+	SetBinding(binding Binding)
 }
 
 type Stmt interface {
@@ -27,6 +100,7 @@ type Expr interface {
 
 type Program struct {
 	Kind NodeType
+	Spanned
 	Body []Stmt
 }
 
@@ -34,7 +108,8 @@ func (p *Program) GetKind() NodeType { return p.Kind }
 func (p *Program) stmtNode()         {}
 
 type BinaryExpr struct {
-	Kind     NodeType
+	Kind NodeType
+	Spanned
 	Left     Expr
 	Right    Expr
 	Operator string
@@ -46,6 +121,8 @@ func (b *BinaryExpr) exprNode()         {}
 
 type Identifier struct {
 	Kind NodeType
+	Spanned
+	Bound
 	Name string
 }
 
@@ -54,46 +131,443 @@ func (i *Identifier) stmtNode()         {}
 func (i *Identifier) exprNode()         {}
 
 type NumericLiteral struct {
-	Kind  NodeType
+	Kind NodeType
+	Spanned
 	Value string
 }
 
 func (n *NumericLiteral) GetKind() NodeType { return n.Kind }
-func (n *NumericLiteral) stmtNode()         {}
-func (n *NumericLiteral) exprNode()         {}
 
-type VarDecl struct {
-	Kind  NodeType
+// IsFloat reports whether the literal is a Float like 3.14 or 1e9, rather
+// than an Int.
+func (n *NumericLiteral) IsFloat() bool { return strings.ContainsAny(n.Value, ".eE") }
+func (n *NumericLiteral) stmtNode()     {}
+func (n *NumericLiteral) exprNode()     {}
+
+type StringLiteral struct {
+	Kind NodeType
+	Spanned
+	Value string
+}
+
+func (s *StringLiteral) GetKind() NodeType { return s.Kind }
+func (s *StringLiteral) stmtNode()         {}
+func (s *StringLiteral) exprNode()         {}
+
+// IndexExpr is Object[Index]
+type IndexExpr struct {
+	Kind NodeType
+	Spanned
+	Object Expr
+	Index  Expr
+}
+
+func (i *IndexExpr) GetKind() NodeType { return i.Kind }
+func (i *IndexExpr) stmtNode()         {}
+func (i *IndexExpr) exprNode()         {}
+
+// SliceExpr is Object[Start:End], either bound is nil when omitted
+type SliceExpr struct {
+	Kind NodeType
+	Spanned
+	Object Expr
+	Start  Expr
+	End    Expr
+}
+
+func (s *SliceExpr) GetKind() NodeType { return s.Kind }
+func (s *SliceExpr) stmtNode()         {}
+func (s *SliceExpr) exprNode()         {}
+
+// ArrayLiteral is a list of elements between brackets, [1, 2, 3]
+type ArrayLiteral struct {
+	Kind NodeType
+	Spanned
+	Elements []Expr
+}
+
+func (a *ArrayLiteral) GetKind() NodeType { return a.Kind }
+func (a *ArrayLiteral) stmtNode()         {}
+func (a *ArrayLiteral) exprNode()         {}
+
+// IndexAssign is Object[Index] = Value
+type IndexAssign struct {
+	Kind NodeType
+	Spanned
+	Object Expr
+	Index  Expr
+	Value  Expr
+}
+
+func (i *IndexAssign) GetKind() NodeType { return i.Kind }
+func (i *IndexAssign) stmtNode()         {}
+func (i *IndexAssign) exprNode()         {}
+
+// MapLiteral is a list of key value pairs between braces, {"a": 1, "b": 2}
+type MapLiteral struct {
+	Kind NodeType
+	Spanned
+	Entries []MapEntry
+}
+
+type MapEntry struct {
+	Key   Expr
+	Value Expr
+}
+
+func (m *MapLiteral) GetKind() NodeType { return m.Kind }
+func (m *MapLiteral) stmtNode()         {}
+func (m *MapLiteral) exprNode()         {}
+
+type BooleanLiteral struct {
+	Kind NodeType
+	Spanned
+	Value bool
+}
+
+func (b *BooleanLiteral) GetKind() NodeType { return b.Kind }
+func (b *BooleanLiteral) stmtNode()         {}
+func (b *BooleanLiteral) exprNode()         {}
+
+// UnaryExpr is a prefix operator applied to a single operand, like !x or -x
+type UnaryExpr struct {
+	Kind NodeType
+	Spanned
+	Operand  Expr
+	Operator string
+}
+
+func (u *UnaryExpr) GetKind() NodeType { return u.Kind }
+func (u *UnaryExpr) stmtNode()         {}
+func (u *UnaryExpr) exprNode()         {}
+
+// BlockStmt is a list of statements between braces with its own scope
+type BlockStmt struct {
+	Kind NodeType
+	Spanned
+	Body []Stmt
+}
+
+func (b *BlockStmt) GetKind() NodeType { return b.Kind }
+func (b *BlockStmt) stmtNode()         {}
+
+type IfStmt struct {
+	Kind NodeType
+	Spanned
+	Condition Expr
+	Then      *BlockStmt
+	Else      Stmt // nil, an *IfStmt for else if, or a *BlockStmt
+}
+
+func (i *IfStmt) GetKind() NodeType { return i.Kind }
+func (i *IfStmt) stmtNode()         {}
+
+type WhileStmt struct {
+	Kind NodeType
+	Spanned
+	Condition Expr
+	Body      *BlockStmt
+}
+
+func (w *WhileStmt) GetKind() NodeType { return w.Kind }
+func (w *WhileStmt) stmtNode()         {}
+
+// ForStmt is a C style loop, Init, Condition and Update are nil when omitted
+type ForStmt struct {
+	Kind NodeType
+	Spanned
+	Init      Stmt
+	Condition Expr
+	Update    Stmt
+	Body      *BlockStmt
+}
+
+func (f *ForStmt) GetKind() NodeType { return f.Kind }
+func (f *ForStmt) stmtNode()         {}
+
+// ForInStmt loops over the keys of a map, the elements of an array or the
+// characters of a string. With two names, for (k, v in m), the first one
+// gets the key or index and the second the value.
+type ForInStmt struct {
+	Kind NodeType
+	Spanned
+	Names    []string
+	Iterable Expr
+	Body     *BlockStmt
+}
+
+func (f *ForInStmt) GetKind() NodeType { return f.Kind }
+func (f *ForInStmt) stmtNode()         {}
+
+type BreakStmt struct {
+	Kind NodeType
+	Spanned
+}
+
+func (b *BreakStmt) GetKind() NodeType { return b.Kind }
+func (b *BreakStmt) stmtNode()         {}
+
+type ContinueStmt struct {
+	Kind NodeType
+	Spanned
+}
+
+func (c *ContinueStmt) GetKind() NodeType { return c.Kind }
+func (c *ContinueStmt) stmtNode()         {}
+
+// BadStmt stands in for a statement that failed to parse, covering the
+// tokens the parser skipped while recovering.
+type BadStmt struct {
+	Kind NodeType
+	Spanned
+}
+
+func (b *BadStmt) GetKind() NodeType { return b.Kind }
+func (b *BadStmt) stmtNode()         {}
+
+// Param is a single typed parameter of a function
+type Param struct {
+	Name string
+	Type string
+}
+
+// StructDecl declares a named type with fields, struct Point { x: int, y: int }
+type StructDecl struct {
+	Kind NodeType
+	Spanned
+	Bound
+	Name   string
+	Fields []Field
+	Doc    string // The /// comments before the declaration, one per line
+}
+
+// Field is a field of a struct and the name of its type.
+type Field struct {
+	Name string
+	Type string
+}
+
+func (s *StructDecl) GetKind() NodeType { return s.Kind }
+func (s *StructDecl) stmtNode()         {}
+
+// StructLiteral creates a value of a struct type, Point{ x: 1, y: 2 }
+type StructLiteral struct {
+	Kind NodeType
+	Spanned
+	Bound
+	Name   string
+	Fields []FieldValue
+}
+
+// FieldValue is one name: value pair of a StructLiteral.
+type FieldValue struct {
 	Name  string
-	ValType  string // TODO actually define these types so we can check
-    VarType string // This is either let or const for now
-	Value *Expr
+	Value Expr
+}
+
+func (s *StructLiteral) GetKind() NodeType { return s.Kind }
+func (s *StructLiteral) stmtNode()         {}
+func (s *StructLiteral) exprNode()         {}
+
+// FieldExpr reads a field of a struct, Object.Field
+type FieldExpr struct {
+	Kind NodeType
+	Spanned
+	Object Expr
+	Field  string
+}
+
+func (f *FieldExpr) GetKind() NodeType { return f.Kind }
+func (f *FieldExpr) stmtNode()         {}
+func (f *FieldExpr) exprNode()         {}
+
+// FieldAssign is Object.Field = Value
+type FieldAssign struct {
+	Kind NodeType
+	Spanned
+	Object Expr
+	Field  string
+	Value  Expr
+}
+
+func (f *FieldAssign) GetKind() NodeType { return f.Kind }
+func (f *FieldAssign) stmtNode()         {}
+func (f *FieldAssign) exprNode()         {}
+
+// EnumDecl declares a sum type, enum Shape { Circle(r: float), Empty }
+type EnumDecl struct {
+	Kind NodeType
+	Spanned
+	Bound
+	Name     string
+	Variants []Variant
+	Doc      string // The /// comments before the declaration, one per line
+}
+
+// Variant is one case of an enum and the fields it carries, if any.
+type Variant struct {
+	Name   string
+	Fields []Field
+}
+
+func (e *EnumDecl) GetKind() NodeType { return e.Kind }
+func (e *EnumDecl) stmtNode()         {}
+
+// MatchExpr evaluates to the body of the first arm whose pattern matches the
+// subject and whose guard, if any, is true.
+type MatchExpr struct {
+	Kind NodeType
+	Spanned
+	Subject Expr
+	Arms    []MatchArm
+}
+
+// MatchArm is Pattern if Guard => Body. Guard is nil when omitted and Body
+// is either an expression or a *BlockStmt.
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expr
+	Body    Stmt
+}
+
+func (m *MatchExpr) GetKind() NodeType { return m.Kind }
+func (m *MatchExpr) stmtNode()         {}
+func (m *MatchExpr) exprNode()         {}
+
+// Pattern is the left side of a match arm.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// WildcardPattern is _, it matches anything.
+type WildcardPattern struct {
+	Kind NodeType
+	Spanned
+}
+
+func (w *WildcardPattern) GetKind() NodeType { return w.Kind }
+func (w *WildcardPattern) patternNode()      {}
+
+// BindingPattern matches anything and binds it to Name inside the arm.
+type BindingPattern struct {
+	Kind NodeType
+	Spanned
+	Bound
+	Name string
+}
+
+func (b *BindingPattern) GetKind() NodeType { return b.Kind }
+func (b *BindingPattern) patternNode()      {}
+
+// LiteralPattern matches values equal to a number, string or bool literal.
+// A negative number is a UnaryExpr.
+type LiteralPattern struct {
+	Kind NodeType
+	Spanned
+	Value Expr
+}
+
+func (l *LiteralPattern) GetKind() NodeType { return l.Kind }
+func (l *LiteralPattern) patternNode()      {}
+
+// VariantPattern matches one variant of an enum, Enum.Variant(a, b), and
+// matches its fields against the patterns in Fields.
+type VariantPattern struct {
+	Kind NodeType
+	Spanned
+	Bound
+	Enum    string
+	Variant string
+	Fields  []Pattern
+}
+
+func (v *VariantPattern) GetKind() NodeType { return v.Kind }
+func (v *VariantPattern) patternNode()      {}
+
+type FunctionDecl struct {
+	Kind NodeType
+	Spanned
+	Bound
+	Name       string
+	Params     []Param
+	ReturnType string // Empty when the return type is omitted
+	Body       *BlockStmt
+	Doc        string // The /// comments before the declaration, one per line
+}
+
+func (f *FunctionDecl) GetKind() NodeType { return f.Kind }
+func (f *FunctionDecl) stmtNode()         {}
+
+// FunctionLiteral is an anonymous function used as an expression,
+// def(x: int) { ... }
+type FunctionLiteral struct {
+	Kind NodeType
+	Spanned
+	Params     []Param
+	ReturnType string
+	Body       *BlockStmt
+}
+
+func (f *FunctionLiteral) GetKind() NodeType { return f.Kind }
+func (f *FunctionLiteral) stmtNode()         {}
+func (f *FunctionLiteral) exprNode()         {}
+
+type ReturnStmt struct {
+	Kind NodeType
+	Spanned
+	Value Expr // nil for a bare return
+}
+
+func (r *ReturnStmt) GetKind() NodeType { return r.Kind }
+func (r *ReturnStmt) stmtNode()         {}
+
+type CallExpr struct {
+	Kind NodeType
+	Spanned
+	Callee Expr
+	Args   []Expr
+}
+
+func (c *CallExpr) GetKind() NodeType { return c.Kind }
+func (c *CallExpr) stmtNode()         {}
+func (c *CallExpr) exprNode()         {}
+
+type VarDecl struct {
+	Kind NodeType
+	Spanned
+	Bound
+	Name    string
+	ValType string // The declared type, checked by frontend/types
+	VarType string // This is either let or const for now
+	Value   *Expr
+	Doc     string // The /// comments before the declaration, one per line
 }
 
 func (n *VarDecl) GetKind() NodeType { return n.Kind }
 func (n *VarDecl) stmtNode()         {}
 func (n *VarDecl) exprNode()         {}
 
-func NewVarDecl(name string, vartype string, value *Expr) *VarDecl {
-	return &VarDecl{Kind: VarDeclType, Name: name, ValType: vartype, Value: value}
+func NewVarDecl(name string, valtype string, vartype string, value *Expr) *VarDecl {
+	return &VarDecl{Kind: VarDeclType, Name: name, ValType: valtype, VarType: vartype, Value: value}
 }
 
 type VarAssign struct {
-    Kind  NodeType
-    Name  string
-    Value *Expr
+	Kind NodeType
+	Spanned
+	Bound
+	Name  string
+	Value *Expr
 }
 
 func (n *VarAssign) GetKind() NodeType { return n.Kind }
 func (n *VarAssign) stmtNode()         {}
 func (n *VarAssign) exprNode()         {}
 
-
 func NewVarAssign(name string, value *Expr) *VarAssign {
-    return &VarAssign{Kind: VarAssignType, Name: name, Value: value}
+	return &VarAssign{Kind: VarAssignType, Name: name, Value: value}
 }
 
-
 func NewProgram() *Program {
 	return &Program{
 		Kind: ProgramType,
@@ -123,3 +597,192 @@ func NewNumericLiteral(value string) *NumericLiteral {
 		Value: value,
 	}
 }
+
+func NewBooleanLiteral(value bool) *BooleanLiteral {
+	return &BooleanLiteral{
+		Kind:  BooleanLiteralType,
+		Value: value,
+	}
+}
+
+func NewUnaryExpr(operand Expr, operator string) *UnaryExpr {
+	return &UnaryExpr{
+		Kind:     UnaryExprType,
+		Operand:  operand,
+		Operator: operator,
+	}
+}
+
+func NewBlockStmt() *BlockStmt {
+	return &BlockStmt{
+		Kind: BlockStmtType,
+		Body: make([]Stmt, 0),
+	}
+}
+
+func NewIfStmt(condition Expr, then *BlockStmt, otherwise Stmt) *IfStmt {
+	return &IfStmt{
+		Kind:      IfStmtType,
+		Condition: condition,
+		Then:      then,
+		Else:      otherwise,
+	}
+}
+
+func NewWhileStmt(condition Expr, body *BlockStmt) *WhileStmt {
+	return &WhileStmt{
+		Kind:      WhileStmtType,
+		Condition: condition,
+		Body:      body,
+	}
+}
+
+func NewForStmt(init Stmt, condition Expr, update Stmt, body *BlockStmt) *ForStmt {
+	return &ForStmt{
+		Kind:      ForStmtType,
+		Init:      init,
+		Condition: condition,
+		Update:    update,
+		Body:      body,
+	}
+}
+
+func NewForInStmt(names []string, iterable Expr, body *BlockStmt) *ForInStmt {
+	return &ForInStmt{
+		Kind:     ForInStmtType,
+		Names:    names,
+		Iterable: iterable,
+		Body:     body,
+	}
+}
+
+func NewBreakStmt() *BreakStmt {
+	return &BreakStmt{Kind: BreakStmtType}
+}
+
+func NewContinueStmt() *ContinueStmt {
+	return &ContinueStmt{Kind: ContinueStmtType}
+}
+
+func NewBadStmt() *BadStmt {
+	return &BadStmt{Kind: BadStmtType}
+}
+
+func NewFunctionDecl(name string, params []Param, returnType string, body *BlockStmt) *FunctionDecl {
+	return &FunctionDecl{
+		Kind:       FunctionDeclType,
+		Name:       name,
+		Params:     params,
+		ReturnType: returnType,
+		Body:       body,
+	}
+}
+
+func NewReturnStmt(value Expr) *ReturnStmt {
+	return &ReturnStmt{Kind: ReturnStmtType, Value: value}
+}
+
+func NewCallExpr(callee Expr, args []Expr) *CallExpr {
+	return &CallExpr{
+		Kind:   CallExprType,
+		Callee: callee,
+		Args:   args,
+	}
+}
+
+func NewFunctionLiteral(params []Param, returnType string, body *BlockStmt) *FunctionLiteral {
+	return &FunctionLiteral{
+		Kind:       FunctionLitType,
+		Params:     params,
+		ReturnType: returnType,
+		Body:       body,
+	}
+}
+
+func NewStringLiteral(value string) *StringLiteral {
+	return &StringLiteral{Kind: StringLiteralType, Value: value}
+}
+
+func NewIndexExpr(object Expr, index Expr) *IndexExpr {
+	return &IndexExpr{
+		Kind:   IndexExprType,
+		Object: object,
+		Index:  index,
+	}
+}
+
+func NewSliceExpr(object Expr, start Expr, end Expr) *SliceExpr {
+	return &SliceExpr{
+		Kind:   SliceExprType,
+		Object: object,
+		Start:  start,
+		End:    end,
+	}
+}
+
+func NewArrayLiteral(elements []Expr) *ArrayLiteral {
+	return &ArrayLiteral{Kind: ArrayLiteralType, Elements: elements}
+}
+
+func NewIndexAssign(object Expr, index Expr, value Expr) *IndexAssign {
+	return &IndexAssign{
+		Kind:   IndexAssignType,
+		Object: object,
+		Index:  index,
+		Value:  value,
+	}
+}
+
+func NewMapLiteral(entries []MapEntry) *MapLiteral {
+	return &MapLiteral{Kind: MapLiteralType, Entries: entries}
+}
+
+func NewStructDecl(name string, fields []Field) *StructDecl {
+	return &StructDecl{Kind: StructDeclType, Name: name, Fields: fields}
+}
+
+func NewStructLiteral(name string, fields []FieldValue) *StructLiteral {
+	return &StructLiteral{Kind: StructLiteralType, Name: name, Fields: fields}
+}
+
+func NewFieldExpr(object Expr, field string) *FieldExpr {
+	return &FieldExpr{Kind: FieldExprType, Object: object, Field: field}
+}
+
+func NewFieldAssign(object Expr, field string, value Expr) *FieldAssign {
+	return &FieldAssign{
+		Kind:   FieldAssignType,
+		Object: object,
+		Field:  field,
+		Value:  value,
+	}
+}
+
+func NewEnumDecl(name string, variants []Variant) *EnumDecl {
+	return &EnumDecl{Kind: EnumDeclType, Name: name, Variants: variants}
+}
+
+func NewMatchExpr(subject Expr, arms []MatchArm) *MatchExpr {
+	return &MatchExpr{Kind: MatchExprType, Subject: subject, Arms: arms}
+}
+
+func NewWildcardPattern() *WildcardPattern {
+	return &WildcardPattern{Kind: WildcardPatType}
+}
+
+func NewBindingPattern(name string) *BindingPattern {
+	return &BindingPattern{Kind: BindingPatType, Name: name}
+}
+
+func NewLiteralPattern(value Expr) *LiteralPattern {
+	return &LiteralPattern{Kind: LiteralPatType, Value: value}
+}
+
+func NewVariantPattern(enum string, variant string, fields []Pattern) *VariantPattern {
+	return &VariantPattern{
+		Kind:    VariantPatType,
+		Enum:    enum,
+		Variant: variant,
+		Fields:  fields,
+	}
+}
@@ -1,18 +1,34 @@
 package lexer
 
 import (
+	"berlang/diagnostics"
+	"berlang/trace"
 	"berlang/utils"
 	"bufio"
-	"fmt"
 	"io"
+	"iter"
+	"log/slog"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	reader *bufio.Reader
-	ch     byte
+	ch     rune
 	line   int
 	column int
+	// invalid is set when ch stands for a byte that is not valid UTF-8
+	invalid bool
+	// prevLine and prevColumn are the position of the character before ch,
+	// which is the last character of a token once it has been read
+	prevLine   int
+	prevColumn int
+	// end is where the last token finished
+	end    utils.Position
+	primed bool
+	tracer trace.Tracer
 }
 
 func NewLexer(r io.Reader) *Lexer {
@@ -20,11 +36,28 @@ func NewLexer(r io.Reader) *Lexer {
 		reader: bufio.NewReader(r),
 		line:   1,
 		column: 0,
+		tracer: trace.Discard,
 	}
 }
 
+// SetTracer makes the lexer report every token it reads to t.
+func (l *Lexer) SetTracer(t trace.Tracer) {
+	l.tracer = t
+}
+
+func (l *Lexer) traceToken(tok utils.Token) {
+	if l.tracer.Enabled(trace.Lexer) {
+		l.tracer.Event(trace.Lexer, "token", tok.Span(),
+			slog.String("type", string(tok.Type)), slog.String("literal", tok.Literal))
+	}
+}
+
+// readChar moves to the next rune of the input. Columns count runes, so
+// they match what an editor shows for non-ASCII text.
 func (l *Lexer) readChar() error {
-	ch, err := l.reader.ReadByte()
+	l.prevLine, l.prevColumn = l.line, l.column
+
+	ch, size, err := l.reader.ReadRune()
 	if err == io.EOF {
 		l.ch = 0
 		return err
@@ -33,6 +66,7 @@ func (l *Lexer) readChar() error {
 	}
 
 	l.ch = ch
+	l.invalid = ch == utf8.RuneError && size == 1
 	l.column++
 	if ch == '\n' {
 		l.line++
@@ -41,38 +75,69 @@ func (l *Lexer) readChar() error {
 	return nil
 }
 
-func (l *Lexer) unreadChar() error {
-	l.column--
-	fmt.Println("Unreading character")
-	// TODO Handle where we are unreading the first token so
-	// column is len(line) and line--
-	return l.reader.UnreadByte()
-}
-
-func (l *Lexer) Lex() (*utils.TokenQueue, error) {
-	var tokens = utils.NewTokenQueue()
+// Next returns the next token of the input, reading only as much as it
+// needs. At the end of the input it returns an EOF token, on this and every
+// later call. After an error the offending input has been skipped, so the
+// caller can keep asking for tokens to find further errors.
+func (l *Lexer) Next() (utils.Token, error) {
+	if !l.primed {
+		l.primed = true
+		if err := l.readChar(); err != nil && err != io.EOF {
+			return utils.Token{}, err
+		}
 
-	// Prime the first character
-	err := l.readChar()
-	if err != nil && err != io.EOF {
-		return utils.NewTokenQueue(), err
+		// A byte order mark is not part of the source
+		if l.ch == '\uFEFF' {
+			l.column--
+			if err := l.readChar(); err != nil && err != io.EOF {
+				return utils.Token{}, err
+			}
+		}
 	}
 
-	for l.ch != 0 {
-		l.skipWhitespace()
+	if err := l.skipWhitespaceAndComments(); err != nil {
+		return utils.Token{Type: utils.TOKEN_ILLEGAL}, err
+	}
 
-		tok, err := l.nextToken()
-		if err != io.EOF && err != nil {
-			return utils.NewTokenQueue(), err
-		}
+	tok, err := l.nextToken()
+	if tok.Type == utils.TOKEN_EOF {
+		// Right after the last token instead of on a trailing empty line
+		tok.Line, tok.Column = l.end.Line, l.end.Column+1
+		tok.EndLine, tok.EndColumn = tok.Line, tok.Column
+		l.traceToken(tok)
+		return tok, nil
+	}
 
-		tokens.Push(tok)
+	tok.EndLine, tok.EndColumn = l.prevLine, l.prevColumn
+	l.end = utils.Position{Line: tok.EndLine, Column: tok.EndColumn}
+	if err == nil {
+		l.traceToken(tok)
+	}
+	return tok, err
+}
 
-		if tok.Type == utils.TOKEN_EOF {
-			break
+// Tokens is Next as an iterator. It ends after yielding the EOF token, or
+// earlier when the loop breaks.
+func (l *Lexer) Tokens() iter.Seq2[utils.Token, error] {
+	return func(yield func(utils.Token, error) bool) {
+		for {
+			tok, err := l.Next()
+			if !yield(tok, err) || (err == nil && tok.Type == utils.TOKEN_EOF) {
+				return
+			}
 		}
 	}
+}
 
+// Lex reads the whole input into a TokenQueue, stopping at the first error.
+func (l *Lexer) Lex() (*utils.TokenQueue, error) {
+	tokens := utils.NewTokenQueue()
+	for tok, err := range l.Tokens() {
+		if err != nil {
+			return utils.NewTokenQueue(), err
+		}
+		tokens.Push(tok)
+	}
 	return tokens, nil
 }
 
@@ -84,6 +149,94 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// skipWhitespaceAndComments moves to the start of the next token. Doc
+// comments are tokens themselves and are left for nextToken.
+func (l *Lexer) skipWhitespaceAndComments() error {
+	for {
+		l.skipWhitespace()
+		if l.ch != '/' {
+			return nil
+		}
+
+		next, _ := l.reader.Peek(3)
+		switch {
+		case isDocComment(next):
+			return nil
+		case len(next) > 0 && next[0] == '/':
+			l.skipLineComment()
+		case len(next) > 0 && next[0] == '*':
+			if err := l.skipBlockComment(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// isDocComment reports whether next, the characters after a slash, start a
+// /// doc comment. Four or more slashes are a plain comment, like in Rust.
+func isDocComment(next []byte) bool {
+	return len(next) >= 2 && next[0] == '/' && next[1] == '/' && (len(next) == 2 || next[2] != '/')
+}
+
+func (l *Lexer) skipLineComment() {
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+// skipBlockComment skips a /* */ comment. Block comments nest, so a comment
+// can be used to disable code that already contains one.
+func (l *Lexer) skipBlockComment() error {
+	line, col := l.line, l.column
+	l.readChar()
+
+	depth := 1
+	for depth > 0 {
+		if err := l.readChar(); err != nil {
+			return l.errorFrom(line, col, "Unterminated block comment")
+		}
+
+		next, _ := l.reader.Peek(1)
+		switch {
+		case l.ch == '/' && len(next) == 1 && next[0] == '*':
+			l.readChar()
+			depth++
+		case l.ch == '*' && len(next) == 1 && next[0] == '/':
+			l.readChar()
+			depth--
+		}
+	}
+
+	l.readChar()
+	return nil
+}
+
+// lexDocComment reads a /// comment up to the end of the line. The literal
+// is the text after the slashes, without the first space.
+func (l *Lexer) lexDocComment() utils.Token {
+	tok := utils.Token{Type: utils.TOKEN_DOC, Line: l.line, Column: l.column}
+
+	for range 3 {
+		l.readChar()
+	}
+	if l.ch == ' ' {
+		l.readChar()
+	}
+
+	var sb strings.Builder
+	for l.ch != '\n' && l.ch != 0 {
+		if l.ch != '\r' {
+			sb.WriteRune(l.ch)
+		}
+		l.readChar()
+	}
+
+	tok.Literal = sb.String()
+	return tok
+}
+
 func (l *Lexer) nextToken() (utils.Token, error) {
 	var tok utils.Token
 	tok.Line = l.line
@@ -94,8 +247,25 @@ func (l *Lexer) nextToken() (utils.Token, error) {
 		return tok, io.EOF
 	}
 
-    // TODO add k that would mean look k characters ahead to see if anything more matches
-    // This needs to be done, at least k=1 because we need to, for example discriminate > and >=
+	if l.ch == '/' {
+		if next, _ := l.reader.Peek(3); isDocComment(next) {
+			return l.lexDocComment(), nil
+		}
+	}
+
+	// Look one character ahead to discriminate, for example, > and >=
+	if next, err := l.reader.Peek(1); err == nil {
+		literal := string(l.ch) + string(next[0])
+		if tokenType, ok := utils.DoubleCharTokens[literal]; ok {
+			tok.Type = tokenType
+			tok.Literal = literal
+
+			l.readChar()
+			l.readChar()
+
+			return tok, nil
+		}
+	}
 
 	if tokenType, ok := utils.SingleCharTokens[l.ch]; ok {
 		tok.Type = tokenType
@@ -108,15 +278,23 @@ func (l *Lexer) nextToken() (utils.Token, error) {
 
 	// Handle other cases
 	switch {
-	case isLetter(l.ch):
+	case isIdentStart(l.ch):
 		return l.lexIdentifier()
 	case isDigit(l.ch):
 		return l.lexNumber()
+	case l.ch == '"':
+		return l.lexString()
 	default:
 		tok.Type = utils.TOKEN_ILLEGAL
 		tok.Literal = string(l.ch)
+		invalid := l.invalid
+		l.readChar()
 
-		return tok, nil
+		span := diagnostics.At(tok.Line, tok.Column)
+		if invalid {
+			return tok, diagnostics.Errorf(diagnostics.CodeLex, span, "Invalid UTF-8 encoding")
+		}
+		return tok, diagnostics.Errorf(diagnostics.CodeLex, span, "Unexpected character %q", tok.Literal)
 	}
 }
 
@@ -126,8 +304,8 @@ func (l *Lexer) lexIdentifier() (utils.Token, error) {
 	tok.Column = l.column
 
 	var sb strings.Builder
-	for isLetter(l.ch) || isDigit(l.ch) {
-		sb.WriteByte(l.ch)
+	for isIdentContinue(l.ch) {
+		sb.WriteRune(l.ch)
 		if err := l.readChar(); err != nil {
 			break
 		}
@@ -139,33 +317,214 @@ func (l *Lexer) lexIdentifier() (utils.Token, error) {
 	return tok, nil
 }
 
+// lexNumber reads an Int like 42 or a Float like 3.14, 1e9 or 2.5E-3. A dot
+// only belongs to the number when a digit follows it. Numbers too big for an
+// Int or a Float are reported here, so neither backend meets them.
 func (l *Lexer) lexNumber() (utils.Token, error) {
 	var tok utils.Token
 	tok.Line = l.line
 	tok.Column = l.column
 
 	var sb strings.Builder
-	for isDigit(l.ch) {
-		sb.WriteByte(l.ch)
-		if err := l.readChar(); err != nil {
-			break
+	l.readDigits(&sb)
+
+	if l.ch == '.' && l.peekIsDigit(0) {
+		sb.WriteRune(l.ch)
+		l.readChar()
+		l.readDigits(&sb)
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		signed := false
+		if next, err := l.reader.Peek(1); err == nil && (next[0] == '+' || next[0] == '-') {
+			signed = true
+		}
+
+		offset := 0
+		if signed {
+			offset = 1
+		}
+		if l.peekIsDigit(offset) {
+			sb.WriteRune(l.ch)
+			l.readChar()
+			if signed {
+				sb.WriteRune(l.ch)
+				l.readChar()
+			}
+			l.readDigits(&sb)
 		}
 	}
 
 	tok.Literal = sb.String()
 	tok.Type = utils.TOKEN_NUMBER
 
+	span := utils.Span{
+		Start: utils.Position{Line: tok.Line, Column: tok.Column},
+		End:   utils.Position{Line: l.prevLine, Column: l.prevColumn},
+	}
+	if strings.ContainsAny(tok.Literal, ".eE") {
+		if _, err := strconv.ParseFloat(tok.Literal, 64); err != nil {
+			return tok, diagnostics.Errorf(diagnostics.CodeLex, span, "Float literal %s is out of range", tok.Literal)
+		}
+	} else if _, err := strconv.ParseInt(tok.Literal, 10, 64); err != nil {
+		return tok, diagnostics.Errorf(diagnostics.CodeLex, span, "Integer literal %s does not fit in an Int", tok.Literal)
+	}
 	return tok, nil
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func (l *Lexer) readDigits(sb *strings.Builder) {
+	for isDigit(l.ch) {
+		sb.WriteRune(l.ch)
+		if err := l.readChar(); err != nil {
+			break
+		}
+	}
 }
 
-func isDigit(ch byte) bool {
+// peekIsDigit reports whether the character offset positions after the one
+// following the current character is a digit, without consuming anything.
+func (l *Lexer) peekIsDigit(offset int) bool {
+	next, err := l.reader.Peek(offset + 1)
+	return err == nil && isDigit(rune(next[offset]))
+}
+
+// lexString reads a double quoted string literal, the token literal holds the
+// string with its escape sequences already decoded. A bad escape sequence or
+// invalid UTF-8 is reported once the whole string has been read, so lexing can carry on after
+// the closing quote.
+func (l *Lexer) lexString() (utils.Token, error) {
+	var tok utils.Token
+	tok.Type = utils.TOKEN_STRING
+	tok.Line = l.line
+	tok.Column = l.column
+
+	var sb strings.Builder
+	var strErr error
+	for {
+		if err := l.readChar(); err != nil {
+			if strErr != nil {
+				return tok, strErr
+			}
+			return tok, l.errorFrom(tok.Line, tok.Column, "Unterminated string")
+		}
+
+		switch l.ch {
+		case '"':
+			l.readChar()
+			tok.Literal = sb.String()
+			return tok, strErr
+
+		case '\\':
+			if err := l.lexEscape(&sb); err != nil && strErr == nil {
+				strErr = err
+				if l.ch == '"' {
+					// The escape ran into the closing quote, as in "\u{"
+					l.readChar()
+					return tok, strErr
+				}
+			}
+
+		default:
+			if l.invalid && strErr == nil {
+				strErr = l.errorFrom(l.line, l.column, "Invalid UTF-8 encoding in string")
+			}
+			sb.WriteRune(l.ch)
+		}
+	}
+}
+
+var escapes = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'"':  '"',
+	'\\': '\\',
+}
+
+// errorFrom reports a problem with the source from line and col up to the
+// current character.
+func (l *Lexer) errorFrom(line, col int, format string, args ...any) *diagnostics.Diagnostic {
+	span := utils.Span{
+		Start: utils.Position{Line: line, Column: col},
+		End:   utils.Position{Line: l.line, Column: l.column},
+	}
+	return diagnostics.Errorf(diagnostics.CodeLex, span, format, args...)
+}
+
+// lexEscape decodes the escape sequence after a backslash into sb.
+func (l *Lexer) lexEscape(sb *strings.Builder) error {
+	line, col := l.line, l.column
+	if err := l.readChar(); err != nil {
+		return l.errorFrom(line, col, "Unterminated string")
+	}
+
+	if decoded, ok := escapes[l.ch]; ok {
+		sb.WriteRune(decoded)
+		return nil
+	}
+
+	if l.ch != 'u' {
+		return l.errorFrom(line, col, "Unknown escape sequence \\%c", l.ch).
+			WithNote("the known escapes are \\n \\t \\r \\0 \\\" \\\\ and \\u{...}")
+	}
+
+	// \u{1F600}: one to six hex digits between braces
+	if err := l.readChar(); err != nil || l.ch != '{' {
+		return l.errorFrom(line, col, "Expected { after \\u")
+	}
+
+	var hex strings.Builder
+	for {
+		if err := l.readChar(); err != nil {
+			return l.errorFrom(line, col, "Unterminated unicode escape")
+		}
+		if l.ch == '}' {
+			break
+		}
+		if !isHexDigit(l.ch) {
+			return l.errorFrom(line, col, "Invalid character %q in unicode escape", l.ch)
+		}
+		hex.WriteRune(l.ch)
+	}
+
+	code, err := strconv.ParseUint(hex.String(), 16, 32)
+	if err != nil || hex.Len() > 6 || !utf8.ValidRune(rune(code)) {
+		return l.errorFrom(line, col, "Invalid unicode escape \\u{%s}", hex.String())
+	}
+	sb.WriteRune(rune(code))
+	return nil
+}
+
+// isIdentStart and isIdentContinue follow the XID_Start and XID_Continue
+// properties of Unicode identifiers, built from the categories the unicode
+// package has, so names like sayı or ağaç work. An underscore can start an
+// identifier too.
+func isIdentStart(ch rune) bool {
+	if ch < utf8.RuneSelf {
+		return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+	}
+	return unicode.In(ch, unicode.L, unicode.Nl, unicode.Other_ID_Start) &&
+		!unicode.In(ch, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
+}
+
+func isIdentContinue(ch rune) bool {
+	if ch < utf8.RuneSelf {
+		return isIdentStart(ch) || isDigit(ch)
+	}
+	return isIdentStart(ch) ||
+		unicode.In(ch, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue) &&
+			!unicode.In(ch, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
+}
+
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
 func lookupIdentifier(ident string) utils.TokenType {
 	if tok, ok := utils.Keywords[ident]; ok {
 		return tok
@@ -1,12 +1,15 @@
 package lexer
 
 import (
+	"berlang/utils"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
 func TestLex(t *testing.T) {
-	file, err := os.Open("../berlang/000-variable.bl")
+	file, err := os.Open("../../berlang/000-variable.bl")
 	if err != nil {
 		t.Fatalf("Error opening file: %v", err)
 	}
@@ -22,7 +25,196 @@ func TestLex(t *testing.T) {
 	}
 
 	// Print the tokens
-	for _, token := range tokens.Tokens(){
+	for _, token := range tokens.Tokens() {
 		t.Logf("%+v", token)
 	}
 }
+
+func TestLexOperators(t *testing.T) {
+	l := NewLexer(strings.NewReader("a<=b >c == !d != e&&f||g<h"))
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Error during lexing: %v", err)
+	}
+
+	expected := []utils.TokenType{
+		utils.TOKEN_IDENT, utils.TOKEN_LTE, utils.TOKEN_IDENT, utils.TOKEN_GT, utils.TOKEN_IDENT,
+		utils.TOKEN_EQ, utils.TOKEN_BANG, utils.TOKEN_IDENT, utils.TOKEN_NOT_EQ, utils.TOKEN_IDENT,
+		utils.TOKEN_AND, utils.TOKEN_IDENT, utils.TOKEN_OR, utils.TOKEN_IDENT, utils.TOKEN_LT,
+		utils.TOKEN_IDENT, utils.TOKEN_EOF,
+	}
+
+	got := tokens.Tokens()
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d: %+v", len(expected), len(got), got)
+	}
+	for i, tok := range got {
+		if tok.Type != expected[i] {
+			t.Errorf("Token %d: expected %s, got %s (%q)", i, expected[i], tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestLexString(t *testing.T) {
+	l := NewLexer(strings.NewReader(`"a\tb\n\"c\" \u{1F600}"`))
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Error during lexing: %v", err)
+	}
+
+	tok := tokens.Tokens()[0]
+	if tok.Type != utils.TOKEN_STRING || tok.Literal != "a\tb\n\"c\" 😀" {
+		t.Fatalf("Unexpected token %+v", tok)
+	}
+
+	for _, input := range []string{`"unterminated`, `"bad \q escape"`, `"\u{110000}"`} {
+		if _, err := NewLexer(strings.NewReader(input)).Lex(); err == nil {
+			t.Errorf("Expected an error lexing %s", input)
+		}
+	}
+}
+
+func TestLexNumber(t *testing.T) {
+	l := NewLexer(strings.NewReader("42 3.14 1e9 2.5E-3 7e"))
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Error during lexing: %v", err)
+	}
+
+	expected := []string{"42", "3.14", "1e9", "2.5E-3", "7", "e"}
+	got := tokens.Tokens()
+	for i, literal := range expected {
+		if got[i].Literal != literal {
+			t.Errorf("Token %d: expected %q, got %q", i, literal, got[i].Literal)
+		}
+	}
+
+	for _, input := range []string{"9223372036854775808", "99999999999999999999", "1e400", "1.5E+999"} {
+		if _, err := NewLexer(strings.NewReader(input)).Lex(); err == nil {
+			t.Errorf("Expected an error lexing %s", input)
+		}
+	}
+}
+
+func TestLexComments(t *testing.T) {
+	input := `// a line comment
+let x: int = 4 / 2 // trailing
+/* a block /* nested */ comment */ x
+//// not a doc comment
+/// Doubles n.
+///
+def f() {}`
+
+	tokens, err := NewLexer(strings.NewReader(input)).Lex()
+	if err != nil {
+		t.Fatalf("Error during lexing: %v", err)
+	}
+
+	expected := []struct {
+		typ     utils.TokenType
+		literal string
+	}{
+		{utils.TOKEN_LET, "let"}, {utils.TOKEN_IDENT, "x"}, {utils.TOKEN_COLON, ":"},
+		{utils.TOKEN_TYPE, "int"}, {utils.TOKEN_ASSIGN, "="}, {utils.TOKEN_NUMBER, "4"},
+		{utils.TOKEN_DIV, "/"}, {utils.TOKEN_NUMBER, "2"}, {utils.TOKEN_IDENT, "x"},
+		{utils.TOKEN_DOC, "Doubles n."}, {utils.TOKEN_DOC, ""},
+		{utils.TOKEN_FUNCTION, "def"}, {utils.TOKEN_IDENT, "f"}, {utils.TOKEN_LPAREN, "("},
+		{utils.TOKEN_RPAREN, ")"}, {utils.TOKEN_LBRACE, "{"}, {utils.TOKEN_RBRACE, "}"},
+		{utils.TOKEN_EOF, ""},
+	}
+
+	got := tokens.Tokens()
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d: %+v", len(expected), len(got), got)
+	}
+	for i, e := range expected {
+		if got[i].Type != e.typ || got[i].Literal != e.literal {
+			t.Errorf("Token %d: expected %s %q, got %s %q", i, e.typ, e.literal, got[i].Type, got[i].Literal)
+		}
+	}
+
+	if _, err := NewLexer(strings.NewReader("/* /* */ x")).Lex(); err == nil {
+		t.Errorf("Expected an error for an unterminated nested comment")
+	}
+}
+
+func TestLexNext(t *testing.T) {
+	l := NewLexer(strings.NewReader("a $ b"))
+
+	expected := []struct {
+		typ     utils.TokenType
+		literal string
+		fails   bool
+	}{
+		{utils.TOKEN_IDENT, "a", false},
+		{utils.TOKEN_ILLEGAL, "$", true},
+		{utils.TOKEN_IDENT, "b", false},
+		{utils.TOKEN_EOF, "", false},
+		{utils.TOKEN_EOF, "", false},
+	}
+	for i, e := range expected {
+		tok, err := l.Next()
+		if tok.Type != e.typ || tok.Literal != e.literal || (err != nil) != e.fails {
+			t.Errorf("Token %d: expected %s %q, got %s %q with error %v", i, e.typ, e.literal, tok.Type, tok.Literal, err)
+		}
+	}
+}
+
+func TestLexTokens(t *testing.T) {
+	var got []utils.TokenType
+	for tok, err := range NewLexer(strings.NewReader("x = 1")).Tokens() {
+		if err != nil {
+			t.Fatalf("Error during lexing: %v", err)
+		}
+		got = append(got, tok.Type)
+	}
+
+	expected := []utils.TokenType{utils.TOKEN_IDENT, utils.TOKEN_ASSIGN, utils.TOKEN_NUMBER, utils.TOKEN_EOF}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestLexUnicode(t *testing.T) {
+	input := "\uFEFFlet ağaç_1: string = \"çiçek 🌸\"\nsayı + _x"
+
+	tokens, err := NewLexer(strings.NewReader(input)).Lex()
+	if err != nil {
+		t.Fatalf("Error during lexing: %v", err)
+	}
+
+	expected := []struct {
+		typ          utils.TokenType
+		literal      string
+		line, column int
+	}{
+		{utils.TOKEN_LET, "let", 1, 1},
+		{utils.TOKEN_IDENT, "ağaç_1", 1, 5},
+		{utils.TOKEN_COLON, ":", 1, 11},
+		{utils.TOKEN_TYPE, "string", 1, 13},
+		{utils.TOKEN_ASSIGN, "=", 1, 20},
+		{utils.TOKEN_STRING, "çiçek 🌸", 1, 22},
+		{utils.TOKEN_IDENT, "sayı", 2, 1},
+		{utils.TOKEN_PLUS, "+", 2, 6},
+		{utils.TOKEN_IDENT, "_x", 2, 8},
+	}
+
+	got := tokens.Tokens()
+	for i, e := range expected {
+		tok := got[i]
+		if tok.Type != e.typ || tok.Literal != e.literal || tok.Line != e.line || tok.Column != e.column {
+			t.Errorf("Token %d: expected %s %q at %d:%d, got %s %q at %d:%d", i,
+				e.typ, e.literal, e.line, e.column, tok.Type, tok.Literal, tok.Line, tok.Column)
+		}
+	}
+
+	if ident := got[1]; ident.EndColumn != 10 {
+		t.Errorf("Expected ağaç_1 to end at column 10, got %d", ident.EndColumn)
+	}
+
+	for _, input := range []string{"x = 1 → 2", "let \xff = 1", "\"\xfe\""} {
+		if _, err := NewLexer(strings.NewReader(input)).Lex(); err == nil {
+			t.Errorf("Expected an error lexing %q", input)
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package parser
 
 import (
+	"berlang/diagnostics"
 	"berlang/frontend/ast"
+	"berlang/trace"
 	"berlang/utils"
 	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
 )
 
 var rules map[utils.TokenType]ParseRule
@@ -16,122 +21,1179 @@ type ParseRule struct {
 	LED ParseFunc
 }
 
+// TokenSource is where the parser gets its tokens from, a lexer.Lexer reading
+// the input as it goes or an already lexed utils.TokenQueue. Next returns an
+// EOF token at the end of the input.
+type TokenSource interface {
+	Next() (utils.Token, error)
+}
+
+// lookahead is a token read past the current one, along with the doc comments
+// right before it.
+type lookahead struct {
+	tok utils.Token
+	doc []string
+}
+
 type Parser struct {
-	tokenStack *utils.TokenQueue
-	curToken   utils.Token
+	tokens   TokenSource
+	curToken utils.Token
+	// buf holds the tokens read ahead of curToken, only as many as the
+	// furthest peek so far needed
+	buf []lookahead
+	// prevEnd is where the last consumed token ended, used to close spans
+	prevEnd utils.Position
+	// loopDepth counts the loops around the current statement so break and
+	// continue outside of one are reported while parsing
+	loopDepth int
+	// funcDepth does the same for return statements and function bodies
+	funcDepth int
+	// braces counts the { consumed so far that no } has closed yet
+	braces int
+	// errs collects every syntax error, parsing carries on after each one
+	errs diagnostics.List
+	// doc holds the doc comments right before the current token, they are
+	// kept out of the grammar and picked up by the declarations they precede
+	doc    []string
+	tracer trace.Tracer
+}
+
+func NewParser(tokens TokenSource) *Parser {
+	p := &Parser{tokens: tokens, tracer: trace.Discard}
+	p.nextToken()
+	return p
+}
+
+// SetTracer makes the parser report every statement it parses to t, inner
+// statements before the ones around them.
+func (p *Parser) SetTracer(t trace.Tracer) {
+	p.tracer = t
+}
+
+func (p *Parser) currentToken() utils.Token {
+	return p.curToken
+}
+
+// nextToken moves to the next token. Lexing errors met on the way are
+// recorded by read, like the syntax errors.
+func (p *Parser) nextToken() {
+	p.prevEnd = utils.Position{Line: p.curToken.EndLine, Column: p.curToken.EndColumn}
+	switch p.curToken.Type {
+	case utils.TOKEN_LBRACE:
+		p.braces++
+	case utils.TOKEN_RBRACE:
+		p.braces--
+	}
+
+	p.fill(1)
+	p.curToken, p.doc = p.buf[0].tok, p.buf[0].doc
+
+	// Shift instead of reslicing so the buffer keeps reusing its array
+	n := copy(p.buf, p.buf[1:])
+	p.buf[n] = lookahead{}
+	p.buf = p.buf[:n]
+}
+
+// peek returns the token k places after the current one, peek(1) being the
+// very next token.
+func (p *Parser) peek(k int) utils.Token {
+	p.fill(k)
+	return p.buf[k-1].tok
+}
+
+// fill reads tokens until k of them are buffered. Once the source has
+// returned EOF it is not asked again, the EOF token is repeated instead.
+func (p *Parser) fill(k int) {
+	for len(p.buf) < k {
+		last := p.curToken
+		if n := len(p.buf); n > 0 {
+			last = p.buf[n-1].tok
+		}
+
+		if last.Type == utils.TOKEN_EOF {
+			p.buf = append(p.buf, lookahead{tok: last})
+		} else {
+			p.buf = append(p.buf, p.read())
+		}
+	}
+}
+
+// read pulls one token from the source, collecting the doc comments before
+// it. Like syntax errors, lexing errors are recorded and do not stop the
+// parse: illegal input is skipped, while a token the lexer could still make
+// sense of, like a string with a bad escape, is kept.
+func (p *Parser) read() lookahead {
+	var doc []string
+	for {
+		tok, err := p.tokens.Next()
+		if diags := diagnostics.From(err); diags != nil {
+			p.errs = append(p.errs, diags...)
+			if tok.Type == utils.TOKEN_ILLEGAL || tok.Type == "" {
+				continue
+			}
+		} else if err != nil {
+			// The source itself failed, end the input here
+			tok = utils.Token{Type: utils.TOKEN_EOF, Line: p.prevEnd.Line, Column: p.prevEnd.Column + 1}
+			tok.EndLine, tok.EndColumn = tok.Line, tok.Column
+			p.errs = append(p.errs, errorAt(tok, "%v", err))
+		}
+
+		if tok.Type == utils.TOKEN_DOC {
+			doc = append(doc, tok.Literal)
+			continue
+		}
+		return lookahead{tok: tok, doc: doc}
+	}
+}
+
+// Parse parses the whole input. When there are syntax errors it still
+// returns the program, with a BadStmt in place of every statement that could
+// not be parsed, along with a diagnostics.List of all the errors.
+func (p *Parser) Parse() (ast.Stmt, error) {
+	program := ast.NewProgram()
+	start := p.pos()
+
+	for p.currentToken().Type != utils.TOKEN_EOF {
+		stmt := p.parseStatementOrRecover()
+
+		// A closing brace without an opening one, there is no block for
+		// it to end so skip it
+		if p.currentToken().Type == utils.TOKEN_RBRACE {
+			if n := len(p.errs); n == 0 || p.errs[n-1].Span.Start != p.pos() {
+				p.errs = append(p.errs, errorAt(p.currentToken(), "Unexpected }"))
+			}
+			p.nextToken()
+		}
+
+		program.Body = append(program.Body, stmt)
+
+		// Skip any semicolons
+		for p.currentToken().Type == utils.TOKEN_SEMI {
+			p.nextToken()
+		}
+	}
+	if len(program.Body) > 0 {
+		program.SetSpan(p.spanFrom(start))
+	}
+
+	if len(p.errs) > 0 {
+		// Lexing errors are found while peeking ahead, put everything back
+		// in source order
+		sort.SliceStable(p.errs, func(i, j int) bool {
+			a, b := p.errs[i].Span.Start, p.errs[j].Span.Start
+			return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+		})
+		return program, p.errs
+	}
+	return program, nil
+}
+
+// parseStatementOrRecover parses a statement. On a syntax error it records
+// the error, skips ahead to where the next statement is likely to start and
+// returns a BadStmt covering what was skipped.
+func (p *Parser) parseStatementOrRecover() ast.Stmt {
+	start := p.pos()
+	open := p.braces
+
+	stmt, err := p.parseStatement()
+	if err == nil {
+		return stmt
+	}
+
+	if diags := diagnostics.From(err); diags != nil {
+		p.errs = append(p.errs, diags...)
+	} else {
+		p.errs = append(p.errs, errorAt(p.currentToken(), "%v", err))
+	}
+
+	// Always move past at least one token so a statement that fails on its
+	// first token can not be retried forever
+	if p.pos() == start && p.currentToken().Type != utils.TOKEN_EOF {
+		p.nextToken()
+	}
+	p.synchronize(open)
+
+	bad := ast.NewBadStmt()
+	bad.SetSpan(p.spanFrom(start))
+	return bad
+}
+
+// synchronize skips tokens until a statement boundary: past a semicolon, or
+// up to a closing brace or a keyword that starts a statement. open is the
+// number of braces that were open when the statement started, the braces
+// the statement opened itself are skipped up to their }, so neither the
+// body of a broken while nor the fields of a broken struct end the
+// enclosing block early.
+func (p *Parser) synchronize(open int) {
+	for {
+		nested := p.braces > open
+		switch p.currentToken().Type {
+		case utils.TOKEN_EOF:
+			return
+		case utils.TOKEN_RBRACE:
+			if !nested {
+				return
+			}
+		case utils.TOKEN_SEMI:
+			if !nested {
+				p.nextToken()
+				return
+			}
+		case utils.TOKEN_LET, utils.TOKEN_CONST, utils.TOKEN_FUNCTION, utils.TOKEN_IF,
+			utils.TOKEN_WHILE, utils.TOKEN_FOR, utils.TOKEN_RETURN,
+			utils.TOKEN_BREAK, utils.TOKEN_CONTINUE, utils.TOKEN_STRUCT, utils.TOKEN_ENUM:
+			if !nested {
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
+// pos returns the position of the current token.
+func (p *Parser) pos() utils.Position {
+	return utils.Position{Line: p.curToken.Line, Column: p.curToken.Column}
+}
+
+// spanFrom returns the span from start to the end of the last consumed token.
+func (p *Parser) spanFrom(start utils.Position) utils.Span {
+	return utils.Span{Start: start, End: p.prevEnd}
+}
+
+func (p *Parser) parseStatement() (ast.Stmt, error) {
+	start := p.pos()
+	doc := strings.Join(p.doc, "\n")
+
+	stmt, err := p.parseStatementAt()
+	if err != nil {
+		return nil, err
+	}
+
+	// Doc comments anywhere else are ignored
+	switch decl := stmt.(type) {
+	case *ast.FunctionDecl:
+		decl.Doc = doc
+	case *ast.VarDecl:
+		decl.Doc = doc
+	case *ast.StructDecl:
+		decl.Doc = doc
+	case *ast.EnumDecl:
+		decl.Doc = doc
+	}
+
+	stmt.SetSpan(p.spanFrom(start))
+	if p.tracer.Enabled(trace.Parser) {
+		p.tracer.Event(trace.Parser, "statement", stmt.GetSpan(), slog.String("node", string(stmt.GetKind())))
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parseStatementAt() (ast.Stmt, error) {
+	switch p.currentToken().Type {
+	case utils.TOKEN_IF:
+		return p.parseIfStatement()
+
+	case utils.TOKEN_LBRACE:
+		if p.atMapLiteral() {
+			return p.parseExpr(0)
+		}
+		return p.parseBlock()
+
+	case utils.TOKEN_WHILE:
+		return p.parseWhileStatement()
+
+	case utils.TOKEN_FOR:
+		return p.parseForStatement()
+
+	case utils.TOKEN_BREAK, utils.TOKEN_CONTINUE:
+		return p.parseLoopControl()
+
+	case utils.TOKEN_LET, utils.TOKEN_CONST:
+		stmt, err := p.parseVariableDeclaration(p.currentToken().Type)
+		if err != nil {
+			return nil, err
+		}
+		return stmt, nil
+
+	case utils.TOKEN_IDENT:
+		if p.peek(1).Type == utils.TOKEN_ASSIGN {
+			// Variable assignment
+			stmt, err := p.parseVariableAssignment()
+			if err != nil {
+				return nil, err
+			}
+			return stmt, nil
+		} else {
+			// Expression statement
+			stmt, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			return stmt, nil
+		}
+
+	case utils.TOKEN_FUNCTION:
+		if p.peek(1).Type == utils.TOKEN_IDENT {
+			return p.parseFunctionDeclaration()
+		}
+		// An anonymous function used as an expression statement
+		return p.parseExpr(0)
+
+	case utils.TOKEN_RETURN:
+		return p.parseReturnStatement()
+
+	case utils.TOKEN_STRUCT:
+		return p.parseStructDeclaration()
+
+	case utils.TOKEN_ENUM:
+		return p.parseEnumDeclaration()
+
+	default:
+		stmt, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+}
+
+// consume checks that the current token has the expected type and moves past it.
+func (p *Parser) consume(expectedType utils.TokenType) (utils.Token, error) {
+	tok := p.currentToken()
+	if tok.Type != expectedType {
+		return tok, unexpected(spell(expectedType), tok)
+	}
+
+	p.nextToken()
+	return tok, nil
+}
+
+// parseBlock parses statements between braces, leaving the parser after the
+// closing brace.
+func (p *Parser) parseBlock() (*ast.BlockStmt, error) {
+	block := ast.NewBlockStmt()
+	start := p.pos()
+
+	if _, err := p.consume(utils.TOKEN_LBRACE); err != nil {
+		return nil, err
+	}
+
+	for p.currentToken().Type != utils.TOKEN_RBRACE {
+		if p.currentToken().Type == utils.TOKEN_SEMI {
+			p.nextToken()
+			continue
+		}
+
+		if p.currentToken().Type == utils.TOKEN_EOF {
+			return nil, unexpected("'}'", p.currentToken())
+		}
+
+		block.Body = append(block.Body, p.parseStatementOrRecover())
+	}
+	p.nextToken()
+
+	block.SetSpan(p.spanFrom(start))
+	return block, nil
+}
+
+// parseParenExpr parses an expression that has to be wrapped in parentheses,
+// like the condition of an if statement.
+func (p *Parser) parseParenExpr() (ast.Expr, error) {
+	if _, err := p.consume(utils.TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+
+	expr, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.consume(utils.TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// parseIfStatement parses if (cond) { ... } with any number of else if
+// branches and an optional final else.
+func (p *Parser) parseIfStatement() (ast.Stmt, error) {
+	start := p.pos()
+	if _, err := p.consume(utils.TOKEN_IF); err != nil {
+		return nil, err
+	}
+
+	condition, err := p.parseParenExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	then, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := ast.NewIfStmt(condition, then, nil)
+	stmt.SetSpan(p.spanFrom(start))
+
+	if p.currentToken().Type != utils.TOKEN_ELSE {
+		return stmt, nil
+	}
+	p.nextToken()
+
+	var otherwise ast.Stmt
+	if p.currentToken().Type == utils.TOKEN_IF {
+		otherwise, err = p.parseIfStatement()
+	} else {
+		otherwise, err = p.parseBlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stmt.Else = otherwise
+	stmt.SetSpan(p.spanFrom(start))
+	return stmt, nil
+}
+
+func (p *Parser) parseWhileStatement() (ast.Stmt, error) {
+	if _, err := p.consume(utils.TOKEN_WHILE); err != nil {
+		return nil, err
+	}
+
+	condition, err := p.parseParenExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewWhileStmt(condition, body), nil
+}
+
+// parseForStatement parses a C style for (init; condition; update) { ... }
+// loop, where each of the three clauses can be left empty, or a
+// for (name in iterable) { ... } loop.
+func (p *Parser) parseForStatement() (ast.Stmt, error) {
+	if _, err := p.consume(utils.TOKEN_FOR); err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(utils.TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+
+	if p.currentToken().Type == utils.TOKEN_IDENT {
+		switch {
+		case p.peek(1).Type == utils.TOKEN_IN,
+			p.peek(1).Type == utils.TOKEN_COMMA && p.peek(2).Type == utils.TOKEN_IDENT && p.peek(3).Type == utils.TOKEN_IN:
+			return p.parseForInStatement()
+		}
+	}
+
+	var init ast.Stmt
+	if p.currentToken().Type != utils.TOKEN_SEMI {
+		var err error
+		if init, err = p.parseStatement(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.consume(utils.TOKEN_SEMI); err != nil {
+		return nil, err
+	}
+
+	var condition ast.Expr
+	if p.currentToken().Type != utils.TOKEN_SEMI {
+		var err error
+		if condition, err = p.parseExpr(0); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.consume(utils.TOKEN_SEMI); err != nil {
+		return nil, err
+	}
+
+	var update ast.Stmt
+	if p.currentToken().Type != utils.TOKEN_RPAREN {
+		var err error
+		if update, err = p.parseStatement(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.consume(utils.TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewForStmt(init, condition, update, body), nil
 }
 
-func NewParser(ts *utils.TokenQueue) *Parser {
-	token, err := ts.Pop()
+// parseForInStatement parses the rest of for (k in m) or for (k, v in m)
+// after the opening parenthesis.
+func (p *Parser) parseForInStatement() (ast.Stmt, error) {
+	names := []string{p.currentToken().Literal}
+	p.nextToken()
+	if p.currentToken().Type == utils.TOKEN_COMMA {
+		p.nextToken()
+		names = append(names, p.currentToken().Literal)
+		p.nextToken()
+	}
+	if _, err := p.consume(utils.TOKEN_IN); err != nil {
+		return nil, err
+	}
+
+	iterable, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(utils.TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewForInStmt(names, iterable, body), nil
+}
+
+func (p *Parser) parseLoopBody() (*ast.BlockStmt, error) {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlock()
+}
+
+func (p *Parser) parseLoopControl() (ast.Stmt, error) {
+	tok := p.currentToken()
+	if p.loopDepth == 0 {
+		return nil, errorAt(tok, "%s outside of a loop", tok.Literal)
+	}
+	p.nextToken()
+
+	if tok.Type == utils.TOKEN_BREAK {
+		return ast.NewBreakStmt(), nil
+	}
+	return ast.NewContinueStmt(), nil
+}
+
+// parseType parses a type annotation and returns its name. Maps are written
+// like their literals, {string: int}.
+func (p *Parser) parseType() (string, error) {
+	var name string
+	if p.currentToken().Type == utils.TOKEN_LBRACE {
+		p.nextToken()
+		key, err := p.parseType()
+		if err != nil {
+			return "", err
+		}
+		if _, err := p.consume(utils.TOKEN_COLON); err != nil {
+			return "", err
+		}
+		value, err := p.parseType()
+		if err != nil {
+			return "", err
+		}
+		if _, err := p.consume(utils.TOKEN_RBRACE); err != nil {
+			return "", err
+		}
+		name = "{" + key + ": " + value + "}"
+	} else if p.currentToken().Type == utils.TOKEN_IDENT {
+		// The name of a struct, the checker knows if it was declared
+		name = p.currentToken().Literal
+		p.nextToken()
+	} else {
+		tok, err := p.consume(utils.TOKEN_TYPE)
+		if err != nil {
+			return "", err
+		}
+		name = tok.Literal
+		if name == "fn" && p.currentToken().Type == utils.TOKEN_LPAREN {
+			if name, err = p.parseFuncType(); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// Every [] after the name makes an array of the type before it
+	for p.currentToken().Type == utils.TOKEN_LBRACKET && p.peek(1).Type == utils.TOKEN_RBRACKET {
+		p.nextToken()
+		p.nextToken()
+		name += "[]"
+	}
+	return name, nil
+}
+
+// parseFuncType parses the signature after fn in fn(int, string): bool. The
+// result type is optional, without it the result is only known at runtime.
+func (p *Parser) parseFuncType() (string, error) {
+	if _, err := p.consume(utils.TOKEN_LPAREN); err != nil {
+		return "", err
+	}
+
+	var params []string
+	for p.currentToken().Type != utils.TOKEN_RPAREN {
+		param, err := p.parseType()
+		if err != nil {
+			return "", err
+		}
+		params = append(params, param)
+		if p.currentToken().Type != utils.TOKEN_COMMA {
+			break
+		}
+		p.nextToken()
+	}
+	if err := p.closeList(utils.TOKEN_RPAREN); err != nil {
+		return "", err
+	}
+
+	name := "fn(" + strings.Join(params, ", ") + ")"
+	if p.currentToken().Type == utils.TOKEN_COLON {
+		p.nextToken()
+		result, err := p.parseType()
+		if err != nil {
+			return "", err
+		}
+		name += ": " + result
+	}
+	return name, nil
+}
+
+// parseStructDeclaration parses struct Name { a: int, b: string }, a
+// trailing comma is allowed.
+func (p *Parser) parseStructDeclaration() (ast.Stmt, error) {
+	if _, err := p.consume(utils.TOKEN_STRUCT); err != nil {
+		return nil, err
+	}
+
+	name, err := p.consume(utils.TOKEN_IDENT)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(utils.TOKEN_LBRACE); err != nil {
+		return nil, err
+	}
+
+	fields, err := p.parseFields(utils.TOKEN_RBRACE)
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewStructDecl(name.Literal, fields), nil
+}
+
+// parseFields parses a comma separated list of name: type up to and
+// including the closing token, a trailing comma is allowed.
+func (p *Parser) parseFields(closing utils.TokenType) ([]ast.Field, error) {
+	fields := make([]ast.Field, 0)
+	for p.currentToken().Type != closing {
+		field, err := p.consume(utils.TOKEN_IDENT)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.consume(utils.TOKEN_COLON); err != nil {
+			return nil, err
+		}
+		fieldType, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, ast.Field{Name: field.Literal, Type: fieldType})
+
+		if p.currentToken().Type != utils.TOKEN_COMMA {
+			break
+		}
+		p.nextToken()
+	}
+
+	if err := p.closeList(closing); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// parseEnumDeclaration parses enum Name { A(x: int), B }, where variants
+// without fields leave out the parentheses.
+func (p *Parser) parseEnumDeclaration() (ast.Stmt, error) {
+	if _, err := p.consume(utils.TOKEN_ENUM); err != nil {
+		return nil, err
+	}
+
+	name, err := p.consume(utils.TOKEN_IDENT)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(utils.TOKEN_LBRACE); err != nil {
+		return nil, err
+	}
+
+	variants := make([]ast.Variant, 0)
+	for p.currentToken().Type != utils.TOKEN_RBRACE {
+		variant, err := p.consume(utils.TOKEN_IDENT)
+		if err != nil {
+			return nil, err
+		}
+
+		var fields []ast.Field
+		if p.currentToken().Type == utils.TOKEN_LPAREN {
+			p.nextToken()
+			if fields, err = p.parseFields(utils.TOKEN_RPAREN); err != nil {
+				return nil, err
+			}
+		}
+		variants = append(variants, ast.Variant{Name: variant.Literal, Fields: fields})
+
+		if p.currentToken().Type != utils.TOKEN_COMMA {
+			break
+		}
+		p.nextToken()
+	}
+
+	if err := p.closeList(utils.TOKEN_RBRACE); err != nil {
+		return nil, err
+	}
+	return ast.NewEnumDecl(name.Literal, variants), nil
+}
+
+// parseMatchExpr parses match (subject) { pattern if guard => body, ... }.
+// The commas between arms are optional after a block body.
+func (p *Parser) parseMatchExpr() (ast.Expr, error) {
+	if _, err := p.consume(utils.TOKEN_MATCH); err != nil {
+		return nil, err
+	}
+
+	subject, err := p.parseParenExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(utils.TOKEN_LBRACE); err != nil {
+		return nil, err
+	}
+
+	arms := make([]ast.MatchArm, 0)
+	for p.currentToken().Type != utils.TOKEN_RBRACE {
+		arm, err := p.parseMatchArm()
+		if err != nil {
+			return nil, err
+		}
+		arms = append(arms, arm)
+
+		if p.currentToken().Type == utils.TOKEN_COMMA {
+			p.nextToken()
+		} else if _, isBlock := arm.Body.(*ast.BlockStmt); !isBlock {
+			break
+		}
+	}
+
+	if _, err := p.consume(utils.TOKEN_RBRACE); err != nil {
+		return nil, err
+	}
+	return ast.NewMatchExpr(subject, arms), nil
+}
+
+func (p *Parser) parseMatchArm() (ast.MatchArm, error) {
+	var arm ast.MatchArm
+
+	pattern, err := p.parsePattern()
+	if err != nil {
+		return arm, err
+	}
+	arm.Pattern = pattern
+
+	if p.currentToken().Type == utils.TOKEN_IF {
+		p.nextToken()
+		if arm.Guard, err = p.parseExpr(0); err != nil {
+			return arm, err
+		}
+	}
+
+	if _, err := p.consume(utils.TOKEN_ARROW); err != nil {
+		return arm, err
+	}
+
+	if p.currentToken().Type == utils.TOKEN_LBRACE && !p.atMapLiteral() {
+		arm.Body, err = p.parseBlock()
+	} else {
+		arm.Body, err = p.parseExpr(0)
+	}
+	return arm, err
+}
+
+// parsePattern parses _, a name to bind, a literal or Enum.Variant with an
+// optional list of patterns for its fields.
+func (p *Parser) parsePattern() (ast.Pattern, error) {
+	start := p.pos()
+	pattern, err := p.parsePatternAt()
+	if err != nil {
+		return nil, err
+	}
+
+	pattern.SetSpan(p.spanFrom(start))
+	return pattern, nil
+}
+
+func (p *Parser) parsePatternAt() (ast.Pattern, error) {
+	tok := p.currentToken()
+	switch tok.Type {
+	case utils.TOKEN_NUMBER, utils.TOKEN_STRING, utils.TOKEN_TRUE, utils.TOKEN_FALSE:
+		value, err := p.parseExpr(precPrefix)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewLiteralPattern(value), nil
+
+	case utils.TOKEN_MINUS:
+		if p.peek(1).Type != utils.TOKEN_NUMBER {
+			return nil, unexpected("pattern", p.peek(1))
+		}
+		value, err := p.parseExpr(precPrefix)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewLiteralPattern(value), nil
+
+	case utils.TOKEN_IDENT:
+		p.nextToken()
+		if tok.Literal == "_" {
+			return ast.NewWildcardPattern(), nil
+		}
+		if p.currentToken().Type != utils.TOKEN_DOT {
+			return ast.NewBindingPattern(tok.Literal), nil
+		}
+		p.nextToken()
+
+		variant, err := p.consume(utils.TOKEN_IDENT)
+		if err != nil {
+			return nil, err
+		}
+
+		var fields []ast.Pattern
+		if p.currentToken().Type == utils.TOKEN_LPAREN {
+			p.nextToken()
+			for p.currentToken().Type != utils.TOKEN_RPAREN {
+				field, err := p.parsePattern()
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, field)
+
+				if p.currentToken().Type != utils.TOKEN_COMMA {
+					break
+				}
+				p.nextToken()
+			}
+			if err := p.closeList(utils.TOKEN_RPAREN); err != nil {
+				return nil, err
+			}
+		}
+		return ast.NewVariantPattern(tok.Literal, variant.Literal, fields), nil
+
+	default:
+		return nil, unexpected("pattern", tok)
+	}
+}
+
+// parseFunctionDeclaration parses def name(a: int, b: int): int { ... } where
+// the return type is optional.
+func (p *Parser) parseFunctionDeclaration() (ast.Stmt, error) {
+	if _, err := p.consume(utils.TOKEN_FUNCTION); err != nil {
+		return nil, err
+	}
+
+	name, err := p.consume(utils.TOKEN_IDENT)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parseFunction(name.Literal)
+}
+
+// parseFunction parses everything after the function name, starting at the
+// opening parenthesis of the parameter list.
+func (p *Parser) parseFunction(name string) (*ast.FunctionDecl, error) {
+	if _, err := p.consume(utils.TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+
+	params := make([]ast.Param, 0)
+	for p.currentToken().Type != utils.TOKEN_RPAREN {
+		if len(params) > 0 {
+			if err := p.listSeparator(utils.TOKEN_RPAREN); err != nil {
+				return nil, err
+			}
+		}
+
+		name, err := p.consume(utils.TOKEN_IDENT)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.consume(utils.TOKEN_COLON); err != nil {
+			return nil, err
+		}
+		paramType, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+
+		params = append(params, ast.Param{Name: name.Literal, Type: paramType})
+	}
+	p.nextToken()
+
+	var returnType string
+	if p.currentToken().Type == utils.TOKEN_COLON {
+		p.nextToken()
+
+		var err error
+		if returnType, err = p.parseType(); err != nil {
+			return nil, err
+		}
+	}
+
+	// break and continue can't cross a function boundary
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	p.funcDepth++
+	defer func() {
+		p.loopDepth = loopDepth
+		p.funcDepth--
+	}()
+
+	body, err := p.parseBlock()
 	if err != nil {
-		panic(fmt.Sprintf("Failed to initialize parser: %v", err))
+		return nil, err
 	}
-	return &Parser{tokenStack: ts, curToken: token}
-}
 
-func (p *Parser) currentToken() utils.Token {
-	return p.curToken
+	return ast.NewFunctionDecl(name, params, returnType, body), nil
 }
 
-func (p *Parser) nextToken() error {
-	token, err := p.tokenStack.Pop()
+func (p *Parser) parseReturnStatement() (ast.Stmt, error) {
+	tok := p.currentToken()
+	if p.funcDepth == 0 {
+		return nil, errorAt(tok, "return outside of a function")
+	}
+	p.nextToken()
+
+	switch p.currentToken().Type {
+	case utils.TOKEN_SEMI, utils.TOKEN_RBRACE, utils.TOKEN_EOF:
+		return ast.NewReturnStmt(nil), nil
+	}
+
+	value, err := p.parseExpr(0)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	p.curToken = token
-	return nil
+	return ast.NewReturnStmt(value), nil
 }
 
-func (p *Parser) Parse() (ast.Stmt, error) {
-	program := ast.NewProgram()
+// parseCallArgs parses the comma separated arguments of a call, the opening
+// parenthesis has already been consumed.
+func (p *Parser) parseCallArgs() ([]ast.Expr, error) {
+	args := make([]ast.Expr, 0)
+	for p.currentToken().Type != utils.TOKEN_RPAREN {
+		if len(args) > 0 {
+			if err := p.listSeparator(utils.TOKEN_RPAREN); err != nil {
+				return nil, err
+			}
+		}
 
-	for p.tokenStack.Len() > 0 && p.currentToken().Type != utils.TOKEN_EOF {
-		stmt, err := p.parseStatement()
+		arg, err := p.parseExpr(0)
 		if err != nil {
 			return nil, err
 		}
+		args = append(args, arg)
+	}
+	p.nextToken()
+
+	return args, nil
+}
 
-		if stmt != nil {
-			program.Body = append(program.Body, stmt)
+// parseIndexOrSlice parses what follows the [ in object[index] and
+// object[start:end], where both slice bounds are optional.
+func (p *Parser) parseIndexOrSlice(object ast.Expr) (ast.Expr, error) {
+	var start ast.Expr
+	if p.currentToken().Type != utils.TOKEN_COLON {
+		var err error
+		if start, err = p.parseExpr(0); err != nil {
+			return nil, err
 		}
+	}
 
-		// Skip any semicolons
-		for p.currentToken().Type == utils.TOKEN_SEMI {
-			if err := p.nextToken(); err != nil {
-				return nil, err
-			}
+	if p.currentToken().Type != utils.TOKEN_COLON {
+		if _, err := p.consume(utils.TOKEN_RBRACKET); err != nil {
+			return nil, err
 		}
+		return ast.NewIndexExpr(object, start), nil
 	}
+	p.nextToken()
 
-	return program, nil
+	var end ast.Expr
+	if p.currentToken().Type != utils.TOKEN_RBRACKET {
+		var err error
+		if end, err = p.parseExpr(0); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.consume(utils.TOKEN_RBRACKET); err != nil {
+		return nil, err
+	}
+	return ast.NewSliceExpr(object, start, end), nil
 }
 
-func (p *Parser) parseStatement() (ast.Expr, error) {
-	switch p.currentToken().Type {
-	case utils.TOKEN_LET, utils.TOKEN_CONST:
-		stmt, err := p.parseVariableDeclaration(p.currentToken().Type)
+// parseArrayLiteral parses [a, b, c], a trailing comma is allowed.
+func (p *Parser) parseArrayLiteral() (ast.Expr, error) {
+	if _, err := p.consume(utils.TOKEN_LBRACKET); err != nil {
+		return nil, err
+	}
+
+	elements := make([]ast.Expr, 0)
+	for p.currentToken().Type != utils.TOKEN_RBRACKET {
+		element, err := p.parseExpr(0)
 		if err != nil {
 			return nil, err
 		}
-		return stmt, nil
+		elements = append(elements, element)
 
-	case utils.TOKEN_IDENT:
-		if token, err := p.peekToken(); err == nil && token.Type == utils.TOKEN_ASSIGN {
-			// Variable assignment
-			stmt, err := p.parseVariableAssignment()
-			if err != nil {
-				return nil, err
-			}
-			return stmt, nil
-		} else {
-			// Expression statement
-			stmt, err := p.parseExpr(0)
-			if err != nil {
-				return nil, err
-			}
-			return stmt, nil
+		if p.currentToken().Type != utils.TOKEN_COMMA {
+			break
 		}
+		p.nextToken()
+	}
 
-	case utils.TOKEN_FUNCTION:
-		// TODO: Implement function parsing
-		return nil, utils.NewParseError(
-			"Function parsing not implemented",
-			string(p.currentToken().Type),
-			float64(p.currentToken().Line),
-			float64(p.currentToken().Column),
-		)
+	if err := p.closeList(utils.TOKEN_RBRACKET); err != nil {
+		return nil, err
+	}
+	return ast.NewArrayLiteral(elements), nil
+}
 
-	default:
-		stmt, err := p.parseExpr(0)
+// atMapLiteral reports whether the { at the start of a statement opens a map
+// literal rather than a block. It does when the first key is a literal or a
+// name followed by a colon, which can not start a statement. An empty {} is
+// a block.
+func (p *Parser) atMapLiteral() bool {
+	i := 1
+	if p.peek(i).Type == utils.TOKEN_MINUS {
+		i++
+	}
+
+	switch p.peek(i).Type {
+	case utils.TOKEN_STRING, utils.TOKEN_NUMBER, utils.TOKEN_TRUE, utils.TOKEN_FALSE, utils.TOKEN_IDENT:
+		return p.peek(i+1).Type == utils.TOKEN_COLON
+	}
+	return false
+}
+
+// parseMapLiteral parses {key: value, ...}, a trailing comma is allowed.
+func (p *Parser) parseMapLiteral() (ast.Expr, error) {
+	if _, err := p.consume(utils.TOKEN_LBRACE); err != nil {
+		return nil, err
+	}
+
+	entries := make([]ast.MapEntry, 0)
+	for p.currentToken().Type != utils.TOKEN_RBRACE {
+		key, err := p.parseExpr(0)
 		if err != nil {
 			return nil, err
 		}
-		return stmt, nil
+		if _, err := p.consume(utils.TOKEN_COLON); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ast.MapEntry{Key: key, Value: value})
+
+		if p.currentToken().Type != utils.TOKEN_COMMA {
+			break
+		}
+		p.nextToken()
+	}
+
+	if err := p.closeList(utils.TOKEN_RBRACE); err != nil {
+		return nil, err
 	}
+	return ast.NewMapLiteral(entries), nil
 }
-func (p *Parser) expectToken(expectedType utils.TokenType) error {
-	if err := p.nextToken(); err != nil {
-		return err
+
+// atStructLiteral reports whether the { after a name starts a struct literal,
+// Name{} or Name{ field: ... }, rather than a block that follows it.
+func (p *Parser) atStructLiteral() bool {
+	if p.currentToken().Type != utils.TOKEN_LBRACE {
+		return false
 	}
+	next := p.peek(1).Type
+	return next == utils.TOKEN_RBRACE || next == utils.TOKEN_IDENT && p.peek(2).Type == utils.TOKEN_COLON
+}
 
-	if p.currentToken().Type != expectedType {
-		return utils.NewParseError(
-			string(expectedType),
-			string(p.currentToken().Type),
-			float64(p.currentToken().Line),
-			float64(p.currentToken().Column),
-		)
+// parseStructLiteral parses the { field: value, ... } after the name of a
+// struct, a trailing comma is allowed.
+func (p *Parser) parseStructLiteral(name string) (ast.Expr, error) {
+	if _, err := p.consume(utils.TOKEN_LBRACE); err != nil {
+		return nil, err
 	}
 
-	return nil
+	fields := make([]ast.FieldValue, 0)
+	for p.currentToken().Type != utils.TOKEN_RBRACE {
+		field, err := p.consume(utils.TOKEN_IDENT)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.consume(utils.TOKEN_COLON); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, ast.FieldValue{Name: field.Literal, Value: value})
+
+		if p.currentToken().Type != utils.TOKEN_COMMA {
+			break
+		}
+		p.nextToken()
+	}
+
+	if err := p.closeList(utils.TOKEN_RBRACE); err != nil {
+		return nil, err
+	}
+	return ast.NewStructLiteral(name, fields), nil
 }
 
-func (p *Parser) peekToken() (*utils.Token, error) {
-	token, err := p.tokenStack.Peek()
+// parseAssignment parses the value of target = value once the = has been
+// consumed. Assignment is right associative, so a[0] = a[1] = 2 assigns
+// both.
+func (p *Parser) parseAssignment(target ast.Expr) (ast.Expr, error) {
+	value, err := p.parseExpr(precAssign - 1)
 	if err != nil {
 		return nil, err
 	}
-	return &token, nil
+
+	switch target := target.(type) {
+	case *ast.IndexExpr:
+		return ast.NewIndexAssign(target.Object, target.Index, value), nil
+	case *ast.FieldExpr:
+		return ast.NewFieldAssign(target.Object, target.Field, value), nil
+	case *ast.Identifier:
+		return ast.NewVarAssign(target.Name, &value), nil
+	default:
+		return nil, diagnostics.Errorf(diagnostics.CodeParse, target.GetSpan(), "cannot assign to %s", target.GetKind())
+	}
+}
+
+func (p *Parser) expectToken(expectedType utils.TokenType) error {
+	p.nextToken()
+
+	if p.currentToken().Type != expectedType {
+		return unexpected(spell(expectedType), p.currentToken())
+	}
+
+	return nil
 }
 
 func (p *Parser) parseVariableAssignment() (ast.Expr, error) {
@@ -153,6 +1215,7 @@ func (p *Parser) parseVariableAssignment() (ast.Expr, error) {
 }
 
 func (p *Parser) parseVariableDeclaration(tokenType utils.TokenType) (ast.Expr, error) {
+	kind := p.currentToken().Literal
 
 	if err := p.expectToken(utils.TOKEN_IDENT); err != nil {
 		return nil, err
@@ -163,68 +1226,125 @@ func (p *Parser) parseVariableDeclaration(tokenType utils.TokenType) (ast.Expr,
 		return nil, err
 	}
 
-	if err := p.expectToken(utils.TOKEN_TYPE); err != nil {
-		return nil, err
-	}
-
-	var vartype string
-	if _, ok := utils.Keywords[p.currentToken().Literal]; ok {
-		vartype = p.currentToken().Literal
+	p.nextToken()
 
+	vartype, err := p.parseType()
+	if err != nil {
+		return nil, err
 	}
 
-	lineEnded := checkLineEnded(p)
-	if lineEnded {
+	if cur := p.currentToken().Type; cur == utils.TOKEN_EOF || cur == utils.TOKEN_SEMI {
 		if tokenType == utils.TOKEN_LET {
-			return ast.NewVarDecl(name, vartype, nil), nil
-		} else {
-			return nil, utils.NewParseError("Unexpected token", string(p.currentToken().Type), float64(p.currentToken().Line), float64(p.currentToken().Column))
+			return ast.NewVarDecl(name, vartype, kind, nil), nil
 		}
+		return nil, errorAt(p.currentToken(), "constant %s must be initialized", name).
+			WithNote("only let declarations can leave out the value")
 	}
 
-	if err := p.expectToken(utils.TOKEN_ASSIGN); err != nil {
+	if _, err := p.consume(utils.TOKEN_ASSIGN); err != nil {
 		return nil, err
 	}
 
-	p.nextToken()
-
 	right, err := p.parseExpr(0)
 	if err != nil {
-		return nil, utils.NewParseError("Unexpected token", string(p.currentToken().Type), float64(p.currentToken().Line), float64(p.currentToken().Column))
+		return nil, err
 	}
 
-	return ast.NewVarDecl(name, vartype, &right), nil
+	return ast.NewVarDecl(name, vartype, kind, &right), nil
 }
 
-func checkLineEnded(p *Parser) bool {
-	currentToken, err := p.peekToken()
-	if err != nil {
-		return false
+// errorAt reports a syntax error spanning tok.
+func errorAt(tok utils.Token, format string, args ...any) *diagnostics.Diagnostic {
+	return diagnostics.Errorf(diagnostics.CodeParse, tok.Span(), format, args...)
+}
+
+// unexpected reports that tok is not what the grammar allows at this point.
+func unexpected(expected string, tok utils.Token) *diagnostics.Diagnostic {
+	return errorAt(tok, "Expected %s, found: %s", expected, describeToken(tok))
+}
+
+// describeToken gives a short human readable name for a token in error messages.
+func describeToken(tok utils.Token) string {
+	switch tok.Type {
+	case utils.TOKEN_EOF:
+		return "end of input"
+	case utils.TOKEN_IDENT, utils.TOKEN_TYPE, utils.TOKEN_NUMBER:
+		return fmt.Sprintf("%s '%s'", spell(tok.Type), tok.Literal)
+	case utils.TOKEN_STRING:
+		return fmt.Sprintf("string %q", tok.Literal)
 	}
+	return fmt.Sprintf("'%s'", tok.Literal)
+}
 
-	if currentToken.Type == utils.TOKEN_EOF || currentToken.Type == utils.TOKEN_SEMI {
-		return true
+// spell names a kind of token in error messages, keywords and punctuation
+// the way they are written in the source.
+func spell(kind utils.TokenType) string {
+	switch kind {
+	case utils.TOKEN_EOF:
+		return "end of input"
+	case utils.TOKEN_IDENT:
+		return "identifier"
+	case utils.TOKEN_TYPE:
+		return "type"
+	case utils.TOKEN_NUMBER:
+		return "number"
+	case utils.TOKEN_STRING:
+		return "string"
 	}
-	return false
 
+	if text, ok := utils.GetKeyByValue(utils.Keywords, kind); ok {
+		return "'" + text + "'"
+	}
+	if text, ok := utils.GetKeyByValue(utils.DoubleCharTokens, kind); ok {
+		return "'" + text + "'"
+	}
+	for ch, single := range utils.SingleCharTokens {
+		if single == kind {
+			return "'" + string(ch) + "'"
+		}
+	}
+	return strings.ToLower(string(kind))
+}
+
+// closeList consumes the token that ends a comma separated list. Anything
+// else in its place is missing either a comma or that token.
+func (p *Parser) closeList(closing utils.TokenType) error {
+	if tok := p.currentToken(); tok.Type != closing {
+		return unexpected("',' or "+spell(closing), tok)
+	}
+	p.nextToken()
+	return nil
+}
+
+// listSeparator consumes the comma before the next element of a list that
+// ends with closing.
+func (p *Parser) listSeparator(closing utils.TokenType) error {
+	if tok := p.currentToken(); tok.Type != utils.TOKEN_COMMA {
+		return unexpected("',' or "+spell(closing), tok)
+	}
+	p.nextToken()
+	return nil
 }
 
+// parseExpr parses an expression whose operators bind tighter than precedence.
+// Every parse function, NUD and LED alike, leaves the parser on the first token
+// after the part it consumed.
 func (p *Parser) parseExpr(precedence int8) (ast.Expr, error) {
 	currentToken := p.currentToken()
 	currentTokenRule := rules[currentToken.Type]
 
+	if currentTokenRule.NUD == nil {
+		return nil, unexpected("expression", currentToken)
+	}
+
+	start := p.pos()
 	lhs, err := currentTokenRule.NUD(p, nil)
 	if err != nil {
 		return nil, err
 	}
+	lhs.SetSpan(p.spanFrom(start))
 
-	if err := p.nextToken(); err != nil ||
-		p.currentToken().Type == utils.TOKEN_EOF ||
-		p.currentToken().Type == utils.TOKEN_SEMI {
-		return lhs, nil
-	}
-
-	for p.tokenStack.Len() > 0 {
+	for {
 		currentToken = p.currentToken()
 		currentTokenRule = rules[currentToken.Type]
 
@@ -232,103 +1352,161 @@ func (p *Parser) parseExpr(precedence int8) (ast.Expr, error) {
 			break
 		}
 
-		if err := p.nextToken(); err != nil {
-			break
-		}
+		p.nextToken()
 
 		lhs, err = currentTokenRule.LED(p, lhs)
 		if err != nil {
 			return nil, err
 		}
+		// An infix expression starts where its left operand does
+		lhs.SetSpan(p.spanFrom(start))
 	}
 
 	return lhs, nil
 }
 
+// Binding powers, from loosest to tightest
+const (
+	precAssign   int8 = 1
+	precOr       int8 = 3
+	precAnd      int8 = 4
+	precEquality int8 = 6
+	precCompare  int8 = 7
+	precSum      int8 = 10
+	precProduct  int8 = 20
+	precPrefix   int8 = 30
+	precCall     int8 = 40
+)
+
+// binaryRule builds the rule for a left associative infix operator.
+func binaryRule(lbp int8, operator string) ParseRule {
+	return ParseRule{
+		LBP: lbp,
+		LED: func(p *Parser, left ast.Expr) (ast.Expr, error) {
+			right, err := p.parseExpr(lbp)
+			if err != nil {
+				return nil, err
+			}
+			return ast.NewBinaryExpr(left, right, operator), nil
+		},
+	}
+}
+
+// prefixRule builds the NUD of a prefix operator like ! or unary -.
+func prefixRule(operator string) ParseFunc {
+	return func(p *Parser, _ ast.Expr) (ast.Expr, error) {
+		p.nextToken()
+		operand, err := p.parseExpr(precPrefix)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewUnaryExpr(operand, operator), nil
+	}
+}
+
 func init() {
 	rules = map[utils.TokenType]ParseRule{
 		utils.TOKEN_NUMBER: {
 			LBP: 0,
 			NUD: func(p *Parser, _ ast.Expr) (ast.Expr, error) {
 				numericLiteral := ast.NewNumericLiteral(p.curToken.Literal)
+				p.nextToken()
 				return numericLiteral, nil
 			},
 		},
-		utils.TOKEN_PLUS: {
-			LBP: 10,
-			// NUD: func(p *Parser, _ ast.Expr) (ast.Expr, error) {
-			// right, err := p.parseStatement(100)
-			// if err != nil {
-			// 	return nil, err
-			// }
-			// TODO add UnaryExpression
-			// return nil, err
-			// },
-			LED: func(p *Parser, left ast.Expr) (ast.Expr, error) {
-
-				right, err := p.parseExpr(10)
-
-				if err != nil {
-					return nil, err
-				}
-				newBinExpr := ast.NewBinaryExpr(left, right, "+")
-				return newBinExpr, nil
+		utils.TOKEN_STRING: {
+			LBP: 0,
+			NUD: func(p *Parser, _ ast.Expr) (ast.Expr, error) {
+				stringLiteral := ast.NewStringLiteral(p.curToken.Literal)
+				p.nextToken()
+				return stringLiteral, nil
 			},
 		},
-		utils.TOKEN_MINUS: {
-			LBP: 10,
-			// NUD: func(p *Parser, _ ast.Expr) (ast.Expr, error) {
-			// 	right, err := p.parseStatement(100)
-			// 	if err != nil {
-			// 		return nil, err
-			// 	}
-			// 	return map[string]ast.Expr{"op": "-", "right": right}, nil
-			// },
+		utils.TOKEN_LBRACKET: {
+			LBP: precCall,
+			NUD: func(p *Parser, _ ast.Expr) (ast.Expr, error) {
+				return p.parseArrayLiteral()
+			},
 			LED: func(p *Parser, left ast.Expr) (ast.Expr, error) {
-				right, err := p.parseExpr(10)
-
-				if err != nil {
-					return nil, err
-				}
-				newBinExpr := ast.NewBinaryExpr(left, right, "-")
-				return newBinExpr, nil
+				return p.parseIndexOrSlice(left)
 			},
 		},
-		utils.TOKEN_MULT: {
-			LBP: 20,
-			NUD: nil,
-			LED: func(p *Parser, left ast.Expr) (ast.Expr, error) {
-				right, err := p.parseExpr(20)
-
+		utils.TOKEN_LBRACE: {
+			LBP: 0,
+			NUD: func(p *Parser, _ ast.Expr) (ast.Expr, error) {
+				return p.parseMapLiteral()
+			},
+		},
+		utils.TOKEN_MATCH: {
+			LBP: 0,
+			NUD: func(p *Parser, _ ast.Expr) (ast.Expr, error) {
+				return p.parseMatchExpr()
+			},
+		},
+		utils.TOKEN_DOT: {
+			LBP: precCall,
+			LED: func(p *Parser, object ast.Expr) (ast.Expr, error) {
+				field, err := p.consume(utils.TOKEN_IDENT)
 				if err != nil {
 					return nil, err
 				}
-				newBinExpr := ast.NewBinaryExpr(left, right, "*")
-				return newBinExpr, nil
+				return ast.NewFieldExpr(object, field.Literal), nil
 			},
 		},
-		utils.TOKEN_DIV: {
-			LBP: 20,
-			NUD: nil,
+		utils.TOKEN_ASSIGN: {
+			LBP: precAssign,
 			LED: func(p *Parser, left ast.Expr) (ast.Expr, error) {
-				right, err := p.parseExpr(20)
-
-				if err != nil {
-					return nil, err
-				}
-				newBinExpr := ast.NewBinaryExpr(left, right, "/")
-				return newBinExpr, nil
+				return p.parseAssignment(left)
+			},
+		},
+		utils.TOKEN_TRUE: {
+			LBP: 0,
+			NUD: func(p *Parser, _ ast.Expr) (ast.Expr, error) {
+				p.nextToken()
+				return ast.NewBooleanLiteral(true), nil
+			},
+		},
+		utils.TOKEN_FALSE: {
+			LBP: 0,
+			NUD: func(p *Parser, _ ast.Expr) (ast.Expr, error) {
+				p.nextToken()
+				return ast.NewBooleanLiteral(false), nil
 			},
 		},
+		utils.TOKEN_PLUS:   binaryRule(precSum, "+"),
+		utils.TOKEN_MINUS:  {LBP: precSum, NUD: prefixRule("-"), LED: binaryRule(precSum, "-").LED},
+		utils.TOKEN_MULT:   binaryRule(precProduct, "*"),
+		utils.TOKEN_DIV:    binaryRule(precProduct, "/"),
+		utils.TOKEN_MOD:    binaryRule(precProduct, "%"),
+		utils.TOKEN_LT:     binaryRule(precCompare, "<"),
+		utils.TOKEN_LTE:    binaryRule(precCompare, "<="),
+		utils.TOKEN_GT:     binaryRule(precCompare, ">"),
+		utils.TOKEN_GTE:    binaryRule(precCompare, ">="),
+		utils.TOKEN_EQ:     binaryRule(precEquality, "=="),
+		utils.TOKEN_NOT_EQ: binaryRule(precEquality, "!="),
+		utils.TOKEN_AND:    binaryRule(precAnd, "&&"),
+		utils.TOKEN_OR:     binaryRule(precOr, "||"),
+		utils.TOKEN_BANG:   {LBP: 0, NUD: prefixRule("!")},
 		utils.TOKEN_IDENT: {
 			LBP: 0,
 			NUD: func(p *Parser, name ast.Expr) (ast.Expr, error) {
 				varname := p.currentToken().Literal
+				p.nextToken()
+				if p.atStructLiteral() {
+					return p.parseStructLiteral(varname)
+				}
 				return ast.NewIdentifier(varname), nil
 			},
 		},
 		utils.TOKEN_LPAREN: {
-			LBP: 0,
+			LBP: precCall,
+			LED: func(p *Parser, callee ast.Expr) (ast.Expr, error) {
+				args, err := p.parseCallArgs()
+				if err != nil {
+					return nil, err
+				}
+				return ast.NewCallExpr(callee, args), nil
+			},
 			NUD: func(p *Parser, _ ast.Expr) (ast.Expr, error) {
 				p.nextToken()
 				expr, err := p.parseExpr(0)
@@ -337,12 +1515,24 @@ func init() {
 				}
 
 				if p.currentToken().Type != utils.TOKEN_RPAREN {
-					return nil, utils.NewParseError(")", p.currentToken().Literal, float64(p.curToken.Line), float64(p.currentToken().Column))
+					return nil, unexpected("')'", p.currentToken())
 				}
+				p.nextToken()
 
 				return expr, nil
 			},
 		},
+		utils.TOKEN_FUNCTION: {
+			LBP: 0,
+			NUD: func(p *Parser, _ ast.Expr) (ast.Expr, error) {
+				p.nextToken()
+				fn, err := p.parseFunction("")
+				if err != nil {
+					return nil, err
+				}
+				return ast.NewFunctionLiteral(fn.Params, fn.ReturnType, fn.Body), nil
+			},
+		},
 		utils.TOKEN_RPAREN: {
 			LBP: 0,
 			NUD: nil,
@@ -1,26 +1,386 @@
 package parser
 
 import (
+	"berlang/diagnostics"
+	"berlang/frontend/ast"
+	"berlang/frontend/lexer"
 	"berlang/utils"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 )
+
 func TestParse(t *testing.T) {
-    tokenStack := utils.NewTokenQueue()
-    // Push tokens in reverse order
-    tokenStack.Push(utils.Token{Type: utils.TOKEN_NUMBER, Literal: "2"})
-    tokenStack.Push(utils.Token{Type: utils.TOKEN_MULT, Literal: "*"})
-    tokenStack.Push(utils.Token{Type: utils.TOKEN_NUMBER, Literal: "5"})
-    tokenStack.Push(utils.Token{Type: utils.TOKEN_PLUS, Literal: "+"})
-    tokenStack.Push(utils.Token{Type: utils.TOKEN_NUMBER, Literal: "3"})
-    tokenStack.Push(utils.Token{Type: utils.TOKEN_PLUS, Literal: "+"})
-    tokenStack.Push(utils.Token{Type: utils.TOKEN_NUMBER, Literal: "3"})
-
-    parser := NewParser(tokenStack)
-    result, err := parser.Parse()
-    if err != nil {
-        t.Fatalf("Parsing error: %v", err)
-    }
-
-    fmt.Printf("Parsed Result: %+v\n", result)
+	tokenStack := utils.NewTokenQueue()
+	// Push tokens in reverse order
+	tokenStack.Push(utils.Token{Type: utils.TOKEN_NUMBER, Literal: "2"})
+	tokenStack.Push(utils.Token{Type: utils.TOKEN_MULT, Literal: "*"})
+	tokenStack.Push(utils.Token{Type: utils.TOKEN_NUMBER, Literal: "5"})
+	tokenStack.Push(utils.Token{Type: utils.TOKEN_PLUS, Literal: "+"})
+	tokenStack.Push(utils.Token{Type: utils.TOKEN_NUMBER, Literal: "3"})
+	tokenStack.Push(utils.Token{Type: utils.TOKEN_PLUS, Literal: "+"})
+	tokenStack.Push(utils.Token{Type: utils.TOKEN_NUMBER, Literal: "3"})
+
+	parser := NewParser(tokenStack)
+	result, err := parser.Parse()
+	if err != nil {
+		t.Fatalf("Parsing error: %v", err)
+	}
+
+	fmt.Printf("Parsed Result: %+v\n", result)
+}
+
+func TestParseBreakOutsideLoop(t *testing.T) {
+	tokenStack := utils.NewTokenQueue()
+	tokenStack.Push(utils.Token{Type: utils.TOKEN_BREAK, Literal: "break", Line: 1, Column: 1})
+
+	parser := NewParser(tokenStack)
+	if _, err := parser.Parse(); err == nil {
+		t.Fatalf("Expected an error for break outside of a loop")
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	tokens, err := lexer.NewLexer(strings.NewReader("let x: int = 1\nx = (x + 20) * 3")).Lex()
+	if err != nil {
+		t.Fatalf("Lexing error: %v", err)
+	}
+
+	result, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatalf("Parsing error: %v", err)
+	}
+
+	program := result.(*ast.Program)
+	if got, expected := program.GetSpan(), span(1, 1, 2, 16); got != expected {
+		t.Errorf("Program: expected span %+v, got %+v", expected, got)
+	}
+
+	decl := program.Body[0]
+	if got, expected := decl.GetSpan(), span(1, 1, 1, 14); got != expected {
+		t.Errorf("VarDecl: expected span %+v, got %+v", expected, got)
+	}
+
+	assign := program.Body[1].(*ast.VarAssign)
+	if got, expected := assign.GetSpan(), span(2, 1, 2, 16); got != expected {
+		t.Errorf("VarAssign: expected span %+v, got %+v", expected, got)
+	}
+
+	product := (*assign.Value).(*ast.BinaryExpr)
+	if got, expected := product.Left.GetSpan(), span(2, 5, 2, 12); got != expected {
+		t.Errorf("Parenthesized expression: expected span %+v, got %+v", expected, got)
+	}
+}
+
+func span(startLine, startCol, endLine, endCol int) utils.Span {
+	return utils.Span{
+		Start: utils.Position{Line: startLine, Column: startCol},
+		End:   utils.Position{Line: endLine, Column: endCol},
+	}
+}
+
+func TestParseRecovery(t *testing.T) {
+	input := `let a: int = 1 +;
+let b: int = 2
+def f(x: int) {
+	let c: int = ) ;
+	return x
+}
+let d: int = * 3
+}
+f(b)`
+
+	tokens, err := lexer.NewLexer(strings.NewReader(input)).Lex()
+	if err != nil {
+		t.Fatalf("Lexing error: %v", err)
+	}
+
+	result, err := NewParser(tokens).Parse()
+
+	var errs diagnostics.List
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected a list of errors, got %v", err)
+	}
+
+	lines := []int{1, 4, 7, 8}
+	if len(errs) != len(lines) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(lines), len(errs), errs)
+	}
+	for i, line := range lines {
+		if errs[i].Span.Start.Line != line {
+			t.Errorf("Expected error %d on line %d, got %v", i, line, errs[i])
+		}
+	}
+
+	program, ok := result.(*ast.Program)
+	if !ok {
+		t.Fatalf("Expected a partial program, got %v", result)
+	}
+
+	kinds := []ast.NodeType{ast.BadStmtType, ast.VarDeclType, ast.FunctionDeclType, ast.BadStmtType, ast.CallExprType}
+	if len(program.Body) != len(kinds) {
+		t.Fatalf("Expected %d statements, got %d", len(kinds), len(program.Body))
+	}
+	for i, kind := range kinds {
+		if program.Body[i].GetKind() != kind {
+			t.Errorf("Expected statement %d to be %s, got %s", i, kind, program.Body[i].GetKind())
+		}
+	}
+
+	body := program.Body[2].(*ast.FunctionDecl).Body.Body
+	if len(body) != 2 || body[0].GetKind() != ast.BadStmtType || body[1].GetKind() != ast.ReturnStmtType {
+		t.Errorf("Expected the function body to recover after the bad declaration, got %+v", body)
+	}
+}
+
+func TestParseDocComments(t *testing.T) {
+	input := `/// The answer.
+const answer: int = 42
+
+/// Adds one to n.
+/// Works on ints only.
+def inc(n: int): int {
+	/// Not attached to anything
+	return n + 1
+}
+inc(answer)`
+
+	tokens, err := lexer.NewLexer(strings.NewReader(input)).Lex()
+	if err != nil {
+		t.Fatalf("Lexing error: %v", err)
+	}
+
+	result, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatalf("Parsing error: %v", err)
+	}
+
+	program := result.(*ast.Program)
+	if doc := program.Body[0].(*ast.VarDecl).Doc; doc != "The answer." {
+		t.Errorf("Unexpected doc on the constant %q", doc)
+	}
+	if doc := program.Body[1].(*ast.FunctionDecl).Doc; doc != "Adds one to n.\nWorks on ints only." {
+		t.Errorf("Unexpected doc on the function %q", doc)
+	}
+}
+
+func TestParseArrays(t *testing.T) {
+	input := "let xs: int[][] = [[1, 2], [],]\nxs[0][1] = xs[1] = 3"
+
+	result, err := NewParser(lexer.NewLexer(strings.NewReader(input))).Parse()
+	if err != nil {
+		t.Fatalf("Parsing error: %v", err)
+	}
+
+	program := result.(*ast.Program)
+	decl := program.Body[0].(*ast.VarDecl)
+	if decl.ValType != "int[][]" {
+		t.Errorf("Expected the type int[][], got %q", decl.ValType)
+	}
+	if lit, ok := (*decl.Value).(*ast.ArrayLiteral); !ok || len(lit.Elements) != 2 {
+		t.Errorf("Expected an array literal with 2 elements, got %+v", *decl.Value)
+	}
+
+	// Assignment is right associative, the value of xs[0][1] is xs[1] = 3
+	assign, ok := program.Body[1].(*ast.IndexAssign)
+	if !ok {
+		t.Fatalf("Expected an index assignment, got %+v", program.Body[1])
+	}
+	if _, ok := assign.Object.(*ast.IndexExpr); !ok {
+		t.Errorf("Expected xs[0] as the object, got %+v", assign.Object)
+	}
+	if _, ok := assign.Value.(*ast.IndexAssign); !ok {
+		t.Errorf("Expected a nested index assignment, got %+v", assign.Value)
+	}
+}
+
+func TestParseMaps(t *testing.T) {
+	input := `let m: {string: int[]}[] = [{"a": [1]}]
+{"b": 2, -1: 3}
+{ m }
+{}
+for (k, v in m[0]) { }`
+
+	result, err := NewParser(lexer.NewLexer(strings.NewReader(input))).Parse()
+	if err != nil {
+		t.Fatalf("Parsing error: %v", err)
+	}
+
+	program := result.(*ast.Program)
+	if decl := program.Body[0].(*ast.VarDecl); decl.ValType != "{string: int[]}[]" {
+		t.Errorf("Expected the type {string: int[]}[], got %q", decl.ValType)
+	}
+
+	// A { at the start of a statement is a map only when a key and a colon
+	// follow it
+	kinds := []ast.NodeType{ast.MapLiteralType, ast.BlockStmtType, ast.BlockStmtType, ast.ForInStmtType}
+	for i, kind := range kinds {
+		if got := program.Body[i+1].GetKind(); got != kind {
+			t.Errorf("Statement %d: expected %s, got %s", i+2, kind, got)
+		}
+	}
+
+	if lit := program.Body[1].(*ast.MapLiteral); len(lit.Entries) != 2 {
+		t.Errorf("Expected 2 entries, got %d", len(lit.Entries))
+	}
+	if loop := program.Body[4].(*ast.ForInStmt); len(loop.Names) != 2 || loop.Names[1] != "v" {
+		t.Errorf("Expected the loop variables k and v, got %v", loop.Names)
+	}
+}
+
+func TestParseStructs(t *testing.T) {
+	input := `/// A point.
+struct Point { x: int, y: float[] }
+let p: Point = Point{ x: 1, y: [] }
+p.y = p.x
+if (p.x > 0) { }`
+
+	result, err := NewParser(lexer.NewLexer(strings.NewReader(input))).Parse()
+	if err != nil {
+		t.Fatalf("Parsing error: %v", err)
+	}
+
+	program := result.(*ast.Program)
+	decl := program.Body[0].(*ast.StructDecl)
+	if decl.Doc != "A point." || len(decl.Fields) != 2 || decl.Fields[1] != (ast.Field{Name: "y", Type: "float[]"}) {
+		t.Errorf("Unexpected struct declaration %+v", decl)
+	}
+
+	if v := program.Body[1].(*ast.VarDecl); v.ValType != "Point" || (*v.Value).GetKind() != ast.StructLiteralType {
+		t.Errorf("Expected a Point built from a struct literal, got %+v", v)
+	}
+	if assign, ok := program.Body[2].(*ast.FieldAssign); !ok || assign.Field != "y" {
+		t.Errorf("Expected an assignment to the field y, got %+v", program.Body[2])
+	}
+
+	// The { after a condition is not a struct literal
+	if _, ok := program.Body[3].(*ast.IfStmt); !ok {
+		t.Errorf("Expected an if statement, got %+v", program.Body[3])
+	}
+}
+
+func TestParseEnumsAndMatch(t *testing.T) {
+	input := `enum Tree { Leaf, Node(left: Tree, value: int, right: Tree) }
+match (t) {
+	Tree.Node(Tree.Leaf, v, _) if v > 0 => { v }
+	-1 => 0,
+	"s" => 1
+}`
+
+	result, err := NewParser(lexer.NewLexer(strings.NewReader(input))).Parse()
+	if err != nil {
+		t.Fatalf("Parsing error: %v", err)
+	}
+
+	program := result.(*ast.Program)
+	decl := program.Body[0].(*ast.EnumDecl)
+	if len(decl.Variants) != 2 || len(decl.Variants[0].Fields) != 0 || len(decl.Variants[1].Fields) != 3 {
+		t.Errorf("Unexpected enum declaration %+v", decl)
+	}
+
+	match := program.Body[1].(*ast.MatchExpr)
+	if len(match.Arms) != 3 {
+		t.Fatalf("Expected 3 arms, got %d", len(match.Arms))
+	}
+
+	first := match.Arms[0]
+	pattern, ok := first.Pattern.(*ast.VariantPattern)
+	if !ok || pattern.Enum != "Tree" || pattern.Variant != "Node" || len(pattern.Fields) != 3 {
+		t.Fatalf("Unexpected pattern %+v", first.Pattern)
+	}
+	if _, ok := pattern.Fields[0].(*ast.VariantPattern); !ok {
+		t.Errorf("Expected a nested variant pattern, got %+v", pattern.Fields[0])
+	}
+	if _, ok := pattern.Fields[1].(*ast.BindingPattern); !ok {
+		t.Errorf("Expected a binding, got %+v", pattern.Fields[1])
+	}
+	if _, ok := pattern.Fields[2].(*ast.WildcardPattern); !ok {
+		t.Errorf("Expected a wildcard, got %+v", pattern.Fields[2])
+	}
+	if first.Guard == nil || first.Body.GetKind() != ast.BlockStmtType {
+		t.Errorf("Expected a guard and a block body, got %+v", first)
+	}
+	if _, ok := match.Arms[1].Pattern.(*ast.LiteralPattern); !ok {
+		t.Errorf("Expected a literal pattern, got %+v", match.Arms[1].Pattern)
+	}
+}
+
+func TestParseFromLexer(t *testing.T) {
+	input := "let a: int = 1 $ 2\nlet s: string = \"\\q\"\na + #"
+
+	result, err := NewParser(lexer.NewLexer(strings.NewReader(input))).Parse()
+
+	var errs diagnostics.List
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected a list of errors, got %v", err)
+	}
+
+	// Lexing errors come in source order with the syntax errors they cause
+	expected := []string{
+		"Unexpected character \"$\"",
+		"Unknown escape sequence \\q",
+		"Unexpected character \"#\"",
+		"Expected expression, found: end of input",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(errs), errs)
+	}
+	for i, msg := range expected {
+		if errs[i].Message != msg {
+			t.Errorf("Error %d: expected %q, got %q", i, msg, errs[i].Message)
+		}
+	}
+
+	// The string with the bad escape is still a string
+	program := result.(*ast.Program)
+	if decl, ok := program.Body[2].(*ast.VarDecl); !ok || (*decl.Value).GetKind() != ast.StringLiteralType {
+		t.Errorf("Expected the string declaration to survive, got %+v", program.Body[2])
+	}
+}
+
+func TestParseErrorMessages(t *testing.T) {
+	tests := map[string][]string{
+		"println(1, 2\nlet a: int = 1":           {"Expected ',' or ')', found: 'let'"},
+		"def f(a: int b: int) { }":               {"Expected ',' or ')', found: identifier 'b'"},
+		"while true { }":                         {"Expected '(', found: 'true'"},
+		"let xs: int[] = [1 2]":                  {"Expected ',' or ']', found: number '2'"},
+		"let s: string = (\"a\"":                 {"Expected ')', found: end of input"},
+		"struct P { x: int y: int }\nlet a: = 1": {"Expected ',' or '}', found: identifier 'y'", "Expected type, found: '='"},
+	}
+
+	for input, expected := range tests {
+		_, err := NewParser(lexer.NewLexer(strings.NewReader(input))).Parse()
+
+		var errs diagnostics.List
+		if !errors.As(err, &errs) || len(errs) != len(expected) {
+			t.Errorf("Parsing %q: expected %d errors, got %v", input, len(expected), err)
+			continue
+		}
+		for i, msg := range expected {
+			if errs[i].Message != msg {
+				t.Errorf("Parsing %q: expected %q, got %q", input, msg, errs[i].Message)
+			}
+		}
+	}
+}
+
+func TestParseFuncType(t *testing.T) {
+	input := "def apply(f: fn(int, {string: int}): bool[], g: fn()): fn(int) { }"
+
+	result, err := NewParser(lexer.NewLexer(strings.NewReader(input))).Parse()
+	if err != nil {
+		t.Fatalf("Parsing error: %v", err)
+	}
+
+	decl := result.(*ast.Program).Body[0].(*ast.FunctionDecl)
+	expected := []string{"fn(int, {string: int}): bool[]", "fn()"}
+	for i, param := range decl.Params {
+		if param.Type != expected[i] {
+			t.Errorf("Expected parameter %d to have the type %s, got %q", i+1, expected[i], param.Type)
+		}
+	}
+	if decl.ReturnType != "fn(int)" {
+		t.Errorf("Expected the return type fn(int), got %q", decl.ReturnType)
+	}
 }
@@ -0,0 +1,338 @@
+// Package resolver works out where every variable of a program lives before
+// it runs. Variables declared at the top level of a program are globals,
+// looked up by name since they outlive the program. Every other variable
+// gets a slot in its scope, and each use of it records how many scopes out
+// it is declared, so the interpreter can reach it without looking names up.
+// The bindings are stored on the nodes, as their ast.Binding.
+package resolver
+
+import (
+	"berlang/diagnostics"
+	"berlang/frontend/ast"
+)
+
+// The scopes are the environments the interpreter creates. A block, a C
+// style for loop and a match arm each get one, a call gets one for the
+// parameters and an iteration of a for-in loop one for the loop variables,
+// both outside the scope of the body.
+type scope struct {
+	parent *scope
+	global bool
+	// slots maps the names declared so far to their slot
+	slots map[string]int
+	// later holds the names declared further down in the scope, using them
+	// before that is an error. They are true for functions, structs and
+	// enums, which the functions of the scope may use early.
+	later map[string]bool
+	// pending holds the uses of names in later that wait for the slot of
+	// their declaration
+	pending []pendingUse
+	// functions counts the functions the scope is nested in
+	functions int
+}
+
+type pendingUse struct {
+	node  ast.BoundNode
+	name  string
+	depth int
+}
+
+type resolver struct {
+	scope     *scope
+	functions int
+	errs      diagnostics.List
+}
+
+// Resolve sets the Binding of every node of a program that names a variable
+// and reports uses before a declaration and names declared twice in the
+// same scope as a diagnostics.List. Names that are declared nowhere are
+// bound as globals, which may be declared by the time the code runs.
+// Parameters and the names of a for-in loop have no node of their own, they
+// take the first slots of their scope in order.
+func Resolve(program ast.Stmt) error {
+	r := &resolver{}
+
+	body := []ast.Stmt{program}
+	if p, ok := program.(*ast.Program); ok {
+		body = p.Body
+	}
+	r.beginScope(body)
+	r.scope.global = true
+	r.statements(body)
+
+	if len(r.errs) > 0 {
+		return r.errs
+	}
+	return nil
+}
+
+func (r *resolver) errorf(node ast.Node, format string, args ...any) {
+	r.errs = append(r.errs, diagnostics.Errorf(diagnostics.CodeResolve, node.GetSpan(), format, args...))
+}
+
+// beginScope opens a scope whose statements are body.
+func (r *resolver) beginScope(body []ast.Stmt) {
+	s := &scope{parent: r.scope, slots: make(map[string]int), later: make(map[string]bool), functions: r.functions}
+	for _, stmt := range body {
+		if name := declaredName(stmt); name != "" {
+			_, isVar := stmt.(*ast.VarDecl)
+			s.later[name] = !isVar
+		}
+	}
+	r.scope = s
+}
+
+func (r *resolver) endScope() {
+	r.scope = r.scope.parent
+}
+
+// declaredName returns the name a statement declares in its scope, if any.
+func declaredName(stmt ast.Stmt) string {
+	switch s := stmt.(type) {
+	case *ast.VarDecl:
+		return s.Name
+	case *ast.FunctionDecl:
+		return s.Name
+	case *ast.StructDecl:
+		return s.Name
+	case *ast.EnumDecl:
+		return s.Name
+	}
+	return ""
+}
+
+// declare adds name to the current scope, reporting errors at the node at.
+// node is nil for parameters and loop variables, which take the next slot
+// without recording it.
+func (r *resolver) declare(node ast.BoundNode, at ast.Node, name string) {
+	s := r.scope
+	if _, found := s.slots[name]; found {
+		r.errorf(at, "'%s' is already declared in this scope", name)
+		return
+	}
+
+	slot := len(s.slots)
+	s.slots[name] = slot
+	delete(s.later, name)
+	if node != nil {
+		node.SetBinding(ast.Binding{Global: s.global, Slot: slot})
+	}
+
+	// The functions above that used name can now be told where it lives
+	pending := s.pending[:0]
+	for _, use := range s.pending {
+		if use.name == name {
+			use.node.SetBinding(ast.Binding{Depth: use.depth, Slot: slot})
+		} else {
+			pending = append(pending, use)
+		}
+	}
+	s.pending = pending
+}
+
+// use binds node to the variable called name that is visible from the
+// current scope.
+func (r *resolver) use(node ast.BoundNode, name string) {
+	depth := 0
+	for s := r.scope; s != nil; s = s.parent {
+		if slot, found := s.slots[name]; found {
+			if s.global {
+				node.SetBinding(ast.Binding{Global: true})
+			} else {
+				node.SetBinding(ast.Binding{Depth: depth, Slot: slot})
+			}
+			return
+		}
+
+		// A function may use a global, or a function, struct or enum of its
+		// own scope, declared after it, as long as it is only called once
+		// that declaration has run
+		if early, later := s.later[name]; later {
+			switch {
+			case r.functions == s.functions || !(s.global || early):
+				r.errorf(node, "'%s' is used before its declaration", name)
+				return
+			case !s.global:
+				s.pending = append(s.pending, pendingUse{node: node, name: name, depth: depth})
+				return
+			}
+		}
+		depth++
+	}
+	node.SetBinding(ast.Binding{Global: true})
+}
+
+func (r *resolver) statements(body []ast.Stmt) {
+	for _, stmt := range body {
+		r.stmt(stmt)
+	}
+}
+
+func (r *resolver) block(b *ast.BlockStmt) {
+	r.beginScope(b.Body)
+	r.statements(b.Body)
+	r.endScope()
+}
+
+func (r *resolver) stmt(stmt ast.Stmt) {
+	switch s := stmt.(type) {
+	case *ast.Program:
+		r.statements(s.Body)
+	case *ast.BlockStmt:
+		r.block(s)
+	case *ast.VarDecl:
+		if s.Value != nil {
+			r.expr(*s.Value)
+		}
+		r.declare(s, s, s.Name)
+	case *ast.FunctionDecl:
+		// Declared before the body so the function can call itself
+		r.declare(s, s, s.Name)
+		r.function(s.Params, s.Body, s)
+	case *ast.StructDecl:
+		r.declare(s, s, s.Name)
+	case *ast.EnumDecl:
+		r.declare(s, s, s.Name)
+	case *ast.IfStmt:
+		r.expr(s.Condition)
+		r.block(s.Then)
+		if s.Else != nil {
+			r.stmt(s.Else)
+		}
+	case *ast.WhileStmt:
+		r.expr(s.Condition)
+		r.block(s.Body)
+	case *ast.ForStmt:
+		r.beginScope(nil)
+		if s.Init != nil {
+			r.stmt(s.Init)
+		}
+		if s.Condition != nil {
+			r.expr(s.Condition)
+		}
+		if s.Update != nil {
+			r.stmt(s.Update)
+		}
+		r.block(s.Body)
+		r.endScope()
+	case *ast.ForInStmt:
+		r.expr(s.Iterable)
+		r.beginScope(nil)
+		for _, name := range s.Names {
+			r.declare(nil, s, name)
+		}
+		r.block(s.Body)
+		r.endScope()
+	case *ast.ReturnStmt:
+		if s.Value != nil {
+			r.expr(s.Value)
+		}
+	case *ast.BreakStmt, *ast.ContinueStmt, *ast.BadStmt:
+	case ast.Expr:
+		r.expr(s)
+	}
+}
+
+// function resolves the parameters and body of a function declared at node.
+func (r *resolver) function(params []ast.Param, body *ast.BlockStmt, node ast.Node) {
+	r.functions++
+	r.beginScope(nil)
+	for _, param := range params {
+		r.declare(nil, node, param.Name)
+	}
+	r.block(body)
+	r.endScope()
+	r.functions--
+}
+
+func (r *resolver) expr(expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		r.use(e, e.Name)
+	case *ast.VarAssign:
+		r.expr(*e.Value)
+		r.use(e, e.Name)
+	case *ast.VarDecl:
+		r.stmt(e)
+	case *ast.NumericLiteral, *ast.StringLiteral, *ast.BooleanLiteral:
+	case *ast.BinaryExpr:
+		r.expr(e.Left)
+		r.expr(e.Right)
+	case *ast.UnaryExpr:
+		r.expr(e.Operand)
+	case *ast.CallExpr:
+		r.expr(e.Callee)
+		r.exprs(e.Args)
+	case *ast.FunctionLiteral:
+		r.function(e.Params, e.Body, e)
+	case *ast.IndexExpr:
+		r.expr(e.Object)
+		r.expr(e.Index)
+	case *ast.SliceExpr:
+		r.expr(e.Object)
+		if e.Start != nil {
+			r.expr(e.Start)
+		}
+		if e.End != nil {
+			r.expr(e.End)
+		}
+	case *ast.IndexAssign:
+		r.expr(e.Object)
+		r.expr(e.Index)
+		r.expr(e.Value)
+	case *ast.ArrayLiteral:
+		r.exprs(e.Elements)
+	case *ast.MapLiteral:
+		for _, entry := range e.Entries {
+			r.expr(entry.Key)
+			r.expr(entry.Value)
+		}
+	case *ast.StructLiteral:
+		r.use(e, e.Name)
+		for _, field := range e.Fields {
+			r.expr(field.Value)
+		}
+	case *ast.FieldExpr:
+		r.expr(e.Object)
+	case *ast.FieldAssign:
+		r.expr(e.Object)
+		r.expr(e.Value)
+	case *ast.MatchExpr:
+		r.matchExpr(e)
+	}
+}
+
+func (r *resolver) exprs(exprs []ast.Expr) {
+	for _, expr := range exprs {
+		r.expr(expr)
+	}
+}
+
+// matchExpr gives every arm a scope with the names its pattern binds, which
+// the guard and the body see.
+func (r *resolver) matchExpr(match *ast.MatchExpr) {
+	r.expr(match.Subject)
+	for _, arm := range match.Arms {
+		r.beginScope(nil)
+		r.pattern(arm.Pattern)
+		if arm.Guard != nil {
+			r.expr(arm.Guard)
+		}
+		r.stmt(arm.Body)
+		r.endScope()
+	}
+}
+
+func (r *resolver) pattern(pattern ast.Pattern) {
+	switch p := pattern.(type) {
+	case *ast.BindingPattern:
+		r.declare(p, p, p.Name)
+	case *ast.LiteralPattern:
+		r.expr(p.Value)
+	case *ast.VariantPattern:
+		r.use(p, p.Enum)
+		for _, field := range p.Fields {
+			r.pattern(field)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package resolver
+
+import (
+	"berlang/frontend/ast"
+	"berlang/frontend/lexer"
+	"berlang/frontend/parser"
+	"strings"
+	"testing"
+)
+
+func parseString(input string, t *testing.T) *ast.Program {
+	t.Helper()
+
+	tokens, err := lexer.NewLexer(strings.NewReader(input)).Lex()
+	if err != nil {
+		t.Fatalf("Error lexing input: %v", err)
+	}
+
+	program, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatalf("Error parsing input: %v", err)
+	}
+	return program.(*ast.Program)
+}
+
+// identifiers returns the bindings of the identifiers in a program, in the
+// order they are resolved.
+func identifiers(t *testing.T, program *ast.Program) ([]string, []ast.Binding) {
+	t.Helper()
+
+	if err := Resolve(program); err != nil {
+		t.Fatalf("Error resolving: %v", err)
+	}
+
+	var names []string
+	var found []ast.Binding
+	var collect func(node ast.Node)
+	collect = func(node ast.Node) {
+		switch n := node.(type) {
+		case *ast.Identifier:
+			names = append(names, n.Name)
+			found = append(found, n.Binding)
+		case *ast.FunctionDecl:
+			collect(n.Body)
+		case *ast.BlockStmt:
+			for _, stmt := range n.Body {
+				collect(stmt)
+			}
+		case *ast.VarDecl:
+			collect(*n.Value)
+		case *ast.BinaryExpr:
+			collect(n.Left)
+			collect(n.Right)
+		case *ast.ForInStmt:
+			collect(n.Iterable)
+			collect(n.Body)
+		case *ast.ReturnStmt:
+			collect(n.Value)
+		}
+	}
+	for _, stmt := range program.Body {
+		collect(stmt)
+	}
+	return names, found
+}
+
+func TestResolveSlots(t *testing.T) {
+	program := parseString(`
+		let g: int = 1
+		def f(a: int, b: int) {
+			let c: int = a + b
+			{
+				let d: int = c + g
+				for (k, v in d) {
+					return k + v + d + b
+				}
+			}
+		}
+	`, t)
+
+	names, found := identifiers(t, program)
+	expected := []struct {
+		name    string
+		binding ast.Binding
+	}{
+		{"a", ast.Binding{Depth: 1, Slot: 0}},
+		{"b", ast.Binding{Depth: 1, Slot: 1}},
+		{"c", ast.Binding{Depth: 1, Slot: 0}},
+		{"g", ast.Binding{Global: true}},
+		{"d", ast.Binding{Depth: 0, Slot: 0}},
+		{"k", ast.Binding{Depth: 1, Slot: 0}},
+		{"v", ast.Binding{Depth: 1, Slot: 1}},
+		{"d", ast.Binding{Depth: 2, Slot: 0}},
+		{"b", ast.Binding{Depth: 4, Slot: 1}},
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected %d identifiers, got %v", len(expected), names)
+	}
+	for i, want := range expected {
+		if names[i] != want.name || found[i] != want.binding {
+			t.Errorf("Identifier %d: expected %s %+v, got %s %+v", i, want.name, want.binding, names[i], found[i])
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	valid := []string{
+		"let x: int = 1\n{ let x: int = 2\n x }",
+		"def f(): int { return g() }\ndef g(): int { return 1 }",
+		"def fact(n: int): int { return fact(n - 1) }",
+		"for (x in [1]) { let y: int = x }\nfor (x in [2]) { let y: int = x }",
+		"missing + 1",
+		"{ def a() { return b() }\n def b() { a() } }",
+		"def f() { def g(): P { return P{ x: h() } }\n def h(): int { return 1 }\n struct P { x: int } }",
+	}
+	for _, input := range valid {
+		if err := Resolve(parseString(input, t)); err != nil {
+			t.Errorf("Unexpected error resolving %q: %v", input, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"x + 1\nlet x: int = 1":                     "'x' is used before its declaration",
+		"{ let x: int = 1\n let x: int = 2 }":       "'x' is already declared in this scope",
+		"struct P { x: int }\nenum P { A }":         "'P' is already declared in this scope",
+		"for (k, k in [1]) { k }":                   "'k' is already declared in this scope",
+		"match (1) { x => { let y: int = y\n y } }": "'y' is used before its declaration",
+		"{ a()\n def a() { } }":                     "'a' is used before its declaration",
+		"{ def a() { return x }\n let x: int = 1 }": "'x' is used before its declaration",
+	}
+	for input, message := range invalid {
+		err := Resolve(parseString(input, t))
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q resolving %q, got %v", message, input, err)
+		}
+	}
+}
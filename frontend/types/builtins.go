@@ -0,0 +1,217 @@
+package types
+
+import "berlang/frontend/ast"
+
+// builtin checks a call to one of the functions the runtime provides and
+// returns the type of the result. Their signatures are generic over the
+// element type, so each one is checked by hand. args holds the types of the
+// already checked arguments.
+type builtin func(c *Checker, call *ast.CallExpr, args []Type) Type
+
+var builtins = map[string]builtin{
+	"len":     checkLen,
+	"push":    checkPush,
+	"pop":     checkPop,
+	"slice":   checkSliceCall,
+	"map":     checkMap,
+	"filter":  checkFilter,
+	"reduce":  checkReduce,
+	"has":     checkHas,
+	"keys":    checkKeys,
+	"values":  checkValues,
+	"delete":  checkDelete,
+	"print":   checkPrint,
+	"println": checkPrint,
+	"printf":  checkPrintf,
+}
+
+// natives are the built-ins that are also values, the runtime defines them
+// as functions that can be stored and passed around. They are declared as
+// fn in the global scope, calls to them are still checked by builtins.
+var natives = []string{"print", "println", "printf"}
+
+// checkArgCount reports a call to a built-in with the wrong number of
+// arguments.
+func (c *Checker) checkArgCount(call *ast.CallExpr, name string, args []Type, n int) bool {
+	if len(args) != n {
+		c.errorf(call, "built-in '%s' expects %d arguments, got %d", name, n, len(args))
+		return false
+	}
+	return true
+}
+
+// checkArrayArg checks that argument i is an array and returns its element
+// type, Any when it is not known.
+func (c *Checker) checkArrayArg(call *ast.CallExpr, name string, args []Type, i int) Type {
+	switch arg := args[i].(type) {
+	case *Array:
+		return arg.Elem
+	default:
+		if arg != Any {
+			c.errorf(call.Args[i], "argument %d of built-in '%s' must be an array, got %s", i+1, name, arg)
+		}
+		return Any
+	}
+}
+
+// checkMapArg checks that argument i is a map and returns its type, with Any
+// for the key and value types when they are not known.
+func (c *Checker) checkMapArg(call *ast.CallExpr, name string, args []Type, i int) *Map {
+	if m, ok := args[i].(*Map); ok {
+		return m
+	}
+	if args[i] != Any {
+		c.errorf(call.Args[i], "argument %d of built-in '%s' must be a map, got %s", i+1, name, args[i])
+	}
+	return &Map{Key: Any, Value: Any}
+}
+
+// checkKeyArg checks the key passed to has and delete.
+func (c *Checker) checkKeyArg(call *ast.CallExpr, name string, args []Type) {
+	m := c.checkMapArg(call, name, args, 0)
+	if !AssignableTo(args[1], m.Key) {
+		c.errorf(call.Args[1], "argument 2 of built-in '%s' must be %s, got %s", name, m.Key, args[1])
+	}
+}
+
+// checkCallback checks that argument i is a function that can be called with
+// params and returns its result type.
+func (c *Checker) checkCallback(call *ast.CallExpr, name string, args []Type, i int, params ...Type) Type {
+	arg := args[i]
+	if arg == Any || arg == AnyFunc {
+		return Any
+	}
+
+	sig, ok := arg.(*Func)
+	if !ok {
+		c.errorf(call.Args[i], "argument %d of built-in '%s' must be a function, got %s", i+1, name, arg)
+		return Any
+	}
+	if len(sig.Params) != len(params) {
+		c.errorf(call.Args[i], "function passed to built-in '%s' must take %d arguments, got %d", name, len(params), len(sig.Params))
+		return sig.Result
+	}
+	for j, param := range params {
+		if !AssignableTo(param, sig.Params[j]) {
+			c.errorf(call.Args[i], "function passed to built-in '%s' must accept %s as argument %d, got %s", name, param, j+1, sig.Params[j])
+		}
+	}
+	return sig.Result
+}
+
+func checkLen(c *Checker, call *ast.CallExpr, args []Type) Type {
+	if c.checkArgCount(call, "len", args, 1) {
+		if arg := args[0]; arg != String && arg != Any && !isArray(arg) && !isMap(arg) {
+			c.errorf(call.Args[0], "argument 1 of built-in 'len' must be a string, an array or a map, got %s", arg)
+		}
+	}
+	return Int
+}
+
+func checkPush(c *Checker, call *ast.CallExpr, args []Type) Type {
+	if c.checkArgCount(call, "push", args, 2) {
+		elem := c.checkArrayArg(call, "push", args, 0)
+		if !AssignableTo(args[1], elem) {
+			c.errorf(call.Args[1], "cannot push %s onto %s", args[1], args[0])
+		}
+	}
+	return None
+}
+
+func checkPop(c *Checker, call *ast.CallExpr, args []Type) Type {
+	if !c.checkArgCount(call, "pop", args, 1) {
+		return Any
+	}
+	return c.checkArrayArg(call, "pop", args, 0)
+}
+
+func checkSliceCall(c *Checker, call *ast.CallExpr, args []Type) Type {
+	if !c.checkArgCount(call, "slice", args, 3) {
+		return Any
+	}
+	c.checkArrayArg(call, "slice", args, 0)
+	for i := 1; i < 3; i++ {
+		if !AssignableTo(args[i], Int) {
+			c.errorf(call.Args[i], "argument %d of built-in 'slice' must be int, got %s", i+1, args[i])
+		}
+	}
+	return args[0]
+}
+
+func checkMap(c *Checker, call *ast.CallExpr, args []Type) Type {
+	if !c.checkArgCount(call, "map", args, 2) {
+		return Any
+	}
+	elem := c.checkArrayArg(call, "map", args, 0)
+	return &Array{Elem: c.checkCallback(call, "map", args, 1, elem)}
+}
+
+func checkFilter(c *Checker, call *ast.CallExpr, args []Type) Type {
+	if !c.checkArgCount(call, "filter", args, 2) {
+		return Any
+	}
+	elem := c.checkArrayArg(call, "filter", args, 0)
+	if result := c.checkCallback(call, "filter", args, 1, elem); !AssignableTo(result, Bool) {
+		c.errorf(call.Args[1], "function passed to built-in 'filter' must return bool, got %s", result)
+	}
+	return args[0]
+}
+
+// checkReduce checks reduce(array, def(acc, elem), initial), the result has
+// the type of the initial value.
+func checkReduce(c *Checker, call *ast.CallExpr, args []Type) Type {
+	if !c.checkArgCount(call, "reduce", args, 3) {
+		return Any
+	}
+	elem := c.checkArrayArg(call, "reduce", args, 0)
+	acc := args[2]
+	if result := c.checkCallback(call, "reduce", args, 1, acc, elem); !AssignableTo(result, acc) {
+		c.errorf(call.Args[1], "function passed to built-in 'reduce' must return %s, got %s", acc, result)
+	}
+	return acc
+}
+
+func checkHas(c *Checker, call *ast.CallExpr, args []Type) Type {
+	if c.checkArgCount(call, "has", args, 2) {
+		c.checkKeyArg(call, "has", args)
+	}
+	return Bool
+}
+
+func checkKeys(c *Checker, call *ast.CallExpr, args []Type) Type {
+	if !c.checkArgCount(call, "keys", args, 1) {
+		return Any
+	}
+	return &Array{Elem: c.checkMapArg(call, "keys", args, 0).Key}
+}
+
+func checkValues(c *Checker, call *ast.CallExpr, args []Type) Type {
+	if !c.checkArgCount(call, "values", args, 1) {
+		return Any
+	}
+	return &Array{Elem: c.checkMapArg(call, "values", args, 0).Value}
+}
+
+func checkDelete(c *Checker, call *ast.CallExpr, args []Type) Type {
+	if c.checkArgCount(call, "delete", args, 2) {
+		c.checkKeyArg(call, "delete", args)
+	}
+	return None
+}
+
+// checkPrint checks print and println, which take any number of arguments
+// of any type.
+func checkPrint(c *Checker, call *ast.CallExpr, args []Type) Type {
+	return None
+}
+
+// checkPrintf checks that printf is given a format string, the arguments
+// after it can have any type.
+func checkPrintf(c *Checker, call *ast.CallExpr, args []Type) Type {
+	if len(args) == 0 {
+		c.errorf(call, "built-in 'printf' expects a format")
+	} else if !AssignableTo(args[0], String) {
+		c.errorf(call.Args[0], "argument 1 of built-in 'printf' must be string, got %s", args[0])
+	}
+	return None
+}
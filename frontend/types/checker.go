@@ -0,0 +1,717 @@
+package types
+
+import (
+	"berlang/diagnostics"
+	"berlang/frontend/ast"
+	"fmt"
+	"slices"
+)
+
+type symbol struct {
+	typ      Type
+	constant bool
+	// native is set for the built-ins declared by NewChecker
+	native bool
+}
+
+type scope struct {
+	parent  *scope
+	symbols map[string]symbol
+	// types holds the structs and enums declared in the scope
+	types map[string]Type
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent, symbols: make(map[string]symbol), types: make(map[string]Type)}
+}
+
+func (s *scope) lookup(name string) (symbol, bool) {
+	for cur := s; cur != nil; cur = cur.parent {
+		if sym, found := cur.symbols[name]; found {
+			return sym, true
+		}
+	}
+	return symbol{}, false
+}
+
+func (s *scope) lookupType(name string) (Type, bool) {
+	for cur := s; cur != nil; cur = cur.parent {
+		if typ, found := cur.types[name]; found {
+			return typ, true
+		}
+	}
+	return nil, false
+}
+
+// Checker walks the AST before it is evaluated and reports values that don't
+// match the declared types, calls with the wrong arguments and identifiers
+// that were never declared.
+type Checker struct {
+	// globals survive between calls to Check, so a REPL can keep using what
+	// earlier inputs declared
+	globals *scope
+	scope   *scope
+	// results is the stack of declared result types of the functions being
+	// checked, the innermost last
+	results []Type
+	// predeclared holds the types of the structs, enums and functions of
+	// the scopes entered so far, declared before their statements are
+	// checked
+	predeclared map[ast.Node]Type
+	errs        diagnostics.List
+}
+
+func NewChecker() *Checker {
+	globals := newScope(nil)
+	for _, name := range natives {
+		globals.symbols[name] = symbol{typ: AnyFunc, constant: true, native: true}
+	}
+	return &Checker{globals: globals}
+}
+
+// Check type checks a program and returns a diagnostics.List when anything is
+// wrong. The top level declarations are only remembered when the check
+// succeeds.
+func (c *Checker) Check(program ast.Stmt) error {
+	if err := c.CheckPending(program); err != nil {
+		return err
+	}
+	c.Commit()
+	return nil
+}
+
+// CheckPending is Check without remembering the top level declarations, for
+// callers that only keep them once the program has also run, with Commit.
+func (c *Checker) CheckPending(program ast.Stmt) error {
+	c.scope = newScope(c.globals)
+	c.results = nil
+	c.predeclared = make(map[ast.Node]Type)
+	c.errs = nil
+
+	c.checkStmt(program)
+	if len(c.errs) > 0 {
+		return c.errs
+	}
+	return nil
+}
+
+// Commit remembers the top level declarations of the program last passed to
+// CheckPending, when it had no errors.
+func (c *Checker) Commit() {
+	if c.scope == nil || len(c.errs) > 0 {
+		return
+	}
+
+	for name, sym := range c.scope.symbols {
+		c.globals.symbols[name] = sym
+	}
+	for name, typ := range c.scope.types {
+		c.globals.types[name] = typ
+	}
+	c.scope = nil
+}
+
+func (c *Checker) errorf(node ast.Node, format string, args ...any) {
+	c.errs = append(c.errs, diagnostics.Errorf(diagnostics.CodeType, node.GetSpan(), format, args...))
+}
+
+func (c *Checker) declare(name string, typ Type, constant bool) {
+	c.scope.symbols[name] = symbol{typ: typ, constant: constant}
+}
+
+// withScope runs fn inside a new child scope.
+func (c *Checker) withScope(fn func()) {
+	parent := c.scope
+	c.scope = newScope(parent)
+	defer func() { c.scope = parent }()
+
+	fn()
+}
+
+func (c *Checker) checkStmt(stmt ast.Stmt) {
+	switch stmt.GetKind() {
+	case ast.ProgramType:
+		body := stmt.(*ast.Program).Body
+		c.predeclare(body)
+		for _, s := range body {
+			c.checkStmt(s)
+		}
+	case ast.BlockStmtType:
+		c.checkBlock(stmt.(*ast.BlockStmt))
+	case ast.VarDeclType:
+		c.checkVarDecl(stmt.(*ast.VarDecl))
+	case ast.VarAssignType:
+		c.checkVarAssign(stmt.(*ast.VarAssign))
+	case ast.IfStmtType:
+		c.checkIfStmt(stmt.(*ast.IfStmt))
+	case ast.WhileStmtType:
+		w := stmt.(*ast.WhileStmt)
+		c.checkCondition(w.Condition, "while")
+		c.checkBlock(w.Body)
+	case ast.ForStmtType:
+		c.checkForStmt(stmt.(*ast.ForStmt))
+	case ast.ForInStmtType:
+		c.checkForInStmt(stmt.(*ast.ForInStmt))
+	case ast.BreakStmtType, ast.ContinueStmtType:
+	case ast.BadStmtType:
+		// The parser has already reported what is wrong with it
+	case ast.FunctionDeclType:
+		c.checkFunctionDecl(stmt.(*ast.FunctionDecl))
+	case ast.StructDeclType:
+		c.checkStructDecl(stmt.(*ast.StructDecl))
+	case ast.EnumDeclType:
+		c.checkEnumDecl(stmt.(*ast.EnumDecl))
+	case ast.ReturnStmtType:
+		c.checkReturnStmt(stmt.(*ast.ReturnStmt))
+	case ast.MatchExprType:
+		// The value of a match used as a statement is dropped, so its arms
+		// may differ
+		c.checkMatchExpr(stmt.(*ast.MatchExpr), false)
+	default:
+		if expr, ok := stmt.(ast.Expr); ok {
+			c.checkExpr(expr)
+			return
+		}
+		c.errorf(stmt, "unrecognized statement %s", stmt.GetKind())
+	}
+}
+
+func (c *Checker) checkBlock(block *ast.BlockStmt) {
+	c.withScope(func() {
+		c.predeclare(block.Body)
+		for _, stmt := range block.Body {
+			c.checkStmt(stmt)
+		}
+	})
+}
+
+// predeclare declares the structs, enums and functions of a scope before
+// any of its statements is checked, so they can use each other whatever
+// order they come in.
+func (c *Checker) predeclare(body []ast.Stmt) {
+	// The types go first, their fields and the signatures can use them
+	for _, stmt := range body {
+		switch decl := stmt.(type) {
+		case *ast.StructDecl:
+			typ := &Struct{Name: decl.Name}
+			c.scope.types[decl.Name] = typ
+			c.predeclared[decl] = typ
+		case *ast.EnumDecl:
+			typ := &Enum{Name: decl.Name}
+			c.scope.types[decl.Name] = typ
+			c.predeclared[decl] = typ
+		}
+	}
+
+	for _, stmt := range body {
+		switch decl := stmt.(type) {
+		case *ast.StructDecl:
+			c.resolveStruct(decl, c.predeclared[decl].(*Struct))
+		case *ast.EnumDecl:
+			c.resolveEnum(decl, c.predeclared[decl].(*Enum))
+		}
+	}
+
+	for _, stmt := range body {
+		if decl, ok := stmt.(*ast.FunctionDecl); ok {
+			sig := c.signature(decl, decl.Params, decl.ReturnType)
+			c.declare(decl.Name, sig, true)
+			c.predeclared[decl] = sig
+		}
+	}
+}
+
+// resolveType turns a type annotation into a Type, reporting unknown names.
+func (c *Checker) resolveType(node ast.Node, name string) Type {
+	typ, ok := FromName(name, c.scope.lookupType)
+	if !ok {
+		c.errorf(node, "unknown type '%s'", name)
+		return Any
+	}
+	return typ
+}
+
+func (c *Checker) checkVarDecl(decl *ast.VarDecl) {
+	declared := c.resolveType(decl, decl.ValType)
+
+	if decl.Value != nil {
+		valueType := c.checkExpr(*decl.Value)
+		if !AssignableTo(valueType, declared) {
+			c.errorf(decl, "cannot assign %s to variable '%s' of type %s", valueType, decl.Name, declared)
+		}
+
+		// A constant fn keeps the signature of its function, so its calls
+		// can be checked. A variable declared fn may hold any function.
+		if sig, ok := valueType.(*Func); ok && declared == AnyFunc && decl.VarType == "const" {
+			declared = sig
+		}
+	}
+
+	c.declare(decl.Name, declared, decl.VarType == "const")
+}
+
+// checkVarAssign checks name = value and returns the type of the value, which
+// is also the type of the assignment used as an expression.
+func (c *Checker) checkVarAssign(assign *ast.VarAssign) Type {
+	valueType := c.checkExpr(*assign.Value)
+
+	sym, found := c.scope.lookup(assign.Name)
+	if !found {
+		c.errorf(assign, "undeclared identifier '%s'", assign.Name)
+		return valueType
+	}
+	if sym.constant {
+		c.errorf(assign, "cannot assign to constant '%s'", assign.Name)
+		return valueType
+	}
+	if !AssignableTo(valueType, sym.typ) {
+		c.errorf(assign, "cannot assign %s to variable '%s' of type %s", valueType, assign.Name, sym.typ)
+	}
+	return valueType
+}
+
+func (c *Checker) checkCondition(cond ast.Expr, what string) {
+	if typ := c.checkExpr(cond); !AssignableTo(typ, Bool) {
+		c.errorf(cond, "condition of %s must be bool, got %s", what, typ)
+	}
+}
+
+func (c *Checker) checkIfStmt(stmt *ast.IfStmt) {
+	c.checkCondition(stmt.Condition, "if")
+	c.checkBlock(stmt.Then)
+	if stmt.Else != nil {
+		c.checkStmt(stmt.Else)
+	}
+}
+
+func (c *Checker) checkForStmt(stmt *ast.ForStmt) {
+	c.withScope(func() {
+		if stmt.Init != nil {
+			c.checkStmt(stmt.Init)
+		}
+		if stmt.Condition != nil {
+			c.checkCondition(stmt.Condition, "for")
+		}
+		if stmt.Update != nil {
+			c.checkStmt(stmt.Update)
+		}
+		c.checkBlock(stmt.Body)
+	})
+}
+
+// checkForInStmt declares the loop variables. A single name gets the keys of
+// a map or the elements of an array or a string, with two names the first
+// one gets the key or the index and the second the value.
+func (c *Checker) checkForInStmt(stmt *ast.ForInStmt) {
+	var key, value Type
+	switch iterable := c.checkExpr(stmt.Iterable); {
+	case isMap(iterable):
+		key, value = iterable.(*Map).Key, iterable.(*Map).Value
+	case isArray(iterable) || iterable == String:
+		key, value = Int, elemType(iterable)
+		if len(stmt.Names) == 1 {
+			key = value
+		}
+	default:
+		if iterable != Any {
+			c.errorf(stmt.Iterable, "cannot iterate over a value of type %s", iterable)
+		}
+		key, value = Any, Any
+	}
+
+	c.withScope(func() {
+		c.declare(stmt.Names[0], key, false)
+		if len(stmt.Names) > 1 {
+			c.declare(stmt.Names[1], value, false)
+		}
+		c.checkBlock(stmt.Body)
+	})
+}
+
+// signature builds the type of a function. Without a declared return type the
+// result is only known at runtime.
+func (c *Checker) signature(node ast.Node, params []ast.Param, returnType string) *Func {
+	sig := &Func{Params: make([]Type, len(params)), Result: Any}
+	for i, param := range params {
+		sig.Params[i] = c.resolveType(node, param.Type)
+	}
+	if returnType != "" {
+		sig.Result = c.resolveType(node, returnType)
+	}
+	return sig
+}
+
+// checkFunctionBody checks the body of the function declared at node, name
+// describes it in errors.
+func (c *Checker) checkFunctionBody(node ast.Node, name string, params []ast.Param, sig *Func, body *ast.BlockStmt) {
+	c.results = append(c.results, sig.Result)
+	defer func() { c.results = c.results[:len(c.results)-1] }()
+
+	c.withScope(func() {
+		for i, param := range params {
+			c.declare(param.Name, sig.Params[i], false)
+		}
+		c.checkBlock(body)
+	})
+
+	// Falling off the end returns none, like a bare return
+	if sig.Result != Any && !returns(body) {
+		c.errorf(node, "missing return, %s must return %s on every path", name, sig.Result)
+	}
+}
+
+// returns reports whether running stmt always ends in a return.
+func returns(stmt ast.Stmt) bool {
+	switch s := stmt.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.BlockStmt:
+		return slices.ContainsFunc(s.Body, returns)
+	case *ast.IfStmt:
+		return s.Else != nil && returns(s.Then) && returns(s.Else)
+	case *ast.MatchExpr:
+		// A match that does not cover every value is an error of its own
+		for _, arm := range s.Arms {
+			if !returns(arm.Body) {
+				return false
+			}
+		}
+		return len(s.Arms) > 0
+	case *ast.WhileStmt:
+		// A loop that never ends can only be left through a return
+		cond, ok := s.Condition.(*ast.BooleanLiteral)
+		return ok && cond.Value && !breaks(s.Body)
+	case *ast.ForStmt:
+		return s.Condition == nil && !breaks(s.Body)
+	}
+	return false
+}
+
+// breaks reports whether stmt contains a break out of the loop around it.
+func breaks(stmt ast.Stmt) bool {
+	switch s := stmt.(type) {
+	case *ast.BreakStmt:
+		return true
+	case *ast.BlockStmt:
+		return slices.ContainsFunc(s.Body, breaks)
+	case *ast.IfStmt:
+		return breaks(s.Then) || s.Else != nil && breaks(s.Else)
+	case *ast.MatchExpr:
+		for _, arm := range s.Arms {
+			if breaks(arm.Body) {
+				return true
+			}
+		}
+	}
+	// The breaks in a nested loop leave that loop
+	return false
+}
+
+func (c *Checker) checkFunctionDecl(decl *ast.FunctionDecl) {
+	sig, ok := c.predeclared[decl].(*Func)
+	if !ok {
+		sig = c.signature(decl, decl.Params, decl.ReturnType)
+	}
+
+	// Declared again in case a variable of the same name came in between
+	c.declare(decl.Name, sig, true)
+	c.checkFunctionBody(decl, fmt.Sprintf("function '%s'", decl.Name), decl.Params, sig, decl.Body)
+}
+
+func (c *Checker) checkReturnStmt(ret *ast.ReturnStmt) {
+	if len(c.results) == 0 {
+		c.errorf(ret, "return outside of a function")
+		return
+	}
+	result := c.results[len(c.results)-1]
+
+	if ret.Value == nil {
+		if result != Any && result != None {
+			c.errorf(ret, "missing return value, expected %s", result)
+		}
+		return
+	}
+
+	if typ := c.checkExpr(ret.Value); !AssignableTo(typ, result) {
+		c.errorf(ret, "cannot return %s from a function returning %s", typ, result)
+	}
+}
+
+func (c *Checker) checkExpr(expr ast.Expr) Type {
+	switch expr.GetKind() {
+	case ast.NumericLiteralType:
+		if expr.(*ast.NumericLiteral).IsFloat() {
+			return Float
+		}
+		return Int
+	case ast.StringLiteralType:
+		return String
+	case ast.BooleanLiteralType:
+		return Bool
+	case ast.IdentifierType:
+		ident := expr.(*ast.Identifier)
+		sym, found := c.scope.lookup(ident.Name)
+		if !found {
+			c.errorf(ident, "undeclared identifier '%s'", ident.Name)
+			return Any
+		}
+		return sym.typ
+	case ast.BinaryExprType:
+		return c.checkBinaryExpr(expr.(*ast.BinaryExpr))
+	case ast.UnaryExprType:
+		return c.checkUnaryExpr(expr.(*ast.UnaryExpr))
+	case ast.CallExprType:
+		return c.checkCallExpr(expr.(*ast.CallExpr))
+	case ast.FunctionLitType:
+		fn := expr.(*ast.FunctionLiteral)
+		sig := c.signature(fn, fn.Params, fn.ReturnType)
+		c.checkFunctionBody(fn, "the function", fn.Params, sig, fn.Body)
+		return sig
+	case ast.IndexExprType:
+		return c.checkIndexExpr(expr.(*ast.IndexExpr))
+	case ast.SliceExprType:
+		se := expr.(*ast.SliceExpr)
+		if se.Start != nil {
+			c.checkIndex(se.Start)
+		}
+		if se.End != nil {
+			c.checkIndex(se.End)
+		}
+		return c.checkIndexable(se.Object, "slice")
+	case ast.ArrayLiteralType:
+		return c.checkArrayLiteral(expr.(*ast.ArrayLiteral))
+	case ast.MapLiteralType:
+		return c.checkMapLiteral(expr.(*ast.MapLiteral))
+	case ast.StructLiteralType:
+		return c.checkStructLiteral(expr.(*ast.StructLiteral))
+	case ast.FieldExprType:
+		fe := expr.(*ast.FieldExpr)
+		if enum := c.enumNamed(fe.Object); enum != nil {
+			return c.checkVariantConstructor(enum, fe)
+		}
+		return c.checkField(c.checkExpr(fe.Object), fe, fe.Field)
+	case ast.MatchExprType:
+		return c.checkMatchExpr(expr.(*ast.MatchExpr), true)
+	case ast.FieldAssignType:
+		return c.checkFieldAssign(expr.(*ast.FieldAssign))
+	case ast.IndexAssignType:
+		return c.checkIndexAssign(expr.(*ast.IndexAssign))
+	case ast.VarAssignType:
+		return c.checkVarAssign(expr.(*ast.VarAssign))
+	default:
+		c.errorf(expr, "unrecognized expression %s", expr.GetKind())
+		return Any
+	}
+}
+
+func (c *Checker) checkBinaryExpr(be *ast.BinaryExpr) Type {
+	lhs := c.checkExpr(be.Left)
+	rhs := c.checkExpr(be.Right)
+
+	switch be.Operator {
+	case "&&", "||":
+		if AssignableTo(lhs, Bool) && AssignableTo(rhs, Bool) {
+			return Bool
+		}
+	case "==", "!=":
+		if !isComparable(lhs) || !isComparable(rhs) {
+			break
+		}
+		if AssignableTo(lhs, rhs) || isNumeric(lhs) && isNumeric(rhs) {
+			return Bool
+		}
+	case "<", "<=", ">", ">=":
+		if lhs == Any || rhs == Any || isNumeric(lhs) && isNumeric(rhs) || lhs == String && rhs == String {
+			return Bool
+		}
+	case "+", "-", "*", "/", "%":
+		if lhs == Any || rhs == Any {
+			return Any
+		}
+		if be.Operator == "+" && lhs == String && rhs == String {
+			return String
+		}
+		if isNumeric(lhs) && isNumeric(rhs) {
+			if lhs == Float || rhs == Float {
+				return Float
+			}
+			return Int
+		}
+	}
+
+	c.errorf(be, "operator %s is not defined for %s and %s", be.Operator, lhs, rhs)
+	return Any
+}
+
+func (c *Checker) checkUnaryExpr(ue *ast.UnaryExpr) Type {
+	operand := c.checkExpr(ue.Operand)
+
+	switch {
+	case operand == Any:
+		return Any
+	case ue.Operator == "!" && operand == Bool:
+		return Bool
+	case ue.Operator == "-" && isNumeric(operand):
+		return operand
+	}
+
+	c.errorf(ue, "operator %s is not defined for %s", ue.Operator, operand)
+	return Any
+}
+
+func (c *Checker) checkCallExpr(call *ast.CallExpr) Type {
+	args := make([]Type, len(call.Args))
+	for i, arg := range call.Args {
+		args[i] = c.checkExpr(arg)
+	}
+
+	// Built-ins can be shadowed by declarations of the same name
+	if ident, ok := call.Callee.(*ast.Identifier); ok {
+		if check, ok := builtins[ident.Name]; ok {
+			if sym, declared := c.scope.lookup(ident.Name); !declared || sym.native {
+				return check(c, call, args)
+			}
+		}
+	}
+
+	callee := c.checkExpr(call.Callee)
+
+	if callee == Any || callee == AnyFunc {
+		return Any
+	}
+
+	sig, ok := callee.(*Func)
+	if !ok {
+		c.errorf(call, "cannot call a value of type %s", callee)
+		return Any
+	}
+
+	name := "function"
+	if ident, ok := call.Callee.(*ast.Identifier); ok {
+		name = fmt.Sprintf("function '%s'", ident.Name)
+	}
+
+	if len(args) != len(sig.Params) {
+		c.errorf(call, "%s expects %d arguments, got %d", name, len(sig.Params), len(args))
+		return sig.Result
+	}
+
+	for i, arg := range args {
+		if !AssignableTo(arg, sig.Params[i]) {
+			c.errorf(call.Args[i], "argument %d of %s must be %s, got %s", i+1, name, sig.Params[i], arg)
+		}
+	}
+	return sig.Result
+}
+
+func (c *Checker) checkIndex(index ast.Expr) {
+	if typ := c.checkExpr(index); !AssignableTo(typ, Int) {
+		c.errorf(index, "index must be int, got %s", typ)
+	}
+}
+
+// checkKey checks a key used to look up or store a value in a map.
+func (c *Checker) checkKey(key ast.Expr, m *Map) {
+	if typ := c.checkExpr(key); !AssignableTo(typ, m.Key) {
+		c.errorf(key, "map key must be %s, got %s", m.Key, typ)
+	}
+}
+
+// checkIndexable checks the object of an index or slice expression, which
+// has to be a string or an array, or a map when it is indexed, and returns
+// its type.
+func (c *Checker) checkIndexable(object ast.Expr, what string) Type {
+	typ := c.checkExpr(object)
+	if typ == String || typ == Any || isArray(typ) || what == "index" && isMap(typ) {
+		return typ
+	}
+
+	c.errorf(object, "cannot %s a value of type %s", what, typ)
+	return Any
+}
+
+// checkIndexExpr checks a[i]. Maps are indexed by their key type, strings
+// and arrays by int.
+func (c *Checker) checkIndexExpr(ie *ast.IndexExpr) Type {
+	object := c.checkIndexable(ie.Object, "index")
+	if m, ok := object.(*Map); ok {
+		c.checkKey(ie.Index, m)
+		return m.Value
+	}
+
+	c.checkIndex(ie.Index)
+	return elemType(object)
+}
+
+// elemType is the type of a single element of a string or an array.
+func elemType(t Type) Type {
+	if array, ok := t.(*Array); ok {
+		return array.Elem
+	}
+	return t
+}
+
+// checkArrayLiteral takes the element type from the first element, the
+// others have to match it. An empty literal fits any array.
+func (c *Checker) checkArrayLiteral(lit *ast.ArrayLiteral) Type {
+	if len(lit.Elements) == 0 {
+		return &Array{Elem: Any}
+	}
+
+	elem := c.checkExpr(lit.Elements[0])
+	for _, element := range lit.Elements[1:] {
+		if typ := c.checkExpr(element); !AssignableTo(typ, elem) {
+			c.errorf(element, "array element must be %s, got %s", elem, typ)
+		}
+	}
+	return &Array{Elem: elem}
+}
+
+// checkMapLiteral takes the key and value types from the first entry like
+// checkArrayLiteral does. An empty literal fits any map.
+func (c *Checker) checkMapLiteral(lit *ast.MapLiteral) Type {
+	if len(lit.Entries) == 0 {
+		return &Map{Key: Any, Value: Any}
+	}
+
+	first := lit.Entries[0]
+	m := &Map{Key: c.checkExpr(first.Key), Value: c.checkExpr(first.Value)}
+	if !IsHashable(m.Key) {
+		c.errorf(first.Key, "a value of type %s can not be used as a map key", m.Key)
+		m.Key = Any
+	}
+
+	for _, entry := range lit.Entries[1:] {
+		c.checkKey(entry.Key, m)
+		if typ := c.checkExpr(entry.Value); !AssignableTo(typ, m.Value) {
+			c.errorf(entry.Value, "map value must be %s, got %s", m.Value, typ)
+		}
+	}
+	return m
+}
+
+func (c *Checker) checkIndexAssign(assign *ast.IndexAssign) Type {
+	object := c.checkExpr(assign.Object)
+	m, _ := object.(*Map)
+	if m != nil {
+		c.checkKey(assign.Index, m)
+	} else {
+		c.checkIndex(assign.Index)
+	}
+	value := c.checkExpr(assign.Value)
+
+	switch {
+	case object == Any:
+	case m != nil:
+		if !AssignableTo(value, m.Value) {
+			c.errorf(assign, "cannot assign %s to an element of %s", value, object)
+		}
+	case isArray(object):
+		if elem := elemType(object); !AssignableTo(value, elem) {
+			c.errorf(assign, "cannot assign %s to an element of %s", value, object)
+		}
+	default:
+		c.errorf(assign.Object, "cannot assign to an index of a value of type %s", object)
+	}
+	return value
+}
@@ -0,0 +1,160 @@
+package types
+
+import (
+	"berlang/diagnostics"
+	"berlang/frontend/ast"
+	"berlang/frontend/lexer"
+	"berlang/frontend/parser"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func parseString(input string, t *testing.T) ast.Stmt {
+	t.Helper()
+
+	tokens, err := lexer.NewLexer(strings.NewReader(input)).Lex()
+	if err != nil {
+		t.Fatalf("Error lexing input: %v", err)
+	}
+
+	program, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatalf("Error parsing input: %v", err)
+	}
+	return program
+}
+
+func TestCheckValid(t *testing.T) {
+	inputs := []string{
+		"let x: int = 5\nx = x * 2",
+		"let f: float = 1.5 * 2\nlet b: bool = f > 2 && !false",
+		`let s: string = "a" + "b"; s[0] + s[1:]`,
+		"def fib(n: int): int { if (n < 2) { return n } return fib(n - 1) + fib(n - 2) }\nlet r: int = fib(10)",
+		"def twice(f: fn, x: int): int { return f(f(x)) }\ntwice(def(x: int): int { return x + 1 }, 1)",
+		"let add: fn = def(a: int, b: int) { return a + b }\nlet n: int = add(1, 2)",
+		"for (let i: int = 0; i < 3; i = i + 1) { while (false) { break } }",
+		"let xs: int[] = [1, 2]\nxs[0] = xs[1] + len(xs)\npush(xs, 3)\nlet ys: int[] = xs[1:]",
+		"let grid: int[][] = [[1], []]\nlet n: int = grid[0][0]",
+		"let m: {string: int} = {\"a\": 1}\nm[\"b\"] = m[\"a\"] + len(m)\nlet ks: string[] = keys(m)\nlet vs: int[] = values(m)",
+		"let m: {int: bool} = {}\nif (has(m, 1)) { delete(m, 1) }",
+		"let n: int = 0\nfor (k, v in {\"a\": 1}) { n = n + v + len(k) }\nfor (i, s in \"ab\") { n = n + i + len(s) }\nfor (x in [1]) { n = n + x }",
+		"struct P { x: int, next: P[] }\nlet p: P = P{ x: 1, next: [] }\npush(p.next, P{ x: 2, next: [] })\np.next[0].x = p.x + 1",
+		"enum S { C(r: float), R(w: float, h: float), E }\nlet a: float = match (S.C(1.0)) { S.C(r) => r, S.R(w, h) if w > h => w, S.R(w, _) => w, S.E => 0.0 }",
+		"enum O { Some(v: bool), None }\nmatch (O.None) { O.Some(true) => 1, O.Some(false) => 2, O.None => 3 }",
+		"match (1) { 1 => \"one\", n => \"other\" }",
+		"match (1) { 1 => \"one\", _ => 2 }\nmatch (true) { true => match (1) { 1 => [1], _ => false }, false => 0 }",
+		"let s: string = match (true) { true => \"y\", false => \"n\" }",
+		"let sq: int[] = map([1, 2], def(x: int): int { return x * x })\nlet sum: int = reduce(sq, def(a: int, x: int): int { return a + x }, 0)",
+		"def sign(x: int): int { if (x > 0) { return 1 } else if (x < 0) { return -1 } else { return 0 } }",
+		"def first(xs: int[]): int { for (x in xs) { return x }\n while (true) { if (true) { return 0 } } }",
+		"def f(b: bool): string { return match (b) { true => \"y\", false => \"n\" } }\ndef g(b: bool): string { match (b) { true => { return \"y\" }, false => { return \"n\" } } }",
+		"def f() { }\nlet h: fn = def(x: int) { x }",
+		"def twice(f: fn(int): int, x: int): int { return f(f(x)) }\nlet inc: fn(int): int = def(x: int): int { return x + 1 }\ntwice(inc, 1)",
+		"let fs: {string: fn(int, {string: int}): bool[]} = {}\nlet g: fn() = def() { }\nlet loose: fn = g\nlet h: fn() = loose\nlet table: fn(int)[] = [def(x: int) { }]",
+		"print(1, \"a\")\nprintln()\nprintf(\"%d %v\\n\", 1, [true])",
+		"let f: fn = def(a: int, b: int): int { return a + b }\nf = def(a: string, b: string): string { return a + b }\nf(\"x\", \"y\")",
+		"let out: fn = println\nout(1, 2)\nmap([1, 2], print)\nlet p: int = 1\ndef printf(x: int): int { return x + p }\nprintf(1) + 1",
+		"def even(n: int): bool { if (n == 0) { return true } return odd(n - 1) }\ndef odd(n: int): bool { if (n == 0) { return false } return even(n - 1) }",
+		"def area(s: Shape): float { return match (s) { Shape.Sq(p) => p.x * p.x, Shape.Dot => 0.0 } }\nenum Shape { Sq(p: Point), Dot }\nstruct Point { x: float }",
+		"def outer(): int { def get(p: P): int { return p.x }\n struct P { x: int }\n return get(P{ x: 3 }) }",
+		"let n: int = 3\nlet x: float = 1.0\nx = n * 1.0 + 2\nlet half: float = x / 2",
+	}
+
+	for _, input := range inputs {
+		if err := NewChecker().Check(parseString(input, t)); err != nil {
+			t.Errorf("Unexpected error checking %q: %v", input, err)
+		}
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		line     int
+		col      int
+	}{
+		{`let x: int = "hello"`, "cannot assign string to variable 'x' of type int", 1, 1},
+		{"let x: int = 1\nx = 1.5", "cannot assign float to variable 'x' of type int", 2, 1},
+		{"y + 1", "undeclared identifier 'y'", 1, 1},
+		{"const c: int = 1\nc = 2", "cannot assign to constant 'c'", 2, 1},
+		{"def f(a: int): int { return a }\nf(1, 2)", "function 'f' expects 1 arguments, got 2", 2, 1},
+		{"def f(a: int): int { return a }\nf(true)", "argument 1 of function 'f' must be int, got bool", 2, 3},
+		{"def f(): int { return \"no\" }", "cannot return string from a function returning int", 1, 16},
+		{"if (1) { }", "condition of if must be bool, got int", 1, 5},
+		{`1 + "a"`, "operator + is not defined for int and string", 1, 1},
+		{"let x: int = 1\nx(2)", "cannot call a value of type int", 2, 1},
+		{"if (true) { let inner: int = 1 }\ninner", "undeclared identifier 'inner'", 2, 1},
+		{"let xs: int[] = [1, true]", "array element must be int, got bool", 1, 21},
+		{"let xs: int[] = [1.5]", "cannot assign float[] to variable 'xs' of type int[]", 1, 1},
+		{"let xs: int[] = [1]\nxs[0] = \"a\"", "cannot assign string to an element of int[]", 2, 1},
+		{`let m: {string: int} = {"a": 1, 2: 3}`, "map key must be string, got int", 1, 33},
+		{`let m: {string: int} = {"a": 1}` + "\nm[\"b\"] = true", "cannot assign bool to an element of {string: int}", 2, 1},
+		{"let m: {int[]: int} = {}", "unknown type '{int[]: int}'", 1, 1},
+		{"for (x in 1) { }", "cannot iterate over a value of type int", 1, 11},
+		{`{"a": 1}[1:]`, "cannot slice a value of type {string: int}", 1, 1},
+		{"struct P { x: int }\nlet p: P = P{ x: true }", "field 'x' of P must be int, got bool", 2, 18},
+		{"struct P { x: int, y: int }\nP{ x: 1 }", "missing field 'y' in P literal", 2, 1},
+		{"struct P { x: int }\nP{ x: 1, z: 2 }", "struct P has no field 'z'", 2, 13},
+		{"struct P { x: int }\nlet p: P = P{ x: 1 }\np.x = \"s\"", "cannot assign string to field 'x' of type int", 3, 1},
+		{"struct P { x: int }\nstruct Q { x: int }\nlet p: P = Q{ x: 1 }", "cannot assign Q to variable 'p' of type P", 3, 1},
+		{"let n: int = 1\nn.x", "a value of type int has no fields", 2, 1},
+		{"let p: Nope = 1", "unknown type 'Nope'", 1, 1},
+		{"enum S { A, B }\nmatch (S.A) { S.A => 1 }", "match on S is not exhaustive, missing S.B", 2, 1},
+		{"enum O { Some(v: bool), None }\nmatch (O.None) { O.Some(true) => 1, O.None => 2 }", "match on O is not exhaustive, missing O.Some", 2, 1},
+		{"enum S { A, B }\nmatch (S.A) { S.A => 1, S.B if false => 2 }", "match on S is not exhaustive, missing S.B", 2, 1},
+		{"match (1) { 1 => 1 }", "match on int is not exhaustive, add a _ arm for the other values", 1, 1},
+		{"enum S { A }\nmatch (1) { S.A => 1, _ => 2 }", "a S pattern can not match a value of type int", 2, 13},
+		{"enum S { A(x: int) }\nmatch (S.A(1)) { S.A(x, y) => 1 }", "variant S.A has 1 fields, the pattern has 2", 2, 18},
+		{"println = print", "cannot assign to constant 'println'", 1, 1},
+		{"printf(1)", "argument 1 of built-in 'printf' must be string, got int", 1, 8},
+		{"let x: int = match (1) { 1 => \"a\", _ => 2 }", "match arm has type int, the arms before it have type string", 1, 41},
+		{"def f(b: bool): int { return match (b) { true => 1, false => 1.5 } }", "match arm has type float, the arms before it have type int", 1, 62},
+		{"enum S { A(x: int) }\nS.A(true)", "argument 1 of function must be int, got bool", 2, 5},
+		{"enum S { A }\nS.B", "enum S has no variant 'B'", 2, 1},
+		{"push(1, 2)", "argument 1 of built-in 'push' must be an array, got int", 1, 6},
+		{"def f(): int { }", "missing return, function 'f' must return int on every path", 1, 1},
+		{"def f(x: int): int { if (x > 0) { return 1 } }", "missing return, function 'f' must return int on every path", 1, 1},
+		{"def f(): int { while (true) { break } }", "missing return, function 'f' must return int on every path", 1, 1},
+		{"let f: fn = def(): bool { for (x in [1]) { return true } }", "missing return, the function must return bool on every path", 1, 13},
+		{"const f: fn = def(x: int): int { return x }\nf(\"s\")", "argument 1 of function 'f' must be int, got string", 2, 3},
+		{"let f: fn(int): int = def(x: int): int { return x }\nf = def(s: string): int { return 1 }", "cannot assign fn(string): int to variable 'f' of type fn(int): int", 2, 1},
+		{"def twice(f: fn(int): int): int { return f() }", "function 'f' expects 1 arguments, got 0", 1, 42},
+		{"let f: fn(int): bool = def(x: int): int { return x }", "cannot assign fn(int): int to variable 'f' of type fn(int): bool", 1, 1},
+		{"let f: fn(nope) = def() { }", "unknown type 'fn(nope)'", 1, 1},
+		{"let x: float = 1", "cannot assign int to variable 'x' of type float", 1, 1},
+		{"def f(x: float): float { return x }\nf(1)", "argument 1 of function 'f' must be float, got int", 2, 3},
+		{"def f(): float { return 1 }", "cannot return int from a function returning float", 1, 18},
+	}
+
+	for _, test := range tests {
+		err := NewChecker().Check(parseString(test.input, t))
+
+		var errs diagnostics.List
+		if !errors.As(err, &errs) || len(errs) != 1 {
+			t.Errorf("Expected one error checking %q, got %v", test.input, err)
+			continue
+		}
+		if errs[0].Message != test.expected || errs[0].Span.Start.Line != test.line || errs[0].Span.Start.Column != test.col {
+			t.Errorf("Checking %q: expected %q at %d:%d, got %q at %d:%d", test.input,
+				test.expected, test.line, test.col, errs[0].Message, errs[0].Span.Start.Line, errs[0].Span.Start.Column)
+		}
+	}
+}
+
+func TestCheckKeepsGlobals(t *testing.T) {
+	checker := NewChecker()
+	if err := checker.Check(parseString("let x: int = 1", t)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := checker.Check(parseString("x = x + 1", t)); err != nil {
+		t.Fatalf("Expected x to be remembered between checks: %v", err)
+	}
+
+	// Nothing from a failed check is remembered
+	checker.Check(parseString("let y: int = 1\ny = true", t))
+	if err := checker.Check(parseString("y", t)); err == nil {
+		t.Fatalf("Expected y to be undeclared")
+	}
+}
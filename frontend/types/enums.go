@@ -0,0 +1,342 @@
+package types
+
+import (
+	"berlang/frontend/ast"
+	"strconv"
+	"strings"
+)
+
+// checkEnumDecl declares an enum that was not predeclared with its scope.
+func (c *Checker) checkEnumDecl(decl *ast.EnumDecl) {
+	if _, ok := c.predeclared[decl]; ok {
+		return
+	}
+	typ := &Enum{Name: decl.Name}
+	c.scope.types[decl.Name] = typ
+	c.resolveEnum(decl, typ)
+}
+
+// resolveEnum resolves the variants of an enum once it is declared, so a
+// variant can hold the enum itself, as in a linked list.
+func (c *Checker) resolveEnum(decl *ast.EnumDecl, typ *Enum) {
+	for _, variant := range decl.Variants {
+		if typ.Variant(variant.Name) >= 0 {
+			c.errorf(decl, "variant '%s' is declared twice in enum %s", variant.Name, decl.Name)
+			continue
+		}
+
+		v := EnumVariant{Name: variant.Name}
+		for _, field := range variant.Fields {
+			v.Fields = append(v.Fields, Field{Name: field.Name, Type: c.resolveType(decl, field.Type)})
+		}
+		typ.Variants = append(typ.Variants, v)
+	}
+}
+
+// enumNamed returns the enum an expression names, when it is the name of an
+// enum that no variable shadows.
+func (c *Checker) enumNamed(expr ast.Expr) *Enum {
+	ident, ok := expr.(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+	if _, declared := c.scope.lookup(ident.Name); declared {
+		return nil
+	}
+
+	typ, _ := c.scope.lookupType(ident.Name)
+	enum, _ := typ.(*Enum)
+	return enum
+}
+
+// checkVariantConstructor checks Enum.Variant. A variant with fields is a
+// function that builds the value, one without is the value itself.
+func (c *Checker) checkVariantConstructor(enum *Enum, fe *ast.FieldExpr) Type {
+	i := enum.Variant(fe.Field)
+	if i < 0 {
+		c.errorf(fe, "enum %s has no variant '%s'", enum.Name, fe.Field)
+		return Any
+	}
+
+	variant := enum.Variants[i]
+	if len(variant.Fields) == 0 {
+		return enum
+	}
+
+	sig := &Func{Result: enum}
+	for _, field := range variant.Fields {
+		sig.Params = append(sig.Params, field.Type)
+	}
+	return sig
+}
+
+// checkMatchExpr checks every arm in its own scope with the names bound by
+// its pattern. The match has the type of its arms, when its value is used
+// they must all agree.
+func (c *Checker) checkMatchExpr(match *ast.MatchExpr, used bool) Type {
+	subject := c.checkExpr(match.Subject)
+
+	var result Type
+	disagree := false
+	for i, arm := range match.Arms {
+		c.withScope(func() {
+			c.checkPattern(arm.Pattern, subject)
+			if arm.Guard != nil {
+				c.checkCondition(arm.Guard, "match guard")
+			}
+
+			var typ Type
+			if _, ok := arm.Body.(*ast.BlockStmt); ok || !used {
+				c.checkStmt(arm.Body)
+				typ = Any
+			} else {
+				typ = c.checkExpr(arm.Body.(ast.Expr))
+			}
+
+			switch {
+			case i == 0:
+				result = typ
+			case disagree:
+			case !AssignableTo(typ, result) || !AssignableTo(result, typ):
+				c.errorf(arm.Body, "match arm has type %s, the arms before it have type %s", typ, result)
+				disagree = true
+			}
+		})
+	}
+
+	c.checkExhaustive(match, subject)
+	switch {
+	case result == nil:
+		return None
+	case disagree:
+		return Any
+	}
+	return result
+}
+
+// checkPattern checks that a pattern can match a value of type t and
+// declares the names it binds.
+func (c *Checker) checkPattern(pattern ast.Pattern, t Type) {
+	switch p := pattern.(type) {
+	case *ast.WildcardPattern:
+	case *ast.BindingPattern:
+		c.declare(p.Name, t, false)
+
+	case *ast.LiteralPattern:
+		typ := c.checkExpr(p.Value)
+		if !AssignableTo(typ, t) && !(isNumeric(typ) && isNumeric(t)) {
+			c.errorf(p, "a %s pattern can not match a value of type %s", typ, t)
+		}
+
+	case *ast.VariantPattern:
+		enum := c.patternEnum(p)
+		if enum == nil {
+			c.bindAny(p.Fields)
+			return
+		}
+		if t != Any && t != enum {
+			c.errorf(p, "a %s pattern can not match a value of type %s", enum, t)
+		}
+
+		i := enum.Variant(p.Variant)
+		if i < 0 {
+			c.errorf(p, "enum %s has no variant '%s'", enum.Name, p.Variant)
+			c.bindAny(p.Fields)
+			return
+		}
+
+		fields := enum.Variants[i].Fields
+		if len(p.Fields) != len(fields) {
+			c.errorf(p, "variant %s.%s has %d fields, the pattern has %d", enum.Name, p.Variant, len(fields), len(p.Fields))
+			c.bindAny(p.Fields)
+			return
+		}
+		for j, field := range p.Fields {
+			c.checkPattern(field, fields[j].Type)
+		}
+	}
+}
+
+// patternEnum looks up the enum named by a variant pattern.
+func (c *Checker) patternEnum(p *ast.VariantPattern) *Enum {
+	typ, _ := c.scope.lookupType(p.Enum)
+	enum, ok := typ.(*Enum)
+	if !ok {
+		c.errorf(p, "unknown enum '%s'", p.Enum)
+		return nil
+	}
+	return enum
+}
+
+// bindAny declares the names bound by patterns that could not be checked, so
+// the arm does not report them as undeclared as well.
+func (c *Checker) bindAny(patterns []ast.Pattern) {
+	for _, pattern := range patterns {
+		c.checkPattern(pattern, Any)
+	}
+}
+
+// checkExhaustive reports a match that has no arm for some values of the
+// subject. Arms with a guard might not match, so they are left out.
+func (c *Checker) checkExhaustive(match *ast.MatchExpr, subject Type) {
+	var rows [][]ast.Pattern
+	for _, arm := range match.Arms {
+		if arm.Guard == nil {
+			rows = append(rows, []ast.Pattern{arm.Pattern})
+		}
+	}
+
+	col := c.columnType(rows, 0, subject)
+	var missing []string
+	switch t := col.(type) {
+	case *Enum:
+		for i, variant := range t.Variants {
+			if !c.covers(specializeVariant(rows, t, i), variantColumns(t, i, nil)) {
+				missing = append(missing, t.Name+"."+variant.Name)
+			}
+		}
+	default:
+		if col == Bool {
+			for _, b := range []bool{true, false} {
+				if !c.covers(specializeBool(rows, b), nil) {
+					missing = append(missing, strconv.FormatBool(b))
+				}
+			}
+		} else if !c.covers(defaultRows(rows), nil) {
+			c.errorf(match, "match on %s is not exhaustive, add a _ arm for the other values", subject)
+			return
+		}
+	}
+
+	if len(missing) > 0 {
+		c.errorf(match, "match on %s is not exhaustive, missing %s", col, strings.Join(missing, ", "))
+	}
+}
+
+// covers reports whether the rows of patterns match every combination of
+// values of the column types. It splits the first column by the variants of
+// its type, the values of an enum or a bool, and checks each part on its own.
+// Other types have too many values to list, so only the rows that match
+// anything in the first column count.
+func (c *Checker) covers(rows [][]ast.Pattern, cols []Type) bool {
+	if len(cols) == 0 {
+		return len(rows) > 0
+	}
+
+	switch t := c.columnType(rows, 0, cols[0]).(type) {
+	case *Enum:
+		for i := range t.Variants {
+			if !c.covers(specializeVariant(rows, t, i), variantColumns(t, i, cols[1:])) {
+				return false
+			}
+		}
+		return true
+	default:
+		if t == Bool {
+			return c.covers(specializeBool(rows, true), cols[1:]) && c.covers(specializeBool(rows, false), cols[1:])
+		}
+		return c.covers(defaultRows(rows), cols[1:])
+	}
+}
+
+// columnType is the type of the values in column i. When it is not known
+// statically it is taken from the patterns, a variant pattern tells which
+// enum the values are.
+func (c *Checker) columnType(rows [][]ast.Pattern, i int, t Type) Type {
+	if t != Any {
+		return t
+	}
+	for _, row := range rows {
+		if p, ok := row[i].(*ast.VariantPattern); ok {
+			if typ, _ := c.scope.lookupType(p.Enum); typ != nil {
+				return typ
+			}
+		}
+	}
+	return Any
+}
+
+// variantColumns returns the types of the fields of a variant followed by the
+// rest of the columns.
+func variantColumns(enum *Enum, i int, rest []Type) []Type {
+	cols := make([]Type, 0, len(enum.Variants[i].Fields)+len(rest))
+	for _, field := range enum.Variants[i].Fields {
+		cols = append(cols, field.Type)
+	}
+	return append(cols, rest...)
+}
+
+func matchesAnything(p ast.Pattern) bool {
+	switch p.(type) {
+	case *ast.WildcardPattern, *ast.BindingPattern:
+		return true
+	}
+	return false
+}
+
+// specializeVariant keeps the rows that can match variant i of enum and
+// replaces their first pattern by the patterns for the fields of the variant.
+func specializeVariant(rows [][]ast.Pattern, enum *Enum, i int) [][]ast.Pattern {
+	variant := enum.Variants[i]
+
+	var result [][]ast.Pattern
+	for _, row := range rows {
+		var fields []ast.Pattern
+		switch p := row[0].(type) {
+		case *ast.VariantPattern:
+			if p.Enum != enum.Name || p.Variant != variant.Name {
+				continue
+			}
+			// A pattern with the wrong number of fields has been reported
+			// already, it counts as covering the variant
+			fields = p.Fields
+			if len(fields) != len(variant.Fields) {
+				fields = wildcards(len(variant.Fields))
+			}
+		default:
+			if !matchesAnything(p) {
+				continue
+			}
+			fields = wildcards(len(variant.Fields))
+		}
+		result = append(result, append(append([]ast.Pattern(nil), fields...), row[1:]...))
+	}
+	return result
+}
+
+func wildcards(n int) []ast.Pattern {
+	patterns := make([]ast.Pattern, n)
+	for i := range patterns {
+		patterns[i] = ast.NewWildcardPattern()
+	}
+	return patterns
+}
+
+// specializeBool keeps the rows that can match b and drops their first
+// pattern.
+func specializeBool(rows [][]ast.Pattern, b bool) [][]ast.Pattern {
+	var result [][]ast.Pattern
+	for _, row := range rows {
+		if lit, ok := row[0].(*ast.LiteralPattern); ok {
+			if value, ok := lit.Value.(*ast.BooleanLiteral); !ok || value.Value != b {
+				continue
+			}
+		} else if !matchesAnything(row[0]) {
+			continue
+		}
+		result = append(result, row[1:])
+	}
+	return result
+}
+
+// defaultRows keeps the rows whose first pattern matches anything and drops
+// that pattern.
+func defaultRows(rows [][]ast.Pattern) [][]ast.Pattern {
+	var result [][]ast.Pattern
+	for _, row := range rows {
+		if matchesAnything(row[0]) {
+			result = append(result, row[1:])
+		}
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+package types
+
+import "berlang/frontend/ast"
+
+// checkStructDecl declares a struct that was not predeclared with its
+// scope.
+func (c *Checker) checkStructDecl(decl *ast.StructDecl) {
+	if _, ok := c.predeclared[decl]; ok {
+		return
+	}
+	typ := &Struct{Name: decl.Name}
+	c.scope.types[decl.Name] = typ
+	c.resolveStruct(decl, typ)
+}
+
+// resolveStruct resolves the fields of a struct once it is declared, so a
+// field can hold the struct itself.
+func (c *Checker) resolveStruct(decl *ast.StructDecl, typ *Struct) {
+	seen := make(map[string]bool)
+	for _, field := range decl.Fields {
+		if seen[field.Name] {
+			c.errorf(decl, "field '%s' is declared twice in struct %s", field.Name, decl.Name)
+			continue
+		}
+		seen[field.Name] = true
+		typ.Fields = append(typ.Fields, Field{Name: field.Name, Type: c.resolveType(decl, field.Type)})
+	}
+}
+
+// checkStructLiteral checks that every field of the struct is given exactly
+// once and has the declared type.
+func (c *Checker) checkStructLiteral(lit *ast.StructLiteral) Type {
+	typ, found := c.scope.lookupType(lit.Name)
+	st, ok := typ.(*Struct)
+	if !found || !ok {
+		c.errorf(lit, "unknown struct '%s'", lit.Name)
+		for _, field := range lit.Fields {
+			c.checkExpr(field.Value)
+		}
+		return Any
+	}
+
+	given := make(map[string]bool)
+	for _, field := range lit.Fields {
+		value := c.checkExpr(field.Value)
+
+		decl, ok := st.Field(field.Name)
+		switch {
+		case !ok:
+			c.errorf(field.Value, "struct %s has no field '%s'", st.Name, field.Name)
+		case given[field.Name]:
+			c.errorf(field.Value, "field '%s' is given twice", field.Name)
+		case !AssignableTo(value, decl.Type):
+			c.errorf(field.Value, "field '%s' of %s must be %s, got %s", field.Name, st.Name, decl.Type, value)
+		}
+		given[field.Name] = true
+	}
+
+	for _, field := range st.Fields {
+		if !given[field.Name] {
+			c.errorf(lit, "missing field '%s' in %s literal", field.Name, st.Name)
+		}
+	}
+	return st
+}
+
+// checkField returns the type of the field name of a value of type object.
+func (c *Checker) checkField(object Type, node ast.Node, name string) Type {
+	if object == Any {
+		return Any
+	}
+
+	st, ok := object.(*Struct)
+	if !ok {
+		c.errorf(node, "a value of type %s has no fields", object)
+		return Any
+	}
+
+	field, ok := st.Field(name)
+	if !ok {
+		c.errorf(node, "struct %s has no field '%s'", st.Name, name)
+		return Any
+	}
+	return field.Type
+}
+
+func (c *Checker) checkFieldAssign(assign *ast.FieldAssign) Type {
+	field := c.checkField(c.checkExpr(assign.Object), assign, assign.Field)
+	value := c.checkExpr(assign.Value)
+
+	if !AssignableTo(value, field) {
+		c.errorf(assign, "cannot assign %s to field '%s' of type %s", value, assign.Field, field)
+	}
+	return value
+}
@@ -0,0 +1,305 @@
+package types
+
+import "strings"
+
+// Type is the static type of an expression as seen by the Checker.
+type Type interface {
+	String() string
+}
+
+// Basic is a type without any structure, like int or bool.
+type Basic struct {
+	Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+var (
+	Int    = &Basic{Name: "int"}
+	Float  = &Basic{Name: "float"}
+	String = &Basic{Name: "string"}
+	Bool   = &Basic{Name: "bool"}
+	None   = &Basic{Name: "none"}
+	// AnyFunc is what the fn annotation means: some function whose signature
+	// is not known statically.
+	AnyFunc = &Basic{Name: "fn"}
+	// Any is used where the type can only be known at runtime, like the
+	// result of calling an fn. It is compatible with every other type.
+	Any = &Basic{Name: "any"}
+)
+
+// Func is the signature of a function declared with def, written
+// fn(int, string): bool in the source.
+type Func struct {
+	Params []Type
+	Result Type
+}
+
+// String leaves out a result that is only known at runtime, the way it is
+// written.
+func (f *Func) String() string {
+	params := make([]string, len(f.Params))
+	for i, param := range f.Params {
+		params[i] = param.String()
+	}
+	s := "fn(" + strings.Join(params, ", ") + ")"
+	if f.Result != Any {
+		s += ": " + f.Result.String()
+	}
+	return s
+}
+
+// Array is a list of elements of one type, written int[] in the source.
+type Array struct {
+	Elem Type
+}
+
+func (a *Array) String() string { return a.Elem.String() + "[]" }
+
+// Map maps keys of one type to values of another, written {string: int} in
+// the source.
+type Map struct {
+	Key   Type
+	Value Type
+}
+
+func (m *Map) String() string { return "{" + m.Key.String() + ": " + m.Value.String() + "}" }
+
+// Struct is a type declared with struct. Two structs are only the same type
+// when they come from the same declaration.
+type Struct struct {
+	Name   string
+	Fields []Field
+}
+
+// Field is a field of a Struct.
+type Field struct {
+	Name string
+	Type Type
+}
+
+func (s *Struct) String() string { return s.Name }
+
+// Field returns the field called name.
+func (s *Struct) Field(name string) (Field, bool) {
+	for _, field := range s.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// Enum is a type declared with enum, a value of it is one of the variants.
+type Enum struct {
+	Name     string
+	Variants []EnumVariant
+}
+
+// EnumVariant is one case of an Enum and the fields it carries.
+type EnumVariant struct {
+	Name   string
+	Fields []Field
+}
+
+func (e *Enum) String() string { return e.Name }
+
+// Variant returns the position of the variant called name, or -1.
+func (e *Enum) Variant(name string) int {
+	for i, variant := range e.Variants {
+		if variant.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// FromName resolves a type annotation written in the source. named looks up
+// the types declared by the program, like structs, it can be nil.
+func FromName(name string, named func(name string) (Type, bool)) (Type, bool) {
+	// The result type of a function takes any [] after it
+	if typ, ok, isFunc := funcFromName(name, named); isFunc {
+		return typ, ok
+	}
+
+	if elem, ok := strings.CutSuffix(name, "[]"); ok {
+		elemType, ok := FromName(elem, named)
+		if !ok {
+			return nil, false
+		}
+		return &Array{Elem: elemType}, true
+	}
+
+	if inner, ok := strings.CutPrefix(name, "{"); ok {
+		return mapFromName(strings.TrimSuffix(inner, "}"), named)
+	}
+
+	switch name {
+	case "int":
+		return Int, true
+	case "float":
+		return Float, true
+	case "string":
+		return String, true
+	case "bool":
+		return Bool, true
+	case "fn":
+		return AnyFunc, true
+	}
+
+	if named != nil {
+		return named(name)
+	}
+	return nil, false
+}
+
+// funcFromName resolves fn(int, string): bool. isFunc is false when name is
+// not a function type, or one followed by [].
+func funcFromName(name string, named func(name string) (Type, bool)) (typ Type, ok bool, isFunc bool) {
+	inner, found := strings.CutPrefix(name, "fn(")
+	if !found {
+		return nil, false, false
+	}
+
+	// Split the parameters at the commas outside of the brackets of
+	// the types inside
+	var params []string
+	depth, start, end := 0, 0, -1
+	for i := 0; i < len(inner) && end < 0; i++ {
+		switch inner[i] {
+		case '(', '{':
+			depth++
+		case ')', '}':
+			if depth == 0 {
+				end = i
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				params = append(params, inner[start:i])
+				start = i + 2
+			}
+		}
+	}
+	if end < 0 {
+		return nil, false, true
+	}
+	if end > start {
+		params = append(params, inner[start:end])
+	}
+
+	sig := &Func{Params: make([]Type, len(params)), Result: Any}
+	rest := inner[end+1:]
+	if result, found := strings.CutPrefix(rest, ": "); found {
+		if sig.Result, ok = FromName(result, named); !ok {
+			return nil, false, true
+		}
+	} else if rest != "" {
+		return nil, false, false
+	}
+
+	for i, param := range params {
+		if sig.Params[i], ok = FromName(param, named); !ok {
+			return nil, false, true
+		}
+	}
+	return sig, true, true
+}
+
+// mapFromName resolves the "key: value" inside the braces of a map type. The
+// key type can not contain a colon, so the first one splits the two.
+func mapFromName(inner string, named func(name string) (Type, bool)) (Type, bool) {
+	keyName, valueName, ok := strings.Cut(inner, ": ")
+	if !ok {
+		return nil, false
+	}
+
+	key, ok := FromName(keyName, named)
+	if !ok || !IsHashable(key) {
+		return nil, false
+	}
+	value, ok := FromName(valueName, named)
+	if !ok {
+		return nil, false
+	}
+	return &Map{Key: key, Value: value}, true
+}
+
+// IsHashable reports whether values of type t can be used as map keys.
+func IsHashable(t Type) bool {
+	return t == String || t == Bool || t == Any || isNumeric(t)
+}
+
+func isNumeric(t Type) bool {
+	return t == Int || t == Float
+}
+
+func isArray(t Type) bool {
+	_, ok := t.(*Array)
+	return ok
+}
+
+func isMap(t Type) bool {
+	_, ok := t.(*Map)
+	return ok
+}
+
+// isComparable reports whether values of type t can be compared with == and
+// !=. Arrays, maps, structs and enums are not, they would need a deep
+// comparison. Enums are compared with match instead.
+func isComparable(t Type) bool {
+	switch t.(type) {
+	case *Array, *Map, *Struct, *Enum:
+		return false
+	}
+	return true
+}
+
+func isFunc(t Type) bool {
+	_, ok := t.(*Func)
+	return ok || t == AnyFunc
+}
+
+// AssignableTo reports whether a value of type from can be stored where a
+// value of type to is expected.
+//
+// An int is not assignable to a float even though arithmetic promotes it.
+// Neither backend knows the declared type of a variable, so the value would
+// stay an Int and x / 2 would divide it as one. Such a value is promoted
+// explicitly instead, with a float literal like 1.0 or n * 1.0.
+func AssignableTo(from, to Type) bool {
+	if from == Any || to == Any || from == to {
+		return true
+	}
+	// A function whose signature is unknown is checked when it is called
+	if to == AnyFunc {
+		return isFunc(from)
+	}
+	if from == AnyFunc {
+		return isFunc(to)
+	}
+
+	// Arrays can be changed through any reference to them, so the element
+	// types have to match both ways
+	if a, ok := from.(*Array); ok {
+		b, ok := to.(*Array)
+		return ok && AssignableTo(a.Elem, b.Elem) && AssignableTo(b.Elem, a.Elem)
+	}
+	if a, ok := from.(*Map); ok {
+		b, ok := to.(*Map)
+		return ok && AssignableTo(a.Key, b.Key) && AssignableTo(b.Key, a.Key) &&
+			AssignableTo(a.Value, b.Value) && AssignableTo(b.Value, a.Value)
+	}
+
+	f, ok := from.(*Func)
+	g, ok2 := to.(*Func)
+	if !ok || !ok2 || len(f.Params) != len(g.Params) {
+		return false
+	}
+	for i := range f.Params {
+		if !AssignableTo(g.Params[i], f.Params[i]) {
+			return false
+		}
+	}
+	return AssignableTo(f.Result, g.Result)
+}
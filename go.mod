@@ -5,6 +5,7 @@ go 1.23.3
 require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/labstack/echo/v4 v4.13.3
+	golang.org/x/sys v0.28.0
 )
 
 require (
@@ -15,7 +16,6 @@ require (
 	github.com/valyala/fasttemplate v1.2.2 // indirect
 	golang.org/x/crypto v0.31.0 // indirect
 	golang.org/x/net v0.33.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 	golang.org/x/time v0.8.0 // indirect
 )
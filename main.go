@@ -2,8 +2,11 @@ package main
 
 import (
 	"berlang/terminal"
+	"flag"
+	"fmt"
+	"html/template"
 	"io"
-	"text/template"
+	"os"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -23,27 +26,71 @@ func newTemplate() *Templates {
 	}
 }
 
-func startOnWeb() {
+// webStepLimit bounds the loop iterations and calls of a command sent to the
+// web terminal, which every visitor shares. It is under a second of work.
+const webStepLimit = 1_000_000
 
-    e := echo.New()
-    e.Use(middleware.Logger())
+func startOnWeb(addr string) {
 
-    terminal := terminal.NewTerminal()
-    e.Renderer = newTemplate()
+	e := echo.New()
+	e.Use(middleware.Logger())
 
-    e.GET("/", func(c echo.Context) error {
-        return c.Render(200, "index.html", nil)
-    })
+	terminal := terminal.NewTerminal()
+	terminal.SetStepLimit(webStepLimit)
+	e.Renderer = newTemplate()
 
-e.POST("/execute", func(c echo.Context) error {
-    command := c.FormValue("command")
-    result := terminal.ExecuteCommand(command)
-    return c.Render(200, "terminal_output.html", result)
-})
+	e.GET("/", func(c echo.Context) error {
+		return c.Render(200, "index.html", nil)
+	})
 
-    e.Logger.Fatal(e.Start(":3000"))
+	e.POST("/execute", func(c echo.Context) error {
+		command := c.FormValue("command")
+		result := terminal.ExecuteCommand(command)
+		return c.Render(200, "terminal_output.html", result)
+	})
+
+	e.Logger.Fatal(e.Start(addr))
 }
 
+const usage = `Usage: berlang <command> [arguments]
+
+Commands:
+  run <file.bl>   run a Berlang script, or a .blc file made by build
+  build <file.bl> compile a script to bytecode, -o names the .blc file
+  repl            start an interactive session
+  serve           start the web terminal
+`
+
 func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "run":
+		os.Exit(runCommand(os.Args[2:]))
 
+	case "build":
+		os.Exit(buildCommand(os.Args[2:]))
+
+	case "repl":
+		if err := terminal.NewTerminal().RunREPL(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "berlang: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "serve":
+		fs := flag.NewFlagSet("serve", flag.ExitOnError)
+		addr := fs.String("addr", ":3000", "address to listen on")
+		fs.Parse(os.Args[2:])
+		startOnWeb(*addr)
+
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+
+	default:
+		fmt.Fprintf(os.Stderr, "berlang: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"berlang/diagnostics"
+	"berlang/frontend/ast"
+	"berlang/frontend/lexer"
+	"berlang/frontend/parser"
+	"berlang/frontend/types"
+	"berlang/runtime/compiler"
+	"berlang/runtime/interpreter"
+	"berlang/runtime/values"
+	"berlang/runtime/vm"
+	"berlang/trace"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runCommand implements `berlang run`, returning the process exit code.
+func runCommand(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: berlang run [-nocheck] [-vm] [-trace stages] <file.bl | file.blc | ->")
+		fs.PrintDefaults()
+	}
+	noCheck := fs.Bool("nocheck", false, "skip the static type check")
+	useVM := fs.Bool("vm", false, "compile to bytecode and run it on the vm instead of the interpreter")
+	traceList := fs.String("trace", "", "log the events of the comma separated stages lexer, parser and eval to stderr, eval only with the interpreter")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	stages, err := trace.ParseStages(*traceList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "berlang: -trace: %v\n", err)
+		return 2
+	}
+	tracer := trace.Discard
+	if len(stages) > 0 {
+		handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+		tracer = trace.NewSlog(slog.New(handler), stages...)
+	}
+
+	path := fs.Arg(0)
+	bytecode := filepath.Ext(path) == ".blc"
+	for _, stage := range stages {
+		// Only the interpreter reports eval events, and a .blc file goes
+		// through no stage at all
+		switch {
+		case bytecode:
+			fmt.Fprintln(os.Stderr, "berlang: -trace does not apply to a .blc file, it is neither lexed, parsed nor interpreted")
+			return 2
+		case stage == trace.Eval && *useVM:
+			fmt.Fprintln(os.Stderr, "berlang: -trace=eval traces the interpreter, it can not be used with -vm")
+			return 2
+		}
+	}
+	if bytecode {
+		return runBytecode(path)
+	}
+
+	input := os.Stdin
+	if path == "-" {
+		path = "<stdin>"
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "berlang: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	// The lexer reads the script as the parser asks for tokens, a copy is
+	// kept to show the source lines of any errors
+	var src strings.Builder
+	if err := runSource(io.TeeReader(input, &src), !*noCheck, *useVM, tracer); err != nil {
+		reportError(path, src.String(), err)
+		return 1
+	}
+	return 0
+}
+
+// runSource sends a script through the lexer, parser, type checker and
+// interpreter, or the vm, and prints the value of the last evaluated
+// statement. The vm reports no eval events to tracer.
+func runSource(input io.Reader, check bool, useVM bool, tracer trace.Tracer) error {
+	program, err := parseSource(input, check, tracer)
+	if err != nil {
+		return err
+	}
+
+	var result values.RtVal
+	if useVM {
+		result, err = vm.New(os.Stdout).Evaluate(program)
+	} else {
+		runtime := interpreter.NewRuntime(os.Stdout)
+		runtime.SetTracer(tracer)
+		result, err = runtime.Evaluate(program)
+	}
+	if err != nil {
+		return err
+	}
+
+	printResult(result)
+	return nil
+}
+
+// parseSource parses a script and type checks it unless check is false.
+func parseSource(input io.Reader, check bool, tracer trace.Tracer) (ast.Stmt, error) {
+	lex := lexer.NewLexer(input)
+	lex.SetTracer(tracer)
+	p := parser.NewParser(lex)
+	p.SetTracer(tracer)
+
+	program, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	if check {
+		if err := types.NewChecker().Check(program); err != nil {
+			return nil, err
+		}
+	}
+	return program, nil
+}
+
+// runBytecode loads a program built by `berlang build` and runs it on the vm.
+func runBytecode(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "berlang: %v\n", err)
+		return 1
+	}
+
+	program, err := compiler.Decode(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "berlang: %s: %v\n", path, err)
+		return 1
+	}
+
+	result, err := vm.New(os.Stdout).Run(program)
+	if err != nil {
+		// The source is not at hand, errors only point to where they
+		// happened in it
+		if program.Source != "" {
+			path = program.Source
+		}
+		reportError(path, "", err)
+		return 1
+	}
+
+	printResult(result)
+	return 0
+}
+
+// printResult shows the value of the last statement. A none is left out, it
+// is what a script ending in a call to println gives.
+func printResult(result values.RtVal) {
+	if _, none := result.(*values.NoneVal); result != nil && !none {
+		fmt.Println(result.String())
+	}
+}
+
+// reportError prints err to stderr, with the offending source line when the
+// error knows where it happened.
+func reportError(path string, src string, err error) {
+	diags := diagnostics.From(err)
+	if diags == nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return
+	}
+
+	for _, d := range diags {
+		diagnostics.Render(os.Stderr, d, path, src)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"berlang/terminal"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runScript writes src to a temporary file and runs it with `berlang run`,
+// returning the exit code and what was written to stdout and stderr.
+func runScript(t *testing.T, src string, flags ...string) (int, string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "script.bl")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := os.Stdout, os.Stderr
+	outFile, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errFile, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout, os.Stderr = outFile, errFile
+	code := runCommand(append(flags, path))
+	os.Stdout, os.Stderr = stdout, stderr
+	outFile.Close()
+	errFile.Close()
+
+	out, _ := os.ReadFile(outFile.Name())
+	errOut, _ := os.ReadFile(errFile.Name())
+	return code, string(out), strings.ReplaceAll(string(errOut), path, "script.bl")
+}
+
+func TestRunCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		flags  []string
+		code   int
+		stdout string
+		// stderr holds lines expected in the error output, in order
+		stderr []string
+	}{
+		{"value", "let x: int = 2\nx * 21", nil, 0, "42\n", nil},
+		{"print", "println(\"hi\")", []string{"-vm"}, 0, "hi\n", nil},
+		{"syntax error", "let x: int = \n", nil, 1, "", []string{"error[E0002]", "--> script.bl:1:"}},
+		{"type error", "let x: int = 1\nx = \"s\"", nil, 1, "", []string{"error[E0003]", "--> script.bl:2:1"}},
+		{"runtime error", "let x: int = 0\n\nprintln(1)\n1 / x", nil, 1, "1\n", []string{"error[E0004]", "--> script.bl:4:1", "4 | 1 / x"}},
+		{"vm runtime error", "let x: int = 0\n1 / x", []string{"-vm"}, 1, "", []string{"error[E0004]", "--> script.bl:2:1"}},
+		{"unchecked", "let x: int = \"s\"\nx", []string{"-nocheck"}, 0, "s\n", nil},
+		{"trace with vm", "1", []string{"-trace=eval", "-vm"}, 2, "", []string{"-trace=eval"}},
+		{"unknown stage", "1", []string{"-trace=typer"}, 2, "", []string{`unknown stage "typer"`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, stdout, stderr := runScript(t, test.src, test.flags...)
+			if code != test.code {
+				t.Errorf("Expected exit code %d, got %d, stderr:\n%s", test.code, code, stderr)
+			}
+			if stdout != test.stdout {
+				t.Errorf("Expected stdout %q, got %q", test.stdout, stdout)
+			}
+
+			rest := stderr
+			for _, expected := range test.stderr {
+				i := strings.Index(rest, expected)
+				if i < 0 {
+					t.Errorf("Expected %q in stderr:\n%s", expected, stderr)
+					break
+				}
+				rest = rest[i+len(expected):]
+			}
+			if test.stderr == nil && stderr != "" {
+				t.Errorf("Unexpected stderr:\n%s", stderr)
+			}
+		})
+	}
+}
+
+func TestRunCommandMissingFile(t *testing.T) {
+	stderr := os.Stderr
+	os.Stderr, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer func() { os.Stderr = stderr }()
+
+	if code := runCommand([]string{filepath.Join(t.TempDir(), "missing.bl")}); code != 1 {
+		t.Errorf("Expected exit code 1 for a missing file, got %d", code)
+	}
+	if code := runCommand(nil); code != 2 {
+		t.Errorf("Expected exit code 2 without a file, got %d", code)
+	}
+}
+
+func TestTerminalOutputEscapes(t *testing.T) {
+	result := terminal.NewTerminal().ExecuteCommand(`println("<script>alert(1)</script>")` + "\n" + `"<b>"`)
+
+	var page strings.Builder
+	if err := newTemplate().Render(&page, "terminal_output.html", result, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(page.String(), "<script>") || strings.Contains(page.String(), "<b>") {
+		t.Errorf("Expected the printed markup to be escaped, got:\n%s", page.String())
+	}
+	if !strings.Contains(page.String(), "&lt;script&gt;") {
+		t.Errorf("Expected the escaped output in the page, got:\n%s", page.String())
+	}
+
+	// The diagnostics are markup already
+	result = terminal.NewTerminal().ExecuteCommand(`let s: int = "<i>"`)
+	page.Reset()
+	if err := newTemplate().Render(&page, "terminal_output.html", result, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(page.String(), `<pre class="diagnostic">`) || strings.Contains(page.String(), "<i>") {
+		t.Errorf("Expected the diagnostic markup with the source escaped, got:\n%s", page.String())
+	}
+}
@@ -0,0 +1,85 @@
+package compiler
+
+import (
+	"berlang/runtime/values"
+	"berlang/utils"
+	"sort"
+)
+
+// Program is a compiled script. Functions[0] is the top level code, the
+// others are the functions declared in it, referenced by OpClosure.
+type Program struct {
+	Functions []*Function
+	// Source is the name of the file the program was compiled from, if any.
+	// It is saved with the bytecode so errors can point to the script.
+	Source string
+}
+
+// Function is the code of a function together with what it needs to be
+// turned into a closure.
+type Function struct {
+	Name  string // Empty for function literals and the top level code
+	Arity int
+	// Upvalues says where each variable the function captures comes from,
+	// read when OpClosure builds a closure of it
+	Upvalues []Upvalue
+	Chunk
+}
+
+// Upvalue is a variable captured from an enclosing function. Local ones are
+// slots of the function right around the closure, the others are upvalues
+// of that function in turn.
+type Upvalue struct {
+	Local bool
+	Index int
+}
+
+// Chunk is a sequence of instructions and the data they refer to.
+type Chunk struct {
+	Code []byte
+	// Constants holds Ints, Floats, Strings, struct and enum declarations
+	// and Arrays of Strings for the field names of struct literals
+	Constants []values.RtVal
+	Patterns  []Pattern
+	// Spans maps the code back to the source, each entry covers the code from
+	// its offset up to the next entry
+	Spans []SpanEntry
+}
+
+type SpanEntry struct {
+	Offset int
+	Span   utils.Span
+}
+
+// SpanAt returns the source span of the instruction at offset.
+func (c *Chunk) SpanAt(offset int) utils.Span {
+	i := sort.Search(len(c.Spans), func(i int) bool { return c.Spans[i].Offset > offset })
+	if i == 0 {
+		return utils.Span{}
+	}
+	return c.Spans[i-1].Span
+}
+
+// ReadU16 reads a 16 bit operand at offset.
+func (c *Chunk) ReadU16(offset int) int {
+	return int(c.Code[offset])<<8 | int(c.Code[offset+1])
+}
+
+type PatternKind byte
+
+const (
+	PatternWildcard PatternKind = iota
+	PatternBinding
+	PatternLiteral
+	PatternVariant
+)
+
+// Pattern is the compiled form of a match pattern. OpMatch pushes the values
+// of the bindings in the order they appear in the pattern.
+type Pattern struct {
+	Kind    PatternKind
+	Literal values.RtVal // The value a PatternLiteral compares with
+	Enum    string       // The enum and variant names of a PatternVariant
+	Variant string
+	Fields  []Pattern
+}
@@ -0,0 +1,690 @@
+// Package compiler lowers a parsed program to the bytecode run by the vm
+// package. Variables declared at the top level become globals looked up by
+// name, so they outlive a single program as they do in the interpreter. All
+// other variables live in stack slots assigned here, closures reach the
+// ones of enclosing functions through upvalues.
+package compiler
+
+import (
+	"berlang/diagnostics"
+	"berlang/frontend/ast"
+	"berlang/frontend/resolver"
+	"berlang/runtime/ops"
+	"berlang/runtime/values"
+	"berlang/utils"
+)
+
+type compiler struct {
+	program *Program
+	fn      *funcState
+	// hoisted holds the slots given to the local functions, structs and
+	// enums before their declarations run
+	hoisted map[ast.Stmt]int
+	// err is the first error found, compilation goes on so the stack
+	// bookkeeping stays consistent but the program is thrown away
+	err error
+}
+
+// funcState tracks the function being compiled.
+type funcState struct {
+	enclosing *funcState
+	function  *Function
+	locals    []local
+	// upvalueConst says for each upvalue of function whether the variable is
+	// a constant
+	upvalueConst []bool
+	// scopes holds the stack height at the start of every open block, the
+	// top level code of a program is in no block at all
+	scopes []int
+	// height is the number of values the code emitted so far leaves on the
+	// stack of the frame, locals and temporaries alike
+	height int
+	loops  []*loop
+	// span is the source of the node being compiled, recorded for every
+	// instruction emitted
+	span      utils.Span
+	constants map[any]int
+}
+
+type local struct {
+	name     string
+	slot     int
+	depth    int
+	constant bool
+}
+
+// loop collects the jumps of the break and continue statements of a loop.
+type loop struct {
+	// height is what break and continue drop the stack back to
+	height int
+	// start is where continue jumps back to, -1 when it jumps forward and
+	// continues has to be patched
+	start     int
+	breaks    []int
+	continues []int
+}
+
+// Compile lowers a program, or a single statement, to bytecode. Running it
+// returns the value of the last statement.
+func Compile(node ast.Stmt) (*Program, error) {
+	// The resolver reports the variables used before their declaration or
+	// declared twice, the slots it gives them are not used here
+	if err := resolver.Resolve(node); err != nil {
+		return nil, err
+	}
+
+	c := &compiler{program: &Program{}, hoisted: make(map[ast.Stmt]int)}
+	c.fn = c.newFunction(&Function{}, nil, node.GetSpan())
+
+	body := []ast.Stmt{node}
+	if program, ok := node.(*ast.Program); ok {
+		body = program.Body
+	}
+	c.statements(body, true)
+	c.emit(OpReturn)
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.program, nil
+}
+
+func (c *compiler) newFunction(fn *Function, enclosing *funcState, span utils.Span) *funcState {
+	c.program.Functions = append(c.program.Functions, fn)
+	return &funcState{enclosing: enclosing, function: fn, span: span, constants: make(map[any]int)}
+}
+
+func (c *compiler) errorf(format string, args ...any) {
+	if c.err == nil {
+		c.err = diagnostics.Errorf(diagnostics.CodeCompile, c.fn.span, format, args...)
+	}
+}
+
+// at makes node the source of the code emitted until the returned function
+// is called.
+func (c *compiler) at(node ast.Node) func() {
+	saved := c.fn.span
+	c.fn.span = node.GetSpan()
+	return func() { c.fn.span = saved }
+}
+
+// emit appends an instruction and accounts for the values it pushes and
+// pops.
+func (c *compiler) emit(op Op, operands ...int) {
+	chunk := &c.fn.function.Chunk
+	offset := len(chunk.Code)
+	if n := len(chunk.Spans); n > 0 && chunk.Spans[n-1].Offset == offset {
+		chunk.Spans[n-1].Span = c.fn.span
+	} else if n == 0 || chunk.Spans[n-1].Span != c.fn.span {
+		chunk.Spans = append(chunk.Spans, SpanEntry{Offset: offset, Span: c.fn.span})
+	}
+
+	chunk.Code = append(chunk.Code, byte(op))
+	for i, width := range op.Operands() {
+		operand := operands[i]
+		if operand < 0 || operand >= 1<<(8*width) {
+			c.errorf("program too large, operand %d of %s does not fit in %d bytes", operand, op, width)
+		}
+		if width == 2 {
+			chunk.Code = append(chunk.Code, byte(operand>>8))
+		}
+		chunk.Code = append(chunk.Code, byte(operand))
+	}
+	c.fn.height += stackEffect(op, operands)
+}
+
+// stackEffect is how much op changes the height of the stack. Instructions
+// that only push values when they do not jump, like OpMatch and OpNext, are
+// adjusted for where they are emitted.
+func stackEffect(op Op, operands []int) int {
+	switch op {
+	case OpConstant, OpNone, OpTrue, OpFalse, OpGetLocal, OpGetUpvalue, OpGetGlobal, OpClosure, OpMatch:
+		return 1
+	case OpPop, OpDefineGlobal, OpJumpIfFalse, OpJumpIfTrue, OpIndex, OpSetField, OpReturn,
+		OpAdd, OpSub, OpMul, OpDiv, OpMod, OpEqual, OpNotEqual, OpLess, OpLessEqual, OpGreater, OpGreaterEqual:
+		return -1
+	case OpSetIndex:
+		return -2
+	case OpPopN, OpCloseScope, OpCall:
+		return -operands[0]
+	case OpBuiltin:
+		return 1 - operands[1]
+	case OpArray:
+		return 1 - operands[0]
+	case OpMap:
+		return 1 - 2*operands[0]
+	case OpSlice:
+		return -(operands[0] & 1) - (operands[0] >> 1 & 1)
+	default:
+		return 0
+	}
+}
+
+// stackInputs is how many values op takes from the top of the stack. It
+// does not know the fields of an OpStruct, which takes one more value than
+// it has fields.
+func stackInputs(op Op, operands []int) int {
+	switch op {
+	case OpPop, OpSetLocal, OpSetUpvalue, OpDefineGlobal, OpSetGlobal, OpNegate, OpNot, OpCheckBool,
+		OpJumpIfFalse, OpJumpIfTrue, OpReturn, OpGetField, OpIter:
+		return 1
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpEqual, OpNotEqual, OpLess, OpLessEqual, OpGreater, OpGreaterEqual,
+		OpIndex, OpSetField:
+		return 2
+	case OpSetIndex:
+		return 3
+	case OpPopN, OpArray:
+		return operands[0]
+	case OpCloseScope, OpCall:
+		return operands[0] + 1
+	case OpBuiltin:
+		return operands[1]
+	case OpMap:
+		return 2 * operands[0]
+	case OpSlice:
+		return 1 + operands[0]&1 + operands[0]>>1&1
+	default:
+		return 0
+	}
+}
+
+// emitJump emits a jump whose offset is filled in by patchJump, it returns
+// where the offset is.
+func (c *compiler) emitJump(op Op, operands ...int) int {
+	c.emit(op, append(operands, 0)...)
+	return len(c.fn.function.Code) - 2
+}
+
+// patchJump makes the jump with its offset at at land on the next
+// instruction.
+func (c *compiler) patchJump(at int) {
+	code := c.fn.function.Code
+	offset := len(code) - (at + 2)
+	if offset > 0xffff {
+		c.errorf("program too large, too much code to jump over")
+	}
+	code[at] = byte(offset >> 8)
+	code[at+1] = byte(offset)
+}
+
+func (c *compiler) patchJumps(jumps []int) {
+	for _, at := range jumps {
+		c.patchJump(at)
+	}
+}
+
+// emitLoop jumps back to start.
+func (c *compiler) emitLoop(start int) {
+	c.emit(OpLoop, len(c.fn.function.Code)+OpLoop.Size()-start)
+}
+
+// constant adds v to the constant pool, numbers and strings are only added
+// once.
+func (c *compiler) constant(v values.RtVal) int {
+	var key any
+	switch v := v.(type) {
+	case *values.IntVal:
+		key = v.Value
+	case *values.FloatVal:
+		key = v.Value
+	case *values.StringVal:
+		key = v.Value
+	}
+	if i, found := c.fn.constants[key]; found && key != nil {
+		return i
+	}
+
+	chunk := &c.fn.function.Chunk
+	chunk.Constants = append(chunk.Constants, v)
+	i := len(chunk.Constants) - 1
+	if key != nil {
+		c.fn.constants[key] = i
+	}
+	return i
+}
+
+// name adds the name of a global, a field or a built-in to the constant
+// pool.
+func (c *compiler) name(name string) int {
+	return c.constant(ops.NewString(name))
+}
+
+// statements compiles a list of statements, with keep the value of the last
+// one, or none when there are none, is left on the stack.
+func (c *compiler) statements(body []ast.Stmt, keep bool) {
+	for i, stmt := range body {
+		c.stmt(stmt, keep && i == len(body)-1)
+	}
+	if keep && len(body) == 0 {
+		c.emit(OpNone)
+	}
+}
+
+// stmt compiles a statement. With keep its value is left on the stack, in
+// the same way the interpreter returns it.
+func (c *compiler) stmt(stmt ast.Stmt, keep bool) {
+	defer c.at(stmt)()
+
+	switch s := stmt.(type) {
+	case *ast.VarDecl:
+		if s.Value == nil {
+			c.emit(OpNone)
+		} else {
+			c.expr(*s.Value)
+		}
+		c.define(s.Name, s.VarType == "const", keep)
+
+	case *ast.FunctionDecl:
+		if slot, ok := c.hoisted[s]; ok {
+			c.function(s.Name, s.Params, s.Body)
+			c.setHoisted(slot, keep)
+			break
+		}
+		if c.atGlobalScope() {
+			c.function(s.Name, s.Params, s.Body)
+			c.define(s.Name, true, keep)
+			break
+		}
+
+		// The local is declared first so the body can call the function
+		slot := c.fn.height
+		c.addLocal(s.Name, slot, true)
+		c.function(s.Name, s.Params, s.Body)
+		if keep {
+			c.emit(OpGetLocal, slot)
+		}
+
+	case *ast.StructDecl:
+		c.emit(OpConstant, c.constant(ops.StructType(s)))
+		if slot, ok := c.hoisted[s]; ok {
+			c.setHoisted(slot, keep)
+		} else {
+			c.define(s.Name, true, keep)
+		}
+
+	case *ast.EnumDecl:
+		c.emit(OpConstant, c.constant(ops.EnumType(s)))
+		if slot, ok := c.hoisted[s]; ok {
+			c.setHoisted(slot, keep)
+		} else {
+			c.define(s.Name, true, keep)
+		}
+
+	case *ast.BlockStmt:
+		c.block(s, keep)
+
+	case *ast.IfStmt:
+		c.ifStmt(s, keep)
+
+	case *ast.WhileStmt:
+		c.whileStmt(s)
+		c.none(keep)
+
+	case *ast.ForStmt:
+		c.forStmt(s)
+		c.none(keep)
+
+	case *ast.ForInStmt:
+		c.forInStmt(s)
+		c.none(keep)
+
+	case *ast.BreakStmt:
+		c.jumpOutOfLoop(true)
+		c.unreachable(keep)
+
+	case *ast.ContinueStmt:
+		c.jumpOutOfLoop(false)
+		c.unreachable(keep)
+
+	case *ast.ReturnStmt:
+		if s.Value == nil {
+			c.emit(OpNone)
+		} else {
+			c.expr(s.Value)
+		}
+		c.emit(OpReturn)
+		c.unreachable(keep)
+
+	case ast.Expr:
+		c.expr(s)
+		if !keep {
+			c.emit(OpPop)
+		}
+
+	default:
+		c.errorf("cannot compile a %s", stmt.GetKind())
+		c.none(keep)
+	}
+}
+
+// none pushes the value of a statement that has none.
+func (c *compiler) none(keep bool) {
+	if keep {
+		c.emit(OpNone)
+	}
+}
+
+// unreachable accounts for the value of a statement that never completes,
+// like return, so the code after it is compiled with the usual height.
+func (c *compiler) unreachable(keep bool) {
+	if keep {
+		c.fn.height++
+	}
+}
+
+func (c *compiler) atGlobalScope() bool {
+	return c.fn.enclosing == nil && len(c.fn.scopes) == 0
+}
+
+// define declares a variable holding the value on top of the stack.
+func (c *compiler) define(name string, constant bool, keep bool) {
+	if c.atGlobalScope() {
+		flag := 0
+		if constant {
+			flag = 1
+		}
+		c.emit(OpDefineGlobal, c.name(name), flag)
+		if keep {
+			c.emit(OpGetGlobal, c.name(name))
+		}
+		return
+	}
+
+	slot := c.fn.height - 1
+	c.addLocal(name, slot, constant)
+	if keep {
+		c.emit(OpGetLocal, slot)
+	}
+}
+
+func (c *compiler) addLocal(name string, slot int, constant bool) {
+	c.fn.locals = append(c.fn.locals, local{name: name, slot: slot, depth: len(c.fn.scopes), constant: constant})
+}
+
+func (c *compiler) beginScope() {
+	c.fn.scopes = append(c.fn.scopes, c.fn.height)
+}
+
+// endScope drops the values of the block, with keep the value on top is
+// kept.
+func (c *compiler) endScope(keep bool) {
+	fs := c.fn
+	start := fs.scopes[len(fs.scopes)-1]
+	fs.scopes = fs.scopes[:len(fs.scopes)-1]
+
+	for len(fs.locals) > 0 && fs.locals[len(fs.locals)-1].depth > len(fs.scopes) {
+		fs.locals = fs.locals[:len(fs.locals)-1]
+	}
+
+	n := fs.height - start
+	if keep {
+		n--
+	}
+	if n > 0 && keep {
+		c.emit(OpCloseScope, n)
+	} else if n > 0 {
+		c.emit(OpPopN, n)
+	}
+}
+
+func (c *compiler) block(b *ast.BlockStmt, keep bool) {
+	c.beginScope()
+	c.hoist(b.Body)
+	c.statements(b.Body, keep)
+	c.endScope(keep)
+}
+
+// hoist gives the functions, structs and enums of a block their slots
+// before any of its statements runs, so the functions of the block can use
+// those declared after them. The slots hold none until the declarations
+// run.
+func (c *compiler) hoist(body []ast.Stmt) {
+	for _, stmt := range body {
+		var name string
+		switch s := stmt.(type) {
+		case *ast.FunctionDecl:
+			name = s.Name
+		case *ast.StructDecl:
+			name = s.Name
+		case *ast.EnumDecl:
+			name = s.Name
+		default:
+			continue
+		}
+
+		restore := c.at(stmt)
+		c.emit(OpNone)
+		restore()
+		c.addLocal(name, c.fn.height-1, true)
+		c.hoisted[stmt] = c.fn.height - 1
+	}
+}
+
+// setHoisted moves the value on top of the stack into the slot hoist gave
+// its declaration, with keep it is left on the stack as well.
+func (c *compiler) setHoisted(slot int, keep bool) {
+	c.emit(OpSetLocal, slot)
+	if !keep {
+		c.emit(OpPop)
+	}
+}
+
+func (c *compiler) ifStmt(s *ast.IfStmt, keep bool) {
+	c.expr(s.Condition)
+	elseJump := c.emitJump(OpJumpIfFalse, condIf)
+	c.block(s.Then, keep)
+	if s.Else == nil && !keep {
+		c.patchJump(elseJump)
+		return
+	}
+
+	endJump := c.emitJump(OpJump)
+	c.patchJump(elseJump)
+	if keep {
+		// The else branch starts without the value of the then branch
+		c.fn.height--
+	}
+	if s.Else != nil {
+		c.stmt(s.Else, keep)
+	} else {
+		c.emit(OpNone)
+	}
+	c.patchJump(endJump)
+}
+
+// loopBody compiles the body of a loop, collecting its break and continue
+// statements.
+func (c *compiler) loopBody(body *ast.BlockStmt, l *loop) {
+	c.fn.loops = append(c.fn.loops, l)
+	c.block(body, false)
+	c.fn.loops = c.fn.loops[:len(c.fn.loops)-1]
+}
+
+func (c *compiler) whileStmt(s *ast.WhileStmt) {
+	start := len(c.fn.function.Code)
+	c.expr(s.Condition)
+	exit := c.emitJump(OpJumpIfFalse, condWhile)
+
+	l := &loop{height: c.fn.height, start: start}
+	c.loopBody(s.Body, l)
+	c.emitLoop(start)
+
+	c.patchJump(exit)
+	c.patchJumps(l.breaks)
+}
+
+// forStmt compiles a for loop in a block of its own, so the variable of the
+// init clause is dropped with the loop.
+func (c *compiler) forStmt(s *ast.ForStmt) {
+	c.beginScope()
+	if s.Init != nil {
+		c.stmt(s.Init, false)
+	}
+
+	start := len(c.fn.function.Code)
+	exit := -1
+	if s.Condition != nil {
+		c.expr(s.Condition)
+		exit = c.emitJump(OpJumpIfFalse, condFor)
+	}
+
+	l := &loop{height: c.fn.height, start: -1}
+	c.loopBody(s.Body, l)
+	c.patchJumps(l.continues)
+	if s.Update != nil {
+		c.stmt(s.Update, false)
+	}
+	c.emitLoop(start)
+
+	if exit >= 0 {
+		c.patchJump(exit)
+	}
+	c.patchJumps(l.breaks)
+	c.endScope(false)
+}
+
+// forInStmt keeps the iterator in a slot under the loop variables, which are
+// declared anew for every iteration so closures in the body keep the values
+// of their own iteration.
+func (c *compiler) forInStmt(s *ast.ForInStmt) {
+	c.expr(s.Iterable)
+	c.emit(OpIter)
+	iter := c.fn.height - 1
+
+	start := len(c.fn.function.Code)
+	done := c.emitJump(OpNext, iter, len(s.Names))
+
+	c.beginScope()
+	for i, name := range s.Names {
+		c.addLocal(name, iter+1+i, false)
+	}
+	c.fn.height += len(s.Names)
+
+	l := &loop{height: iter + 1, start: start}
+	c.loopBody(s.Body, l)
+	c.endScope(false)
+	c.emitLoop(start)
+
+	c.patchJump(done)
+	c.patchJumps(l.breaks)
+	c.emit(OpPop)
+}
+
+// jumpOutOfLoop compiles break and continue, dropping what the body left on
+// the stack first.
+func (c *compiler) jumpOutOfLoop(isBreak bool) {
+	if len(c.fn.loops) == 0 {
+		c.errorf("break or continue outside of a loop")
+		return
+	}
+	l := c.fn.loops[len(c.fn.loops)-1]
+
+	height := c.fn.height
+	if n := height - l.height; n > 0 {
+		c.emit(OpPopN, n)
+	}
+	switch {
+	case isBreak:
+		l.breaks = append(l.breaks, c.emitJump(OpJump))
+	case l.start >= 0:
+		c.emitLoop(l.start)
+	default:
+		l.continues = append(l.continues, c.emitJump(OpJump))
+	}
+	c.fn.height = height
+}
+
+// function compiles the body of a function and emits the closure for it.
+func (c *compiler) function(name string, params []ast.Param, body *ast.BlockStmt) {
+	fs := c.newFunction(&Function{Name: name, Arity: len(params)}, c.fn, c.fn.span)
+	index := len(c.program.Functions) - 1
+
+	c.fn = fs
+	fs.scopes = []int{0}
+	for i, param := range params {
+		c.addLocal(param.Name, i, false)
+	}
+	fs.height = len(params)
+
+	c.block(body, false)
+	c.emit(OpNone)
+	c.emit(OpReturn)
+
+	c.fn = fs.enclosing
+	c.emit(OpClosure, index)
+}
+
+// resolveLocal finds the innermost local called name in fs.
+func resolveLocal(fs *funcState, name string) (local, bool) {
+	for i := len(fs.locals) - 1; i >= 0; i-- {
+		if fs.locals[i].name == name {
+			return fs.locals[i], true
+		}
+	}
+	return local{}, false
+}
+
+// resolveUpvalue finds name in the functions around fs, capturing it in
+// every function in between.
+func resolveUpvalue(fs *funcState, name string) (int, bool, bool) {
+	if fs.enclosing == nil {
+		return 0, false, false
+	}
+	if l, found := resolveLocal(fs.enclosing, name); found {
+		return addUpvalue(fs, true, l.slot, l.constant), l.constant, true
+	}
+	if index, constant, found := resolveUpvalue(fs.enclosing, name); found {
+		return addUpvalue(fs, false, index, constant), constant, true
+	}
+	return 0, false, false
+}
+
+func addUpvalue(fs *funcState, isLocal bool, index int, constant bool) int {
+	upvalue := Upvalue{Local: isLocal, Index: index}
+	for i, existing := range fs.function.Upvalues {
+		if existing == upvalue {
+			return i
+		}
+	}
+	fs.function.Upvalues = append(fs.function.Upvalues, upvalue)
+	fs.upvalueConst = append(fs.upvalueConst, constant)
+	return len(fs.function.Upvalues) - 1
+}
+
+// isDeclared reports whether name is a local variable here or in an
+// enclosing function. Globals are only known when the program runs.
+func (c *compiler) isDeclared(name string) bool {
+	if _, found := resolveLocal(c.fn, name); found {
+		return true
+	}
+	_, _, found := resolveUpvalue(c.fn, name)
+	return found
+}
+
+func (c *compiler) load(name string) {
+	if l, found := resolveLocal(c.fn, name); found {
+		c.emit(OpGetLocal, l.slot)
+	} else if index, _, found := resolveUpvalue(c.fn, name); found {
+		c.emit(OpGetUpvalue, index)
+	} else {
+		c.emit(OpGetGlobal, c.name(name))
+	}
+}
+
+// store assigns the value on top of the stack to a variable, leaving it
+// there.
+func (c *compiler) store(name string) {
+	if l, found := resolveLocal(c.fn, name); found {
+		if l.constant {
+			c.errorf("variable '%s' is a constant and cannot be reassigned", name)
+		}
+		c.emit(OpSetLocal, l.slot)
+	} else if index, constant, found := resolveUpvalue(c.fn, name); found {
+		if constant {
+			c.errorf("variable '%s' is a constant and cannot be reassigned", name)
+		}
+		c.emit(OpSetUpvalue, index)
+	} else {
+		c.emit(OpSetGlobal, c.name(name))
+	}
+}
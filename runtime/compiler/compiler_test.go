@@ -0,0 +1,209 @@
+package compiler_test
+
+import (
+	"berlang/diagnostics"
+	"berlang/frontend/ast"
+	"berlang/frontend/lexer"
+	"berlang/frontend/parser"
+	"berlang/runtime/compiler"
+	"berlang/runtime/vm"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+)
+
+func parseString(input string, t *testing.T) ast.Stmt {
+	t.Helper()
+
+	tokens, err := lexer.NewLexer(strings.NewReader(input)).Lex()
+	if err != nil {
+		t.Fatalf("Error lexing input: %v", err)
+	}
+
+	program, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatalf("Error parsing input: %v", err)
+	}
+	return program
+}
+
+func TestCompileErrors(t *testing.T) {
+	cases := []struct {
+		input string
+		err   string
+		line  int
+	}{
+		{"def f() {\n  const c: int = 1\n  c = 2\n}", "variable 'c' is a constant and cannot be reassigned", 3},
+		{"def f() {\n  const c: int = 1\n  def g() { c = 2 }\n}", "variable 'c' is a constant and cannot be reassigned", 3},
+	}
+
+	for _, tc := range cases {
+		_, err := compiler.Compile(parseString(tc.input, t))
+		var d *diagnostics.Diagnostic
+		if !errors.As(err, &d) {
+			t.Errorf("%q: expected a diagnostic, got %v", tc.input, err)
+			continue
+		}
+		if d.Code != diagnostics.CodeCompile || d.Message != tc.err || d.Span.Start.Line != tc.line {
+			t.Errorf("%q: expected %s %q on line %d, got %s %q on line %d",
+				tc.input, diagnostics.CodeCompile, tc.err, tc.line, d.Code, d.Message, d.Span.Start.Line)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	program, err := compiler.Compile(parseString(`
+		let total: int = 0
+		for (let i: int = 0; i < 10; i = i + 1) {
+			if (i % 2 == 0) { continue }
+			total = total + i
+		}
+		def counter() {
+			let n: int = 0
+			return def() { n = n + 1; return n }
+		}
+		match (total) { 25 => "ok", _ => "wrong" }
+	`, t))
+	if err != nil {
+		t.Fatalf("Error compiling: %v", err)
+	}
+
+	if len(program.Functions) != 3 {
+		t.Fatalf("Expected 3 functions, got %d", len(program.Functions))
+	}
+	if closure := program.Functions[2]; len(closure.Upvalues) != 1 || !closure.Upvalues[0].Local {
+		t.Errorf("Expected the inner function to capture one local, got %+v", closure.Upvalues)
+	}
+
+	var listing strings.Builder
+	compiler.Disassemble(&listing, program)
+	for _, want := range []string{"== 0 <script>", "== 1 counter (arity 0, upvalues 0)", "LOOP", "GET_UPVALUE", `(total)`} {
+		if !strings.Contains(listing.String(), want) {
+			t.Errorf("Expected the listing to contain %q:\n%s", want, listing.String())
+		}
+	}
+	if strings.Contains(listing.String(), "<truncated>") {
+		t.Errorf("Listing has a truncated instruction:\n%s", listing.String())
+	}
+}
+
+const formatProgram = `
+	struct P { x: int, y: float }
+	enum Shape { Dot, Circle(r: float) }
+	let p: P = P{x: -3, y: 1.5}
+	def area(s: Shape): float {
+		return match (s) { Shape.Circle(r) if r > 0.0 => r * r, Shape.Dot => 0.0, _ => -1.0 }
+	}
+	let names: string[] = ["a", "b"]
+	for (n in names) { p.x = p.x + len(n) }
+	[area(Shape.Circle(2.0)), p, true, match (p.x) { -1 => "yes", _ => "no" }]
+`
+
+func encode(t *testing.T, source string) []byte {
+	t.Helper()
+
+	program, err := compiler.Compile(parseString(source, t))
+	if err != nil {
+		t.Fatalf("Error compiling: %v", err)
+	}
+	program.Source = "test.bl"
+
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, program); err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeDecode(t *testing.T) {
+	program, err := compiler.Compile(parseString(formatProgram, t))
+	if err != nil {
+		t.Fatalf("Error compiling: %v", err)
+	}
+	var want strings.Builder
+	compiler.Disassemble(&want, program)
+
+	decoded, err := compiler.Decode(encode(t, formatProgram))
+	if err != nil {
+		t.Fatalf("Error decoding: %v", err)
+	}
+	if decoded.Source != "test.bl" {
+		t.Errorf("Expected the source test.bl, got %q", decoded.Source)
+	}
+
+	// The listing shows the code, constants and spans of every function
+	var got strings.Builder
+	compiler.Disassemble(&got, decoded)
+	if got.String() != want.String() {
+		t.Errorf("Decoded program differs, expected:\n%s\ngot:\n%s", want.String(), got.String())
+	}
+}
+
+// TestVerifyCompiled checks that the verifier accepts what the compiler
+// makes, whatever paths the code takes.
+func TestVerifyCompiled(t *testing.T) {
+	inputs := []string{
+		formatProgram,
+		"let n: int = 0\nwhile (n < 10) { n = n + 1\n if (n == 3) { continue }\n if (n > 5 && n < 8 || n == 9) { break } }",
+		"for (let i: int = 0; i < 3; i = i + 1) { let x: int = i\n for (k, v in {\"a\": x}) { if (v > 1) { break } } }",
+		"def counter(): fn { let n: int = 0\n return def(): int { n = n + 1\n return n } }\nlet c: fn = counter()\nc() + c()",
+		"let xs: int[] = [1, 2, 3]\nxs[0] = xs[1:][0] + xs[:2][1]\nlet m: {string: int} = {}\nm[\"a\"] = len(xs)\n!true",
+		"enum E { A(x: int, y: int), B }\nlet s: int = match (E.A(1, 2)) { E.A(x, y) if x > y => x, E.A(x, _) => { let z: int = x\n z }, E.B => 0 }",
+		"def f(x: int): int { if (x > 0) { return 1 } else { return -x } }\nf(1)",
+	}
+	for _, input := range inputs {
+		if _, err := compiler.Decode(encode(t, input)); err != nil {
+			t.Errorf("Error decoding %q: %v", input, err)
+		}
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	data := encode(t, formatProgram)
+
+	if _, err := compiler.Decode([]byte("let x: int = 1")); !errors.Is(err, compiler.ErrNotBytecode) {
+		t.Errorf("Expected ErrNotBytecode for a script, got %v", err)
+	}
+
+	wrongVersion := bytes.Clone(data)
+	binary.BigEndian.PutUint16(wrongVersion[4:], compiler.FormatVersion+1)
+	if _, err := compiler.Decode(wrongVersion); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("Expected a version error, got %v", err)
+	}
+
+	corrupt := bytes.Clone(data)
+	corrupt[len(corrupt)-1] ^= 0xff
+	if _, err := compiler.Decode(corrupt); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Expected a checksum error, got %v", err)
+	}
+
+	for n := range len(data) {
+		if _, err := compiler.Decode(data[:n]); err == nil {
+			t.Errorf("Expected an error for the first %d bytes", n)
+		}
+	}
+
+	// Change every byte of the body to every other value and fix the
+	// checksum, which leaves the decoder and the verifier to notice.
+	// Whatever they do, they must not panic.
+	for i := 14; i < len(data); i++ {
+		for flip := 1; flip < 256; flip++ {
+			changed := bytes.Clone(data)
+			changed[i] ^= byte(flip)
+			binary.BigEndian.PutUint32(changed[10:], crc32.ChecksumIEEE(changed[14:]))
+
+			// What the verifier lets through must fail with errors on the
+			// vm too, the limit stops the loops a changed jump makes
+			program, err := compiler.Decode(changed)
+			if err == nil {
+				machine := vm.New(io.Discard)
+				machine.SetStepLimit(1000)
+				machine.Run(program)
+			}
+		}
+	}
+}
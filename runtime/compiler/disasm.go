@@ -0,0 +1,74 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Disassemble writes a readable listing of every function of the program.
+func Disassemble(w io.Writer, program *Program) {
+	for i, fn := range program.Functions {
+		name := fn.Name
+		if i == 0 {
+			name = "<script>"
+		} else if name == "" {
+			name = "<anonymous fn>"
+		}
+		fmt.Fprintf(w, "== %d %s (arity %d, upvalues %d) ==\n", i, name, fn.Arity, len(fn.Upvalues))
+
+		for offset := 0; offset < len(fn.Code); {
+			offset = disassembleInstruction(w, &fn.Chunk, offset)
+		}
+	}
+}
+
+// disassembleInstruction writes the instruction at offset and returns the
+// offset of the next one.
+func disassembleInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	op := Op(chunk.Code[offset])
+	span := chunk.SpanAt(offset)
+	fmt.Fprintf(w, "%04d %4d:%-3d %-14s", offset, span.Start.Line, span.Start.Column, op)
+	if !op.Valid() {
+		fmt.Fprintln(w)
+		return offset + 1
+	}
+
+	next := offset + 1
+	for i, width := range op.Operands() {
+		if next+width > len(chunk.Code) {
+			fmt.Fprintln(w, " <truncated>")
+			return len(chunk.Code)
+		}
+		operand := int(chunk.Code[next])
+		if width == 2 {
+			operand = chunk.ReadU16(next)
+		}
+		next += width
+		fmt.Fprintf(w, " %s", describeOperand(chunk, op, i, operand, next))
+	}
+	fmt.Fprintln(w)
+	return next
+}
+
+// describeOperand formats operand i of op, showing the constant or the jump
+// target it refers to. end is the offset right after the operand, which for
+// jump offsets is the end of the instruction.
+func describeOperand(chunk *Chunk, op Op, i int, operand int, end int) string {
+	switch {
+	case op == OpLoop:
+		return fmt.Sprintf("-> %04d", end-operand)
+	case (op == OpJump || op == OpJumpIfFalse || op == OpJumpIfTrue || op == OpNext) && i == len(op.Operands())-1:
+		return fmt.Sprintf("-> %04d", end+operand)
+	case (op == OpNot || op == OpCheckBool || op == OpJumpIfFalse || op == OpJumpIfTrue) && i == 0:
+		if operand < len(Conditions) {
+			return strconv.Quote(Conditions[operand])
+		}
+	case op == OpConstant || op == OpDefineGlobal && i == 0 || op == OpGetGlobal || op == OpSetGlobal ||
+		op == OpBuiltin && i == 0 || op == OpStruct || op == OpGetField || op == OpSetField:
+		if operand < len(chunk.Constants) {
+			return fmt.Sprintf("%d (%s)", operand, chunk.Constants[operand])
+		}
+	}
+	return strconv.Itoa(operand)
+}
@@ -0,0 +1,301 @@
+package compiler
+
+import (
+	"berlang/frontend/ast"
+	"berlang/runtime/ops"
+	"berlang/runtime/values"
+)
+
+var binaryOps = map[string]Op{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"%":  OpMod,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	"<":  OpLess,
+	"<=": OpLessEqual,
+	">":  OpGreater,
+	">=": OpGreaterEqual,
+}
+
+// expr compiles an expression, which always leaves exactly one value on the
+// stack.
+func (c *compiler) expr(expr ast.Expr) {
+	defer c.at(expr)()
+
+	switch e := expr.(type) {
+	case *ast.NumericLiteral:
+		num, err := ops.Number(e)
+		if err != nil {
+			c.errorf("%v", err)
+			c.emit(OpNone)
+			return
+		}
+		c.emit(OpConstant, c.constant(num))
+
+	case *ast.StringLiteral:
+		c.emit(OpConstant, c.constant(ops.NewString(e.Value)))
+
+	case *ast.BooleanLiteral:
+		if e.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+
+	case *ast.Identifier:
+		c.load(e.Name)
+
+	case *ast.VarDecl:
+		c.stmt(e, true)
+
+	case *ast.VarAssign:
+		c.expr(*e.Value)
+		c.store(e.Name)
+
+	case *ast.BinaryExpr:
+		c.binaryExpr(e)
+
+	case *ast.UnaryExpr:
+		c.expr(e.Operand)
+		switch e.Operator {
+		case "!":
+			c.emit(OpNot, condNot)
+		case "-":
+			c.emit(OpNegate)
+		default:
+			c.errorf("unsupported unary operator: %s", e.Operator)
+		}
+
+	case *ast.CallExpr:
+		c.callExpr(e)
+
+	case *ast.FunctionLiteral:
+		c.function("", e.Params, e.Body)
+
+	case *ast.IndexExpr:
+		c.expr(e.Object)
+		c.expr(e.Index)
+		c.emit(OpIndex)
+
+	case *ast.SliceExpr:
+		c.expr(e.Object)
+		bounds := 0
+		if e.Start != nil {
+			c.expr(e.Start)
+			bounds |= 1
+		}
+		if e.End != nil {
+			c.expr(e.End)
+			bounds |= 2
+		}
+		c.emit(OpSlice, bounds)
+
+	case *ast.IndexAssign:
+		c.expr(e.Object)
+		c.expr(e.Index)
+		c.expr(e.Value)
+		c.emit(OpSetIndex)
+
+	case *ast.ArrayLiteral:
+		for _, element := range e.Elements {
+			c.expr(element)
+		}
+		c.emit(OpArray, len(e.Elements))
+
+	case *ast.MapLiteral:
+		for _, entry := range e.Entries {
+			c.expr(entry.Key)
+			c.expr(entry.Value)
+		}
+		c.emit(OpMap, len(e.Entries))
+
+	case *ast.StructLiteral:
+		c.load(e.Name)
+		names := make([]values.RtVal, len(e.Fields))
+		for i, field := range e.Fields {
+			c.expr(field.Value)
+			names[i] = ops.NewString(field.Name)
+		}
+		c.emit(OpStruct, c.constant(ops.NewArray(names)))
+		c.fn.height -= len(e.Fields)
+
+	case *ast.FieldExpr:
+		c.expr(e.Object)
+		c.emit(OpGetField, c.name(e.Field))
+
+	case *ast.FieldAssign:
+		c.expr(e.Object)
+		c.expr(e.Value)
+		c.emit(OpSetField, c.name(e.Field))
+
+	case *ast.MatchExpr:
+		c.matchExpr(e)
+
+	default:
+		c.errorf("cannot compile a %s", expr.GetKind())
+		c.emit(OpNone)
+	}
+}
+
+func (c *compiler) binaryExpr(e *ast.BinaryExpr) {
+	switch e.Operator {
+	case "&&", "||":
+		c.logicalExpr(e)
+		return
+	}
+
+	c.expr(e.Left)
+	c.expr(e.Right)
+	op, found := binaryOps[e.Operator]
+	if !found {
+		c.errorf("unsupported operator: %s", e.Operator)
+		return
+	}
+	c.emit(op)
+}
+
+// logicalExpr only evaluates the right hand side when the left one does not
+// already decide the result. Both sides have to be Bools.
+func (c *compiler) logicalExpr(e *ast.BinaryExpr) {
+	jump, what, decided := OpJumpIfFalse, condAnd, OpFalse
+	if e.Operator == "||" {
+		jump, what, decided = OpJumpIfTrue, condOr, OpTrue
+	}
+
+	c.expr(e.Left)
+	shortCircuit := c.emitJump(jump, what)
+	c.expr(e.Right)
+	c.emit(OpCheckBool, what)
+	end := c.emitJump(OpJump)
+
+	c.patchJump(shortCircuit)
+	c.fn.height--
+	c.emit(decided)
+	c.patchJump(end)
+}
+
+// callExpr calls a built-in when the callee is its name and no local
+// variable shadows it, the vm checks for globals of the same name.
+func (c *compiler) callExpr(call *ast.CallExpr) {
+	if ident, ok := call.Callee.(*ast.Identifier); ok {
+		if _, builtin := ops.Builtins[ident.Name]; builtin && !c.isDeclared(ident.Name) {
+			for _, arg := range call.Args {
+				c.expr(arg)
+			}
+			c.emit(OpBuiltin, c.name(ident.Name), len(call.Args))
+			return
+		}
+	}
+
+	c.expr(call.Callee)
+	for _, arg := range call.Args {
+		c.expr(arg)
+	}
+	c.emit(OpCall, len(call.Args))
+}
+
+// matchExpr keeps the subject in a slot and tries the arms in order. The
+// values bound by an arm are locals of a block around its guard and body,
+// whose value ends up next to the subject and then replaces it.
+func (c *compiler) matchExpr(match *ast.MatchExpr) {
+	c.expr(match.Subject)
+	subject := c.fn.height - 1
+
+	var ends []int
+	for _, arm := range match.Arms {
+		var names []string
+		pattern := c.pattern(arm.Pattern, &names)
+
+		chunk := &c.fn.function.Chunk
+		chunk.Patterns = append(chunk.Patterns, pattern)
+		c.emit(OpMatch, len(chunk.Patterns)-1, subject)
+		next := c.emitJump(OpJumpIfFalse, condMatch)
+
+		c.beginScope()
+		for i, name := range names {
+			c.addLocal(name, c.fn.height+i, false)
+		}
+		c.fn.height += len(names)
+
+		guard := -1
+		if arm.Guard != nil {
+			c.expr(arm.Guard)
+			guard = c.emitJump(OpJumpIfFalse, condMatchGuard)
+		}
+		c.stmt(arm.Body, true)
+		c.endScope(true)
+		ends = append(ends, c.emitJump(OpJump))
+
+		c.fn.height = subject + 1
+		if guard >= 0 {
+			c.patchJump(guard)
+			if len(names) > 0 {
+				c.fn.height += len(names)
+				c.emit(OpPopN, len(names))
+			}
+		}
+		c.patchJump(next)
+	}
+
+	c.emit(OpNoMatch, subject)
+	c.fn.height++
+	c.patchJumps(ends)
+	c.emit(OpCloseScope, 1)
+}
+
+// pattern compiles a match pattern, appending the names it binds to names.
+func (c *compiler) pattern(pattern ast.Pattern, names *[]string) Pattern {
+	switch p := pattern.(type) {
+	case *ast.WildcardPattern:
+		return Pattern{Kind: PatternWildcard}
+
+	case *ast.BindingPattern:
+		*names = append(*names, p.Name)
+		return Pattern{Kind: PatternBinding}
+
+	case *ast.LiteralPattern:
+		return Pattern{Kind: PatternLiteral, Literal: c.literal(p.Value)}
+
+	case *ast.VariantPattern:
+		fields := make([]Pattern, len(p.Fields))
+		for i, field := range p.Fields {
+			fields[i] = c.pattern(field, names)
+		}
+		return Pattern{Kind: PatternVariant, Enum: p.Enum, Variant: p.Variant, Fields: fields}
+
+	default:
+		c.errorf("unrecognized pattern %s", pattern.GetKind())
+		return Pattern{Kind: PatternWildcard}
+	}
+}
+
+// literal evaluates the value of a literal pattern.
+func (c *compiler) literal(expr ast.Expr) values.RtVal {
+	switch e := expr.(type) {
+	case *ast.NumericLiteral:
+		num, err := ops.Number(e)
+		if err != nil {
+			c.errorf("%v", err)
+			return ops.NewNone()
+		}
+		return num
+	case *ast.StringLiteral:
+		return ops.NewString(e.Value)
+	case *ast.BooleanLiteral:
+		return ops.NewBool(e.Value)
+	case *ast.UnaryExpr:
+		if e.Operator == "-" {
+			num, err := ops.Negate(c.literal(e.Operand))
+			if err != nil {
+				c.errorf("%v", err)
+				return ops.NewNone()
+			}
+			return num
+		}
+	}
+	c.errorf("a pattern can only compare with a literal, got a %s", expr.GetKind())
+	return ops.NewNone()
+}
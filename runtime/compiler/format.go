@@ -0,0 +1,680 @@
+package compiler
+
+import (
+	"berlang/runtime/values"
+	"berlang/utils"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// A .blc file is a compiled program. It starts with a fixed header, all of
+// its numbers big endian:
+//
+//	magic     "BLC\x00"
+//	version   u16, FormatVersion
+//	length    u32, the length of the body
+//	checksum  u32, the CRC-32 (IEEE) of the body
+//
+// The body is the name of the source file followed by the function table,
+// the script first. Each function is its name, arity, upvalues, code, the
+// constant pool, the patterns and the line table, which maps code offsets
+// to source spans. Counts, lengths and positions in the body are unsigned
+// varints, Ints are signed varints and Floats the bits of the float64.
+const (
+	magic      = "BLC\x00"
+	headerSize = len(magic) + 2 + 4 + 4
+
+	// FormatVersion is bumped whenever the encoding or the instruction set
+	// changes, files of other versions have to be built again.
+	FormatVersion = 1
+)
+
+// ErrNotBytecode is returned by Decode for data that does not start like a
+// .blc file.
+var ErrNotBytecode = errors.New("not a Berlang bytecode file")
+
+// Tags of the constants in the constant pool.
+const (
+	tagInt byte = iota + 1
+	tagFloat
+	tagString
+	tagBool
+	tagNone
+	tagArray
+	tagStruct
+	tagEnum
+)
+
+// Encode writes program in the .blc format.
+func Encode(w io.Writer, program *Program) error {
+	e := &encoder{}
+	e.string(program.Source)
+	e.uvarint(len(program.Functions))
+	for _, fn := range program.Functions {
+		e.function(fn)
+	}
+	if e.err != nil {
+		return e.err
+	}
+
+	header := make([]byte, headerSize, headerSize+len(e.buf))
+	copy(header, magic)
+	binary.BigEndian.PutUint16(header[4:], FormatVersion)
+	binary.BigEndian.PutUint32(header[6:], uint32(len(e.buf)))
+	binary.BigEndian.PutUint32(header[10:], crc32.ChecksumIEEE(e.buf))
+	_, err := w.Write(append(header, e.buf...))
+	return err
+}
+
+type encoder struct {
+	buf []byte
+	err error
+}
+
+func (e *encoder) uvarint(n int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(n))
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(len(s))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) strings(ss []string) {
+	e.uvarint(len(ss))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+func (e *encoder) function(fn *Function) {
+	e.string(fn.Name)
+	e.uvarint(fn.Arity)
+	e.uvarint(len(fn.Upvalues))
+	for _, uv := range fn.Upvalues {
+		local := byte(0)
+		if uv.Local {
+			local = 1
+		}
+		e.buf = append(e.buf, local)
+		e.uvarint(uv.Index)
+	}
+
+	e.uvarint(len(fn.Code))
+	e.buf = append(e.buf, fn.Code...)
+
+	e.uvarint(len(fn.Constants))
+	for _, constant := range fn.Constants {
+		e.constant(constant)
+	}
+
+	e.uvarint(len(fn.Patterns))
+	for i := range fn.Patterns {
+		e.pattern(&fn.Patterns[i])
+	}
+
+	e.uvarint(len(fn.Spans))
+	previous := 0
+	for _, entry := range fn.Spans {
+		e.uvarint(entry.Offset - previous)
+		e.uvarint(entry.Span.Start.Line)
+		e.uvarint(entry.Span.Start.Column)
+		e.uvarint(entry.Span.End.Line)
+		e.uvarint(entry.Span.End.Column)
+		previous = entry.Offset
+	}
+}
+
+func (e *encoder) constant(v values.RtVal) {
+	switch v := v.(type) {
+	case *values.IntVal:
+		e.buf = append(e.buf, tagInt)
+		e.buf = binary.AppendVarint(e.buf, v.Value)
+	case *values.FloatVal:
+		e.buf = append(e.buf, tagFloat)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v.Value))
+	case *values.StringVal:
+		e.buf = append(e.buf, tagString)
+		e.string(v.Value)
+	case *values.BoolVal:
+		b := byte(0)
+		if v.Value {
+			b = 1
+		}
+		e.buf = append(e.buf, tagBool, b)
+	case *values.NoneVal:
+		e.buf = append(e.buf, tagNone)
+	case *values.ArrayVal:
+		e.buf = append(e.buf, tagArray)
+		e.uvarint(len(v.Elements))
+		for _, element := range v.Elements {
+			e.constant(element)
+		}
+	case *values.StructTypeVal:
+		e.buf = append(e.buf, tagStruct)
+		e.string(v.Name)
+		e.strings(v.Fields)
+	case *values.EnumTypeVal:
+		e.buf = append(e.buf, tagEnum)
+		e.string(v.Name)
+		e.uvarint(len(v.Variants))
+		for _, variant := range v.Variants {
+			e.string(variant.Name)
+			e.strings(variant.Fields)
+		}
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("cannot encode a constant of type %s", v.GetType())
+		}
+	}
+}
+
+func (e *encoder) pattern(p *Pattern) {
+	e.buf = append(e.buf, byte(p.Kind))
+	switch p.Kind {
+	case PatternLiteral:
+		e.constant(p.Literal)
+	case PatternVariant:
+		e.string(p.Enum)
+		e.string(p.Variant)
+		e.uvarint(len(p.Fields))
+		for i := range p.Fields {
+			e.pattern(&p.Fields[i])
+		}
+	}
+}
+
+// Decode reads a program in the .blc format. Besides the version and the
+// checksum it checks that every instruction is complete and only refers to
+// constants, functions, patterns and code that exist, so the vm can run the
+// program without checking again.
+func Decode(data []byte) (*Program, error) {
+	if len(data) < len(magic) || string(data[:len(magic)]) != magic {
+		return nil, ErrNotBytecode
+	}
+	if len(data) < headerSize {
+		return nil, malformed("the header is truncated")
+	}
+	if version := binary.BigEndian.Uint16(data[4:]); version != FormatVersion {
+		return nil, fmt.Errorf("bytecode version %d is not supported, expected version %d: build the file again", version, FormatVersion)
+	}
+
+	body := data[headerSize:]
+	if length := binary.BigEndian.Uint32(data[6:]); uint64(len(body)) != uint64(length) {
+		return nil, malformed("the header gives a length of %d bytes, the file has %d", length, len(body))
+	}
+	if binary.BigEndian.Uint32(data[10:]) != crc32.ChecksumIEEE(body) {
+		return nil, malformed("checksum mismatch, the file is corrupt")
+	}
+
+	d := &decoder{data: body}
+	program := &Program{Source: d.string()}
+	program.Functions = make([]*Function, d.count())
+	for i := range program.Functions {
+		program.Functions[i] = d.function()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.pos != len(d.data) {
+		return nil, malformed("%d unexpected bytes at the end", len(d.data)-d.pos)
+	}
+
+	if err := verify(program); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+func malformed(format string, args ...any) error {
+	return fmt.Errorf("malformed bytecode: "+format, args...)
+}
+
+// decoder reads the body of a .blc file. The first error sticks, the
+// methods return zero values from then on.
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = malformed("byte %d: %s", headerSize+d.pos, fmt.Sprintf(format, args...))
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.data) {
+		d.fail("unexpected end of the file")
+		return 0
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("invalid number")
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+// number reads an unsigned varint that is at most max.
+func (d *decoder) number(what string, max int) int {
+	v := d.uvarint()
+	if v > uint64(max) {
+		d.fail("%s %d is out of range", what, v)
+		return 0
+	}
+	return int(v)
+}
+
+// count reads the length of a list. Every element takes at least a byte, so
+// a count larger than what is left of the file is an error rather than a
+// huge allocation.
+func (d *decoder) count() int {
+	v := d.uvarint()
+	if v > uint64(len(d.data)-d.pos) {
+		d.fail("count %d is out of range", v)
+		return 0
+	}
+	return int(v)
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data)-d.pos {
+		d.fail("unexpected end of the file")
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.data[d.pos:])
+	d.pos += n
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(d.count()))
+}
+
+func (d *decoder) strings() []string {
+	ss := make([]string, d.count())
+	for i := range ss {
+		ss[i] = d.string()
+	}
+	return ss
+}
+
+func (d *decoder) function() *Function {
+	fn := &Function{Name: d.string(), Arity: d.number("arity", math.MaxUint8)}
+	fn.Upvalues = make([]Upvalue, d.count())
+	for i := range fn.Upvalues {
+		local := d.byte()
+		if local > 1 {
+			d.fail("invalid upvalue kind %d", local)
+		}
+		fn.Upvalues[i] = Upvalue{Local: local == 1, Index: d.number("upvalue index", math.MaxUint16)}
+	}
+
+	fn.Code = d.bytes(d.count())
+
+	fn.Constants = make([]values.RtVal, d.count())
+	for i := range fn.Constants {
+		fn.Constants[i] = d.constant()
+	}
+
+	fn.Patterns = make([]Pattern, d.count())
+	for i := range fn.Patterns {
+		fn.Patterns[i] = d.pattern()
+	}
+
+	fn.Spans = make([]SpanEntry, d.count())
+	offset := 0
+	for i := range fn.Spans {
+		offset += d.number("code offset", len(fn.Code))
+		fn.Spans[i] = SpanEntry{Offset: offset, Span: utils.Span{
+			Start: utils.Position{Line: d.number("line", math.MaxInt32), Column: d.number("column", math.MaxInt32)},
+			End:   utils.Position{Line: d.number("line", math.MaxInt32), Column: d.number("column", math.MaxInt32)},
+		}}
+	}
+	return fn
+}
+
+func (d *decoder) constant() values.RtVal {
+	switch tag := d.byte(); tag {
+	case tagInt:
+		if d.err != nil {
+			return nil
+		}
+		v, n := binary.Varint(d.data[d.pos:])
+		if n <= 0 {
+			d.fail("invalid number")
+			return nil
+		}
+		d.pos += n
+		return &values.IntVal{Type: values.IntValue, Value: v}
+	case tagFloat:
+		b := d.bytes(min(8, len(d.data)-d.pos))
+		if len(b) < 8 {
+			d.fail("unexpected end of the file")
+			return nil
+		}
+		return &values.FloatVal{Type: values.FloatValue, Value: math.Float64frombits(binary.BigEndian.Uint64(b))}
+	case tagString:
+		return &values.StringVal{Type: values.StringValue, Value: d.string()}
+	case tagBool:
+		b := d.byte()
+		if b > 1 {
+			d.fail("invalid Bool %d", b)
+		}
+		return &values.BoolVal{Type: values.BoolValue, Value: b == 1}
+	case tagNone:
+		return &values.NoneVal{Type: values.NoneValue}
+	case tagArray:
+		elements := make([]values.RtVal, d.count())
+		for i := range elements {
+			elements[i] = d.constant()
+		}
+		return &values.ArrayVal{Type: values.ArrayValue, Elements: elements}
+	case tagStruct:
+		return &values.StructTypeVal{Type: values.StructType, Name: d.string(), Fields: d.strings()}
+	case tagEnum:
+		enum := &values.EnumTypeVal{Type: values.EnumType, Name: d.string()}
+		enum.Variants = make([]values.VariantDef, d.count())
+		for i := range enum.Variants {
+			enum.Variants[i] = values.VariantDef{Name: d.string(), Fields: d.strings()}
+		}
+		return enum
+	default:
+		d.fail("unknown constant tag %d", tag)
+		return nil
+	}
+}
+
+func (d *decoder) pattern() Pattern {
+	p := Pattern{Kind: PatternKind(d.byte())}
+	switch p.Kind {
+	case PatternWildcard, PatternBinding:
+	case PatternLiteral:
+		p.Literal = d.constant()
+	case PatternVariant:
+		p.Enum, p.Variant = d.string(), d.string()
+		p.Fields = make([]Pattern, d.count())
+		for i := range p.Fields {
+			p.Fields[i] = d.pattern()
+		}
+	default:
+		d.fail("unknown pattern kind %d", p.Kind)
+	}
+	return p
+}
+
+// verify checks what the compiler guarantees about the code of a program
+// that was read from a file.
+func verify(program *Program) error {
+	if len(program.Functions) == 0 {
+		return malformed("the program has no code")
+	}
+	if script := program.Functions[0]; script.Arity != 0 || len(script.Upvalues) != 0 {
+		return malformed("the top level code has parameters or upvalues")
+	}
+
+	for i, fn := range program.Functions {
+		if err := verifyFunction(program, fn); err != nil {
+			return malformed("function %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func verifyFunction(program *Program, fn *Function) error {
+	// Find where the instructions start, so jumps can be checked to land on
+	// one
+	starts := make([]bool, len(fn.Code))
+	last := OpReturn
+	for offset := 0; offset < len(fn.Code); offset += last.Size() {
+		last = Op(fn.Code[offset])
+		if !last.Valid() {
+			return fmt.Errorf("unknown instruction %d at offset %d", last, offset)
+		}
+		if offset+last.Size() > len(fn.Code) {
+			return fmt.Errorf("truncated %s instruction at offset %d", last, offset)
+		}
+		starts[offset] = true
+	}
+	if len(fn.Code) == 0 || last != OpReturn {
+		return errors.New("the code does not end with a return")
+	}
+
+	for offset := 0; offset < len(fn.Code); {
+		op, operands, next := fn.instruction(offset)
+		if err := verifyOperands(program, fn, op, operands, next, starts); err != nil {
+			return fmt.Errorf("%s at offset %d: %v", op, offset, err)
+		}
+		offset = next
+	}
+	if err := verifyStack(program, fn); err != nil {
+		return err
+	}
+
+	for i := 1; i < len(fn.Spans); i++ {
+		if fn.Spans[i].Offset < fn.Spans[i-1].Offset {
+			return errors.New("the line table is out of order")
+		}
+	}
+	return nil
+}
+
+// instruction decodes the instruction at offset, returning its operands and
+// where the next one starts.
+func (fn *Function) instruction(offset int) (Op, []int, int) {
+	op := Op(fn.Code[offset])
+	operands := make([]int, len(op.Operands()))
+	next := offset + 1
+	for i, width := range op.Operands() {
+		operands[i] = int(fn.Code[next])
+		if width == 2 {
+			operands[i] = fn.ReadU16(next)
+		}
+		next += width
+	}
+	return op, operands, next
+}
+
+// verifyStack follows every path through the code of fn to work out how many
+// values the frame has on the stack before each instruction. The paths must
+// agree on it, and no instruction may take more values or use a slot above
+// them, so a file can not make the vm reach outside of the frame.
+func verifyStack(program *Program, fn *Function) error {
+	heights := make([]int, len(fn.Code))
+	for i := range heights {
+		heights[i] = -1
+	}
+
+	var work []int
+	reach := func(offset int, height int) error {
+		switch heights[offset] {
+		case -1:
+			heights[offset] = height
+			work = append(work, offset)
+		case height:
+		default:
+			return fmt.Errorf("the stack holds %d values at offset %d on one path and %d on another", heights[offset], offset, height)
+		}
+		return nil
+	}
+	if err := reach(0, fn.Arity); err != nil {
+		return err
+	}
+
+	for len(work) > 0 {
+		offset := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		op, operands, next := fn.instruction(offset)
+		height := heights[offset]
+		inputs, effect := stackInputs(op, operands), stackEffect(op, operands)
+		if op == OpStruct {
+			fields := len(fn.Constants[operands[0]].(*values.ArrayVal).Elements)
+			inputs, effect = fields+1, -fields
+		}
+		if inputs > height {
+			return fmt.Errorf("%s at offset %d takes %d values, the stack holds %d", op, offset, inputs, height)
+		}
+
+		var slots []int
+		switch op {
+		case OpGetLocal, OpSetLocal, OpNoMatch, OpNext:
+			slots = operands[:1]
+		case OpMatch:
+			slots = operands[1:]
+		case OpClosure:
+			for _, uv := range program.Functions[operands[0]].Upvalues {
+				if uv.Local {
+					slots = append(slots, uv.Index)
+				}
+			}
+		}
+		for _, slot := range slots {
+			if slot >= height {
+				return fmt.Errorf("%s at offset %d uses slot %d, the stack holds %d values", op, offset, slot, height)
+			}
+		}
+
+		var err error
+		switch op {
+		case OpReturn, OpNoMatch:
+		case OpJump:
+			err = reach(next+operands[0], height)
+		case OpLoop:
+			err = reach(next-operands[0], height)
+		case OpJumpIfFalse, OpJumpIfTrue:
+			if err = reach(next, height+effect); err == nil {
+				err = reach(next+operands[1], height+effect)
+			}
+		case OpNext:
+			// The loop variables are only pushed when the loop goes on
+			if err = reach(next, height+operands[1]); err == nil {
+				err = reach(next+operands[2], height)
+			}
+		case OpMatch:
+			// The bindings are only pushed when the pattern matches, which
+			// the conditional jump right after it tells apart
+			if next >= len(fn.Code) || Op(fn.Code[next]) != OpJumpIfFalse {
+				return fmt.Errorf("%s at offset %d is not followed by %s", op, offset, OpJumpIfFalse)
+			}
+			_, jumpOperands, after := fn.instruction(next)
+			if err = reach(after, height+fn.Patterns[operands[0]].bindings()); err == nil {
+				err = reach(after+jumpOperands[1], height)
+			}
+		default:
+			err = reach(next, height+effect)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindings counts the values a pattern pushes when it matches.
+func (p *Pattern) bindings() int {
+	n := 0
+	if p.Kind == PatternBinding {
+		n++
+	}
+	for i := range p.Fields {
+		n += p.Fields[i].bindings()
+	}
+	return n
+}
+
+// verifyOperands checks the operands of an instruction that ends at end.
+func verifyOperands(program *Program, fn *Function, op Op, operands []int, end int, starts []bool) error {
+	constant := func(i int) (values.RtVal, error) {
+		if i >= len(fn.Constants) {
+			return nil, fmt.Errorf("constant %d does not exist", i)
+		}
+		return fn.Constants[i], nil
+	}
+	name := func(i int) error {
+		c, err := constant(i)
+		if _, ok := c.(*values.StringVal); err == nil && !ok {
+			return fmt.Errorf("constant %d is not a name", i)
+		}
+		return err
+	}
+	target := func(target int) error {
+		if target < 0 || target >= len(starts) || !starts[target] {
+			return fmt.Errorf("jump to %d is not to an instruction", target)
+		}
+		return nil
+	}
+
+	switch op {
+	case OpConstant:
+		_, err := constant(operands[0])
+		return err
+	case OpDefineGlobal, OpGetGlobal, OpSetGlobal, OpBuiltin, OpGetField, OpSetField:
+		return name(operands[0])
+	case OpStruct:
+		c, err := constant(operands[0])
+		if err != nil {
+			return err
+		}
+		names, ok := c.(*values.ArrayVal)
+		if !ok {
+			return fmt.Errorf("constant %d is not a list of fields", operands[0])
+		}
+		for _, element := range names.Elements {
+			if _, ok := element.(*values.StringVal); !ok {
+				return fmt.Errorf("constant %d is not a list of fields", operands[0])
+			}
+		}
+	case OpGetUpvalue, OpSetUpvalue:
+		if operands[0] >= len(fn.Upvalues) {
+			return fmt.Errorf("upvalue %d does not exist", operands[0])
+		}
+	case OpClosure:
+		i := operands[0]
+		if i == 0 || i >= len(program.Functions) {
+			return fmt.Errorf("function %d does not exist", i)
+		}
+		for _, uv := range program.Functions[i].Upvalues {
+			if !uv.Local && uv.Index >= len(fn.Upvalues) {
+				return fmt.Errorf("function %d captures upvalue %d, which does not exist", i, uv.Index)
+			}
+		}
+	case OpMatch:
+		if operands[0] >= len(fn.Patterns) {
+			return fmt.Errorf("pattern %d does not exist", operands[0])
+		}
+	case OpNext:
+		if operands[1] != 1 && operands[1] != 2 {
+			return fmt.Errorf("a loop has 1 or 2 variables, not %d", operands[1])
+		}
+		return target(end + operands[2])
+	case OpJump, OpJumpIfFalse, OpJumpIfTrue:
+		return target(end + operands[len(operands)-1])
+	case OpLoop:
+		return target(end - operands[0])
+	}
+	return nil
+}
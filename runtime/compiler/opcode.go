@@ -0,0 +1,165 @@
+package compiler
+
+// Op is the first byte of an instruction. Its operands follow it, 16 bit
+// ones in big endian order. Jump offsets are always the last operand and
+// count from the end of the instruction.
+type Op byte
+
+const (
+	OpConstant     Op = iota // const u16: push a constant
+	OpNone                   // push none
+	OpTrue                   // push true
+	OpFalse                  // push false
+	OpPop                    // drop the top value
+	OpPopN                   // n u16: drop the top n values
+	OpCloseScope             // n u16: drop the n values under the top one
+	OpGetLocal               // slot u16
+	OpSetLocal               // slot u16: store the top value, leaving it on the stack
+	OpGetUpvalue             // index u16
+	OpSetUpvalue             // index u16
+	OpDefineGlobal           // name u16, constant u8: pop the value into a global
+	OpGetGlobal              // name u16
+	OpSetGlobal              // name u16
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpLessEqual
+	OpGreater
+	OpGreaterEqual
+	OpNegate
+	OpNot         // what u8
+	OpCheckBool   // what u8: fail unless the top value is a Bool
+	OpJump        // offset u16
+	OpJumpIfFalse // what u8, offset u16: pop a Bool and jump when it is false
+	OpJumpIfTrue  // what u8, offset u16
+	OpLoop        // offset u16: jump backwards
+	OpCall        // argc u8: the callee is under the arguments
+	OpBuiltin     // name u16, argc u8: call a built-in unless a global shadows it
+	OpClosure     // function u16
+	OpReturn      // return the top value to the caller
+	OpArray       // n u16: build an array from the top n values
+	OpMap         // n u16: build a map from the top n key value pairs
+	OpIndex       // object, index -> value
+	OpSetIndex    // object, index, value -> value
+	OpSlice       // bounds u8: bit 0 for a start, bit 1 for an end
+	OpStruct      // names u16: a constant array with the names of the fields
+	OpGetField    // name u16
+	OpSetField    // name u16: object, value -> value
+	OpMatch       // pattern u16, slot u16: push the bindings and true, or false
+	OpNoMatch     // slot u16: fail for the subject in slot
+	OpIter        // replace the top value with an iterator over it
+	OpNext        // slot u16, names u8, offset u16: push the next key and value, or jump when done
+)
+
+// opInfo describes the encoding of an instruction.
+type opInfo struct {
+	name     string
+	operands []int // width in bytes of each operand
+}
+
+var opInfos = [...]opInfo{
+	OpConstant:     {"CONSTANT", []int{2}},
+	OpNone:         {"NONE", nil},
+	OpTrue:         {"TRUE", nil},
+	OpFalse:        {"FALSE", nil},
+	OpPop:          {"POP", nil},
+	OpPopN:         {"POP_N", []int{2}},
+	OpCloseScope:   {"CLOSE_SCOPE", []int{2}},
+	OpGetLocal:     {"GET_LOCAL", []int{2}},
+	OpSetLocal:     {"SET_LOCAL", []int{2}},
+	OpGetUpvalue:   {"GET_UPVALUE", []int{2}},
+	OpSetUpvalue:   {"SET_UPVALUE", []int{2}},
+	OpDefineGlobal: {"DEFINE_GLOBAL", []int{2, 1}},
+	OpGetGlobal:    {"GET_GLOBAL", []int{2}},
+	OpSetGlobal:    {"SET_GLOBAL", []int{2}},
+	OpAdd:          {"ADD", nil},
+	OpSub:          {"SUB", nil},
+	OpMul:          {"MUL", nil},
+	OpDiv:          {"DIV", nil},
+	OpMod:          {"MOD", nil},
+	OpEqual:        {"EQUAL", nil},
+	OpNotEqual:     {"NOT_EQUAL", nil},
+	OpLess:         {"LESS", nil},
+	OpLessEqual:    {"LESS_EQUAL", nil},
+	OpGreater:      {"GREATER", nil},
+	OpGreaterEqual: {"GREATER_EQUAL", nil},
+	OpNegate:       {"NEGATE", nil},
+	OpNot:          {"NOT", []int{1}},
+	OpCheckBool:    {"CHECK_BOOL", []int{1}},
+	OpJump:         {"JUMP", []int{2}},
+	OpJumpIfFalse:  {"JUMP_IF_FALSE", []int{1, 2}},
+	OpJumpIfTrue:   {"JUMP_IF_TRUE", []int{1, 2}},
+	OpLoop:         {"LOOP", []int{2}},
+	OpCall:         {"CALL", []int{1}},
+	OpBuiltin:      {"BUILTIN", []int{2, 1}},
+	OpClosure:      {"CLOSURE", []int{2}},
+	OpReturn:       {"RETURN", nil},
+	OpArray:        {"ARRAY", []int{2}},
+	OpMap:          {"MAP", []int{2}},
+	OpIndex:        {"INDEX", nil},
+	OpSetIndex:     {"SET_INDEX", nil},
+	OpSlice:        {"SLICE", []int{1}},
+	OpStruct:       {"STRUCT", []int{2}},
+	OpGetField:     {"GET_FIELD", []int{2}},
+	OpSetField:     {"SET_FIELD", []int{2}},
+	OpMatch:        {"MATCH", []int{2, 2}},
+	OpNoMatch:      {"NO_MATCH", []int{2}},
+	OpIter:         {"ITER", nil},
+	OpNext:         {"NEXT", []int{2, 1, 2}},
+}
+
+// Valid reports whether op is a known instruction.
+func (op Op) Valid() bool {
+	return int(op) < len(opInfos)
+}
+
+func (op Op) String() string {
+	if !op.Valid() {
+		return "UNKNOWN"
+	}
+	return opInfos[op].name
+}
+
+// Operands returns the width in bytes of each operand of op.
+func (op Op) Operands() []int {
+	return opInfos[op].operands
+}
+
+// Size returns the length of an instruction, opcode included.
+func (op Op) Size() int {
+	size := 1
+	for _, width := range opInfos[op].operands {
+		size += width
+	}
+	return size
+}
+
+// Conditions names the constructs that test a Bool, indexed by the what
+// operand of OpNot, OpCheckBool and the conditional jumps. They end up in
+// the error when the value is not a Bool.
+var Conditions = [...]string{
+	condIf:         "if",
+	condWhile:      "while",
+	condFor:        "for",
+	condAnd:        "&&",
+	condOr:         "||",
+	condNot:        "!",
+	condMatch:      "match",
+	condMatchGuard: "match guard",
+}
+
+const (
+	condIf = iota
+	condWhile
+	condFor
+	condAnd
+	condOr
+	condNot
+	condMatch
+	condMatchGuard
+)
@@ -1,85 +1,152 @@
 package environment
 
 import (
-	"berlang/frontend/ast"
 	"berlang/runtime/values"
 	"fmt"
+	"maps"
+	"sort"
 )
 
-type EvalInterface interface {
-	Evaluate(stmt ast.Stmt) (values.RtVal, error)
-}
+// Environment holds the local variables of a scope while it runs, in the
+// slots the resolver gave them. Globals live apart, in Globals.
 type Environment struct {
-	parent    *Environment
-	variables map[string]Variable
+	parent *Environment
+	slots  []Variable
 }
 
-// Create a variable type that stores map[name]variable which has the const/let type and the value
+// Create a variable type that stores the value together with the const/let type
 type Variable struct {
-    value values.RtVal
-    // isConst bool
-    varType string
+	value values.RtVal
+	// varType is either let or const
+	varType string
+	// valType is the declared type of the value
+	valType string
 }
 
-func NewVariable(value values.RtVal, varType string) Variable {
-    return Variable{value: value, varType: varType}
+func NewVariable(value values.RtVal, varType string, valType string) Variable {
+	return Variable{value: value, varType: varType, valType: valType}
 }
 
-func NewEnvironment(parent *Environment) Environment {
-	return Environment{parent: parent, variables: make(map[string]Variable)}
+func (v Variable) Value() values.RtVal { return v.value }
+func (v Variable) VarType() string     { return v.varType }
+func (v Variable) ValType() string     { return v.valType }
+
+func NewEnvironment(parent *Environment) *Environment {
+	return &Environment{parent: parent}
 }
 
-func (env *Environment) Resolve(ident *ast.Identifier) (values.RtVal, error) {
-	fmt.Printf("Trying to resolve variable %v\n", ident.Name)
-	fmt.Printf("Current env variables %v\n", env.variables)
+// Parent returns the enclosing environment, nil for the top level one.
+func (env *Environment) Parent() *Environment {
+	return env.parent
+}
 
-	if env.variables == nil {
-		fmt.Println("There is no variables in this environment, looking to the parent")
-		return env.parent.Resolve(ident)
+// ancestor returns the environment depth levels out from env.
+func (env *Environment) ancestor(depth int) *Environment {
+	for ; depth > 0 && env != nil; depth-- {
+		env = env.parent
 	}
-	if variable, found := env.variables[ident.Name]; found {
-		return variable.value, nil
+	return env
+}
+
+// Define binds the variable in slot of this environment. Declarations run
+// in order, so slot is usually the next free one.
+func (env *Environment) Define(slot int, val values.RtVal, varType string, valType string) {
+	for len(env.slots) <= slot {
+		env.slots = append(env.slots, Variable{})
 	}
-	if env.parent != nil {
-		return env.parent.Resolve(ident)
+	env.slots[slot] = NewVariable(val, varType, valType)
+}
+
+// Resolve returns the value in slot of the environment depth levels out,
+// name is only used in the error.
+func (env *Environment) Resolve(name string, depth int, slot int) (values.RtVal, error) {
+	owner := env.ancestor(depth)
+	if owner == nil || slot >= len(owner.slots) {
+		return nil, fmt.Errorf("identifier '%s' not found", name)
+	}
+	return owner.slots[slot].value, nil
+}
+
+// Assign stores val in slot of the environment depth levels out.
+func (env *Environment) Assign(name string, depth int, slot int, val values.RtVal) error {
+	owner := env.ancestor(depth)
+	if owner == nil || slot >= len(owner.slots) {
+		return fmt.Errorf("variable '%s' not found", name)
 	}
-	return nil, fmt.Errorf("identifier '%s' not found", ident.Name)
+	return assign(&owner.slots[slot], name, val)
 }
 
-func (env *Environment) DeclareVar(decl *ast.VarDecl, r EvalInterface) (values.RtVal, error) {
-	if decl.Value == nil {
-        println("Requested to declare a None variable")
-		val := &values.NoneVal{}
-		env.variables[decl.Name] = NewVariable(val, decl.ValType)
-		return val, nil
+func assign(variable *Variable, name string, val values.RtVal) error {
+	if variable.varType == "const" {
+		return fmt.Errorf("variable '%s' is a constant and cannot be reassigned", name)
 	}
+	variable.value = val
+	return nil
+}
+
+// Globals holds the variables declared at the top level of a program. They
+// are kept by name, so the programs run after it can use them.
+type Globals struct {
+	variables map[string]Variable
+}
+
+func NewGlobals() *Globals {
+	return &Globals{variables: make(map[string]Variable)}
+}
+
+// Has reports whether name is declared.
+func (g *Globals) Has(name string) bool {
+	_, found := g.variables[name]
+	return found
+}
 
-	val, err := r.Evaluate(*decl.Value)
-	if err != nil {
-		return nil, err
+func (g *Globals) Resolve(name string) (values.RtVal, error) {
+	if variable, found := g.variables[name]; found {
+		return variable.value, nil
 	}
-	env.variables[decl.Name] = NewVariable(val, decl.ValType)
+	return nil, fmt.Errorf("identifier '%s' not found", name)
+}
 
-	return val, nil
+// Define binds name to an already evaluated value, replacing any global of
+// the same name.
+func (g *Globals) Define(name string, val values.RtVal, varType string, valType string) {
+	g.variables[name] = NewVariable(val, varType, valType)
 }
 
-func (env *Environment) AssignVar(assign *ast.VarAssign, r EvalInterface) (values.RtVal, error) {
-    val, err := r.Evaluate(*assign.Value)
-    if err != nil {
-        return nil, err
-    }
-    if _, found := env.variables[assign.Name]; !found {
-        return nil, fmt.Errorf("variable '%s' not found", assign.Name)
-    }
+func (g *Globals) Assign(name string, val values.RtVal) error {
+	variable, found := g.variables[name]
+	if !found {
+		return fmt.Errorf("variable '%s' not found", name)
+	}
+	if err := assign(&variable, name, val); err != nil {
+		return err
+	}
+	g.variables[name] = variable
+	return nil
+}
 
-    // Check if the variable is a constant
-    if env.variables[assign.Name].varType == "const" {
-        return nil, fmt.Errorf("variable '%s' is a constant and cannot be reassigned", assign.Name)
-    }
+// Snapshot returns a copy of the globals for Restore to put back, so the
+// declarations and assignments of a program that failed can be undone. The
+// changes it made inside arrays, maps and structs are kept.
+func (g *Globals) Snapshot() map[string]Variable {
+	return maps.Clone(g.variables)
+}
 
-    env.variables[assign.Name] = NewVariable(val, "let")
+func (g *Globals) Restore(snapshot map[string]Variable) {
+	g.variables = snapshot
+}
 
-    return val, nil
+// Each calls fn for every global, in name order.
+func (g *Globals) Each(fn func(name string, v Variable)) {
+	names := make([]string, 0, len(g.variables))
+	for name := range g.variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fn(name, g.variables[name])
+	}
 }
 
 // TODO Keeping in mind to have RAII in berlang, we need to pass the variables into the child context (as value),
@@ -0,0 +1,41 @@
+package interpreter
+
+import (
+	"berlang/frontend/ast"
+	"berlang/runtime/ops"
+	"berlang/runtime/values"
+)
+
+func (r *Runtime) evalArrayLiteral(lit *ast.ArrayLiteral) (values.RtVal, error) {
+	elements := make([]values.RtVal, len(lit.Elements))
+	for i, element := range lit.Elements {
+		var err error
+		if elements[i], err = r.eval(element); err != nil {
+			return nil, err
+		}
+	}
+	return ops.NewArray(elements), nil
+}
+
+// evalIndexAssign evaluates a[i] = v for arrays and maps.
+func (r *Runtime) evalIndexAssign(assign *ast.IndexAssign) (values.RtVal, error) {
+	object, err := r.eval(assign.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := r.eval(assign.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := r.eval(assign.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ops.SetIndex(object, index, val); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
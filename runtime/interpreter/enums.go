@@ -0,0 +1,95 @@
+package interpreter
+
+import (
+	"berlang/frontend/ast"
+	"berlang/runtime/environment"
+	"berlang/runtime/ops"
+	"berlang/runtime/values"
+	"fmt"
+)
+
+func (r *Runtime) evalEnumDecl(decl *ast.EnumDecl) (values.RtVal, error) {
+	def := ops.EnumType(decl)
+	r.define(decl, decl.Name, def, "const", "enum")
+	return def, nil
+}
+
+// evalMatchExpr tries the arms in order. The names bound by a pattern live in
+// an environment of their own that the guard and the body are evaluated in.
+func (r *Runtime) evalMatchExpr(match *ast.MatchExpr) (values.RtVal, error) {
+	subject, err := r.eval(match.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	parent := r.CurEnv
+	defer func() { r.CurEnv = parent }()
+
+	for _, arm := range match.Arms {
+		r.CurEnv = environment.NewEnvironment(parent)
+
+		matched, err := r.matchPattern(arm.Pattern, subject)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+
+		if arm.Guard != nil {
+			if matched, err = r.evalCondition(arm.Guard, "match guard"); err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+		}
+		return r.eval(arm.Body)
+	}
+	return nil, fmt.Errorf("no arm of the match matched %s", subject)
+}
+
+// matchPattern reports whether val matches pattern and binds the names in
+// the pattern in the current environment.
+func (r *Runtime) matchPattern(pattern ast.Pattern, val values.RtVal) (bool, error) {
+	switch p := pattern.(type) {
+	case *ast.WildcardPattern:
+		return true, nil
+
+	case *ast.BindingPattern:
+		r.define(p, p.Name, val, "let", "")
+		return true, nil
+
+	case *ast.LiteralPattern:
+		lit, err := r.eval(p.Value)
+		if err != nil {
+			return false, err
+		}
+
+		return ops.MatchLiteral(lit, val)
+
+	case *ast.VariantPattern:
+		def, err := r.lookup(p, p.Enum)
+		if err != nil {
+			return false, err
+		}
+		if _, ok := def.(*values.EnumTypeVal); !ok {
+			return false, fmt.Errorf("'%s' is not an enum", p.Enum)
+		}
+
+		ev, err := ops.MatchVariant(p.Enum, p.Variant, len(p.Fields), val)
+		if ev == nil || err != nil {
+			return false, err
+		}
+
+		for i, field := range p.Fields {
+			if matched, err := r.matchPattern(field, ev.Fields[i]); err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+
+	default:
+		return false, fmt.Errorf("unrecognized pattern %s", pattern.GetKind())
+	}
+}
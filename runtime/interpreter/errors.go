@@ -0,0 +1,23 @@
+package interpreter
+
+import (
+	"berlang/diagnostics"
+	"berlang/frontend/ast"
+	"errors"
+)
+
+// wrapRuntimeError turns err into a diagnostic at the span of node. Errors
+// that already are diagnostics come from a node deeper in the tree and are
+// left alone, as are the signals used for break, continue and return.
+func wrapRuntimeError(err error, node ast.Node) error {
+	switch err.(type) {
+	case breakSignal, continueSignal, returnSignal:
+		return err
+	}
+
+	var d *diagnostics.Diagnostic
+	if errors.As(err, &d) {
+		return err
+	}
+	return diagnostics.Errorf(diagnostics.CodeRuntime, node.GetSpan(), "%v", err)
+}
@@ -2,20 +2,66 @@ package interpreter
 
 import (
 	"berlang/frontend/ast"
+	"berlang/frontend/resolver"
 	"berlang/runtime/environment"
+	"berlang/runtime/ops"
 	"berlang/runtime/values"
+	"berlang/trace"
 	"fmt"
-	"strconv"
+	"io"
+	"log/slog"
 )
 
+// maxCallDepth bounds recursion so runaway programs fail with an error
+// instead of exhausting the Go stack.
+const maxCallDepth = 10000
+
 type Runtime struct {
 	// TODO maybe we can handle this differently
 	// this is not good for multithreading
-	CurEnv environment.Environment
+	CurEnv  *environment.Environment
+	Globals *environment.Globals
+	// natives are the built-ins that write to the output, used when no
+	// global of the same name is declared
+	natives   map[string]*values.NativeFuncVal
+	callDepth int
+	// steps counts the loop iterations and calls of the program being
+	// evaluated, stepLimit bounds them when it is not 0
+	steps     int
+	stepLimit int
+	tracer    trace.Tracer
+}
+
+// NewRuntime creates a runtime whose programs print to out.
+func NewRuntime(out io.Writer) Runtime {
+	return Runtime{
+		CurEnv:  environment.NewEnvironment(nil),
+		Globals: environment.NewGlobals(),
+		natives: ops.Natives(out),
+		tracer:  trace.Discard,
+	}
 }
 
-func NewRuntime() Runtime {
-	return Runtime{environment.NewEnvironment(nil)}
+// SetStepLimit makes Evaluate fail once a program has run more than limit
+// loop iterations and calls together, so programs that never stop can not
+// hold the runtime forever. 0 means no limit.
+func (r *Runtime) SetStepLimit(limit int) {
+	r.stepLimit = limit
+}
+
+// step counts a loop iteration or a call against the step limit.
+func (r *Runtime) step() error {
+	r.steps++
+	if r.stepLimit > 0 && r.steps > r.stepLimit {
+		return fmt.Errorf("step limit of %d exceeded, the program ran too long", r.stepLimit)
+	}
+	return nil
+}
+
+// SetTracer makes the runtime report the calls it makes and the value of
+// every node it evaluates to t.
+func (r *Runtime) SetTracer(t trace.Tracer) {
+	r.tracer = t
 }
 
 func (r *Runtime) evalProgramType(p *ast.Program) (values.RtVal, error) {
@@ -24,87 +70,468 @@ func (r *Runtime) evalProgramType(p *ast.Program) (values.RtVal, error) {
 
 	for _, stmt := range p.Body {
 		var err error
-		lastEvaluated, err = r.Evaluate(stmt)
+		lastEvaluated, err = r.eval(stmt)
 		if err != nil {
 			return nil, err
 		}
 	}
 	return lastEvaluated, nil
 }
-func (r *Runtime) evalNumericVal(nl *ast.NumericLiteral) (values.RtVal, error) {
 
-	casted, err := strconv.ParseFloat(nl.Value, 64)
+// evalBlockStmt runs the statements of a block in a child environment, so
+// everything declared inside is dropped when the block ends.
+func (r *Runtime) evalBlockStmt(b *ast.BlockStmt) (values.RtVal, error) {
+	parent := r.CurEnv
+	r.CurEnv = environment.NewEnvironment(parent)
+	defer func() { r.CurEnv = parent }()
+
+	var lastEvaluated values.RtVal = ops.NewNone()
+	for _, stmt := range b.Body {
+		var err error
+		lastEvaluated, err = r.eval(stmt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return lastEvaluated, nil
+}
+
+func (r *Runtime) evalIfStmt(i *ast.IfStmt) (values.RtVal, error) {
+	condition, err := r.evalCondition(i.Condition, "if")
 	if err != nil {
 		return nil, err
 	}
-	return &values.NumVal{Value: casted, Type: values.NumberValue}, nil
+
+	if condition {
+		return r.evalBlockStmt(i.Then)
+	}
+	if i.Else != nil {
+		return r.eval(i.Else)
+	}
+	return ops.NewNone(), nil
 }
 
-func (r *Runtime) evalNumericBinaryExpr(lhs *values.NumVal, rhs *values.NumVal, op string) (values.RtVal, error) {
-	switch op {
-	case "+":
-		return &values.NumVal{Value: lhs.Value + rhs.Value, Type: values.NumberValue}, nil
-	case "-":
-		return &values.NumVal{Value: lhs.Value - rhs.Value, Type: values.NumberValue}, nil
-	case "*":
-		return &values.NumVal{Value: lhs.Value * rhs.Value, Type: values.NumberValue}, nil
-	case "/":
-		if rhs.Value == 0 {
-			return nil, fmt.Errorf("division by zero")
+// breakSignal and continueSignal unwind the evaluation from a break or continue
+// statement up to the closest loop, travelling through the error return. The
+// parser rejects them outside of loops so they never reach the user.
+type breakSignal struct{}
+
+func (breakSignal) Error() string { return "break outside of a loop" }
+
+type continueSignal struct{}
+
+func (continueSignal) Error() string { return "continue outside of a loop" }
+
+// runLoopBody evaluates one iteration and reports whether the loop should stop.
+func (r *Runtime) runLoopBody(body *ast.BlockStmt) (bool, error) {
+	if err := r.step(); err != nil {
+		return true, err
+	}
+
+	_, err := r.evalBlockStmt(body)
+	switch err.(type) {
+	case nil, continueSignal:
+		return false, nil
+	case breakSignal:
+		return true, nil
+	default:
+		return true, err
+	}
+}
+
+func (r *Runtime) evalWhileStmt(w *ast.WhileStmt) (values.RtVal, error) {
+	for {
+		condition, err := r.evalCondition(w.Condition, "while")
+		if err != nil {
+			return nil, err
+		}
+		if !condition {
+			break
+		}
+
+		stop, err := r.runLoopBody(w.Body)
+		if err != nil {
+			return nil, err
+		}
+		if stop {
+			break
+		}
+	}
+	return ops.NewNone(), nil
+}
+
+// evalForStmt runs a for loop in its own environment, so the variable declared
+// by the init clause is dropped with the loop.
+func (r *Runtime) evalForStmt(f *ast.ForStmt) (values.RtVal, error) {
+	parent := r.CurEnv
+	r.CurEnv = environment.NewEnvironment(parent)
+	defer func() { r.CurEnv = parent }()
+
+	if f.Init != nil {
+		if _, err := r.eval(f.Init); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		if f.Condition != nil {
+			condition, err := r.evalCondition(f.Condition, "for")
+			if err != nil {
+				return nil, err
+			}
+			if !condition {
+				break
+			}
+		}
+
+		stop, err := r.runLoopBody(f.Body)
+		if err != nil {
+			return nil, err
+		}
+		if stop {
+			break
+		}
+
+		if f.Update != nil {
+			if _, err := r.eval(f.Update); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ops.NewNone(), nil
+}
+
+// returnSignal carries the value of a return statement up to the call that
+// is being evaluated.
+type returnSignal struct {
+	value values.RtVal
+}
+
+func (returnSignal) Error() string { return "return outside of a function" }
+
+func (r *Runtime) evalFunctionDecl(f *ast.FunctionDecl) (values.RtVal, error) {
+	fn := &values.FunctionVal{
+		Type:       values.FunctionValue,
+		Name:       f.Name,
+		Params:     f.Params,
+		ReturnType: f.ReturnType,
+		Body:       f.Body,
+		Env:        r.CurEnv,
+	}
+	r.define(f, f.Name, fn, "const", "fn")
+	return fn, nil
+}
+
+// evalFunctionLiteral creates a closure. It keeps a reference to the current
+// environment, not a copy, so later changes to captured variables are seen by
+// the closure and the other way around.
+func (r *Runtime) evalFunctionLiteral(f *ast.FunctionLiteral) (values.RtVal, error) {
+	return &values.FunctionVal{
+		Type:       values.FunctionValue,
+		Params:     f.Params,
+		ReturnType: f.ReturnType,
+		Body:       f.Body,
+		Env:        r.CurEnv,
+	}, nil
+}
+
+func (r *Runtime) evalReturnStmt(ret *ast.ReturnStmt) (values.RtVal, error) {
+	if ret.Value == nil {
+		return nil, returnSignal{value: ops.NewNone()}
+	}
+
+	val, err := r.eval(ret.Value)
+	if err != nil {
+		return nil, err
+	}
+	return nil, returnSignal{value: val}
+}
+
+func (r *Runtime) evalCallExpr(call *ast.CallExpr) (values.RtVal, error) {
+	// Built-ins can be shadowed by declarations of the same name
+	var builtin ops.Builtin
+	if ident, ok := call.Callee.(*ast.Identifier); ok && ident.Binding.Global && !r.Globals.Has(ident.Name) {
+		builtin = ops.Builtins[ident.Name]
+	}
+
+	var callee values.RtVal
+	if builtin == nil {
+		var err error
+		if callee, err = r.eval(call.Callee); err != nil {
+			return nil, err
+		}
+	}
+
+	args := make([]values.RtVal, len(call.Args))
+	for i, arg := range call.Args {
+		var err error
+		if args[i], err = r.eval(arg); err != nil {
+			return nil, err
 		}
-		return &values.NumVal{Value: lhs.Value / rhs.Value, Type: values.NumberValue}, nil
+	}
+
+	if builtin != nil {
+		return builtin(r, args)
+	}
+	return r.Call(callee, args)
+}
+
+// Call calls a function or an enum constructor with already evaluated
+// arguments.
+func (r *Runtime) Call(callee values.RtVal, args []values.RtVal) (values.RtVal, error) {
+	switch callee := callee.(type) {
+	case *values.FunctionVal:
+		return r.callFunction(callee, args)
+	case *values.NativeFuncVal:
+		return callee.Fn(args)
+	case *values.ConstructorVal:
+		return ops.Construct(callee, args)
 	default:
-		return nil, fmt.Errorf("unsupported operator: %s", op)
+		return nil, fmt.Errorf("cannot call a value of type %s", callee.GetType())
 	}
 }
 
+// callFunction runs the body of fn in a new environment whose parent is the
+// one fn was declared in, with the parameters bound to args.
+func (r *Runtime) callFunction(fn *values.FunctionVal, args []values.RtVal) (values.RtVal, error) {
+	if len(args) != len(fn.Params) {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", describeFunction(fn), len(fn.Params), len(args))
+	}
+
+	if r.callDepth >= maxCallDepth {
+		return nil, fmt.Errorf("stack overflow: maximum call depth of %d exceeded", maxCallDepth)
+	}
+	if err := r.step(); err != nil {
+		return nil, err
+	}
+	r.callDepth++
+	if r.tracer.Enabled(trace.Eval) {
+		r.tracer.Event(trace.Eval, "call", fn.Body.GetSpan(),
+			slog.String("function", describeFunction(fn)), slog.Int("depth", r.callDepth))
+	}
+
+	caller := r.CurEnv
+	r.CurEnv = environment.NewEnvironment(fn.Env.(*environment.Environment))
+	defer func() {
+		r.CurEnv = caller
+		r.callDepth--
+	}()
+
+	for i, param := range fn.Params {
+		r.CurEnv.Define(i, args[i], "let", param.Type)
+	}
+
+	_, err := r.evalBlockStmt(fn.Body)
+	if ret, ok := err.(returnSignal); ok {
+		return ret.value, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ops.NewNone(), nil
+}
+
+func describeFunction(fn *values.FunctionVal) string {
+	if fn.Name == "" {
+		return "anonymous function"
+	}
+	return fmt.Sprintf("function '%s'", fn.Name)
+}
+
+func (r *Runtime) evalIndexExpr(ie *ast.IndexExpr) (values.RtVal, error) {
+	object, err := r.eval(ie.Object)
+	if err != nil {
+		return nil, err
+	}
+	index, err := r.eval(ie.Index)
+	if err != nil {
+		return nil, err
+	}
+	return ops.Index(object, index)
+}
+
+func (r *Runtime) evalSliceExpr(se *ast.SliceExpr) (values.RtVal, error) {
+	object, err := r.eval(se.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	var start, end values.RtVal
+	if se.Start != nil {
+		if start, err = r.eval(se.Start); err != nil {
+			return nil, err
+		}
+	}
+	if se.End != nil {
+		if end, err = r.eval(se.End); err != nil {
+			return nil, err
+		}
+	}
+	return ops.Slice(object, start, end)
+}
+
+// evalLogicalExpr evaluates && and ||, only evaluating the right hand side
+// when the left one does not already decide the result.
+func (r *Runtime) evalLogicalExpr(be *ast.BinaryExpr) (values.RtVal, error) {
+	lhs, err := r.evalCondition(be.Left, be.Operator)
+	if err != nil {
+		return nil, err
+	}
+
+	if be.Operator == "&&" && !lhs || be.Operator == "||" && lhs {
+		return ops.NewBool(lhs), nil
+	}
+
+	rhs, err := r.evalCondition(be.Right, be.Operator)
+	if err != nil {
+		return nil, err
+	}
+	return ops.NewBool(rhs), nil
+}
+
+// evalCondition evaluates an expression that has to produce a boolean, what
+// is used in error messages.
+func (r *Runtime) evalCondition(expr ast.Expr, what string) (bool, error) {
+	val, err := r.eval(expr)
+	if err != nil {
+		return false, err
+	}
+	return ops.Condition(val, what)
+}
+
 func (r *Runtime) evalBinaryExpr(be *ast.BinaryExpr) (values.RtVal, error) {
-	rhs, err := r.Evaluate(be.Right)
+	if be.Operator == "&&" || be.Operator == "||" {
+		return r.evalLogicalExpr(be)
+	}
+
+	lhs, err := r.eval(be.Left)
 	if err != nil {
 		return nil, err
 	}
 
-	lhs, err := r.Evaluate(be.Left)
+	rhs, err := r.eval(be.Right)
 	if err != nil {
 		return nil, err
 	}
 
-	if lhs.GetType() == values.NumberValue && rhs.GetType() == values.NumberValue {
-		result, err := r.evaluateNumeric(lhs, rhs, be.Operator)
+	return ops.Binary(be.Operator, lhs, rhs)
+}
+
+func (r *Runtime) evalUnaryExpr(ue *ast.UnaryExpr) (values.RtVal, error) {
+	if ue.Operator == "!" {
+		operand, err := r.evalCondition(ue.Operand, "!")
 		if err != nil {
 			return nil, err
 		}
-		return result, nil
+		return ops.NewBool(!operand), nil
 	}
-	return nil, fmt.Errorf("Binary expression did not evaluate to a NumericLiteral")
 
-}
+	operand, err := r.eval(ue.Operand)
+	if err != nil {
+		return nil, err
+	}
 
-func (r *Runtime) evaluateNumeric(lhs, rhs values.RtVal, operator string) (values.RtVal, error) {
-	if lhs.GetType() == values.NumberValue && rhs.GetType() == values.NumberValue {
-		return r.evalNumericBinaryExpr(lhs.(*values.NumVal), rhs.(*values.NumVal), operator)
+	if ue.Operator != "-" {
+		return nil, fmt.Errorf("unsupported unary operator: %s", ue.Operator)
 	}
-	return nil, fmt.Errorf("unsupported binary expression types: %T and %T", lhs, rhs)
+
+	return ops.Negate(operand)
 }
 
+// Evaluate resolves the variables of a program and runs it. Errors are
+// tagged with the span of the innermost node that failed, as a
+// diagnostics.Diagnostic.
 func (r *Runtime) Evaluate(stmt ast.Stmt) (values.RtVal, error) {
+	if err := resolver.Resolve(stmt); err != nil {
+		return nil, err
+	}
+
+	r.steps = 0
+	return r.eval(stmt)
+}
+
+// eval runs a single node of a resolved program.
+func (r *Runtime) eval(stmt ast.Stmt) (values.RtVal, error) {
+	val, err := r.evaluate(stmt)
+	if err != nil {
+		return nil, wrapRuntimeError(err, stmt)
+	}
+
+	if r.tracer.Enabled(trace.Eval) {
+		attrs := []slog.Attr{slog.String("node", string(stmt.GetKind()))}
+		if val != nil {
+			attrs = append(attrs, slog.String("value", val.String()))
+		}
+		r.tracer.Event(trace.Eval, "evaluated", stmt.GetSpan(), attrs...)
+	}
+	return val, nil
+}
 
+func (r *Runtime) evaluate(stmt ast.Stmt) (values.RtVal, error) {
 	switch stmt.GetKind() {
 	case ast.BinaryExprType:
 		return r.evalBinaryExpr(stmt.(*ast.BinaryExpr))
 	case ast.ProgramType:
 		return r.evalProgramType(stmt.(*ast.Program))
 	case ast.NumericLiteralType:
-		return r.evalNumericVal(stmt.(*ast.NumericLiteral))
+		return ops.Number(stmt.(*ast.NumericLiteral))
+	case ast.StringLiteralType:
+		return ops.NewString(stmt.(*ast.StringLiteral).Value), nil
+	case ast.IndexExprType:
+		return r.evalIndexExpr(stmt.(*ast.IndexExpr))
+	case ast.SliceExprType:
+		return r.evalSliceExpr(stmt.(*ast.SliceExpr))
+	case ast.BooleanLiteralType:
+		return ops.NewBool(stmt.(*ast.BooleanLiteral).Value), nil
+	case ast.BlockStmtType:
+		return r.evalBlockStmt(stmt.(*ast.BlockStmt))
+	case ast.IfStmtType:
+		return r.evalIfStmt(stmt.(*ast.IfStmt))
+	case ast.WhileStmtType:
+		return r.evalWhileStmt(stmt.(*ast.WhileStmt))
+	case ast.ForStmtType:
+		return r.evalForStmt(stmt.(*ast.ForStmt))
+	case ast.ForInStmtType:
+		return r.evalForInStmt(stmt.(*ast.ForInStmt))
+	case ast.BreakStmtType:
+		return nil, breakSignal{}
+	case ast.ContinueStmtType:
+		return nil, continueSignal{}
+	case ast.FunctionDeclType:
+		return r.evalFunctionDecl(stmt.(*ast.FunctionDecl))
+	case ast.FunctionLitType:
+		return r.evalFunctionLiteral(stmt.(*ast.FunctionLiteral))
+	case ast.ReturnStmtType:
+		return r.evalReturnStmt(stmt.(*ast.ReturnStmt))
+	case ast.CallExprType:
+		return r.evalCallExpr(stmt.(*ast.CallExpr))
+	case ast.ArrayLiteralType:
+		return r.evalArrayLiteral(stmt.(*ast.ArrayLiteral))
+	case ast.MapLiteralType:
+		return r.evalMapLiteral(stmt.(*ast.MapLiteral))
+	case ast.StructDeclType:
+		return r.evalStructDecl(stmt.(*ast.StructDecl))
+	case ast.StructLiteralType:
+		return r.evalStructLiteral(stmt.(*ast.StructLiteral))
+	case ast.FieldExprType:
+		return r.evalFieldExpr(stmt.(*ast.FieldExpr))
+	case ast.FieldAssignType:
+		return r.evalFieldAssign(stmt.(*ast.FieldAssign))
+	case ast.EnumDeclType:
+		return r.evalEnumDecl(stmt.(*ast.EnumDecl))
+	case ast.MatchExprType:
+		return r.evalMatchExpr(stmt.(*ast.MatchExpr))
+	case ast.IndexAssignType:
+		return r.evalIndexAssign(stmt.(*ast.IndexAssign))
+	case ast.UnaryExprType:
+		return r.evalUnaryExpr(stmt.(*ast.UnaryExpr))
 	case ast.IdentifierType:
-        fmt.Printf("Trying to resolve %v+\n", stmt)
-		return r.CurEnv.Resolve(stmt.(*ast.Identifier))
-    case ast.VarDeclType:
-        fmt.Println("Declaring variable")
-        return r.CurEnv.DeclareVar((stmt.(*ast.VarDecl)), r)
-    case ast.VarAssignType:
-        fmt.Println("Assigning variable")
-        return r.CurEnv.AssignVar((stmt.(*ast.VarAssign)), r)
+		ident := stmt.(*ast.Identifier)
+		return r.lookup(ident, ident.Name)
+	case ast.VarDeclType:
+		return r.evalVarDecl(stmt.(*ast.VarDecl))
+	case ast.VarAssignType:
+		return r.evalVarAssign(stmt.(*ast.VarAssign))
 	default:
 		return nil, fmt.Errorf("Unrecognized expression %+v", stmt.GetKind())
 	}
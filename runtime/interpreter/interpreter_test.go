@@ -3,11 +3,15 @@ package interpreter_test
 // Initialize the Lexer, parser and runtime for the test, and load in files from ./berlang/*.berl and test if they are valid
 
 import (
+	"berlang/diagnostics"
 	"berlang/frontend/ast"
 	"berlang/frontend/lexer"
 	"berlang/frontend/parser"
+	"berlang/frontend/types"
 	"berlang/runtime/interpreter"
 	"berlang/runtime/values"
+	"berlang/runtime/vm"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -17,18 +21,122 @@ import (
 	"testing"
 )
 
+// evaluator is what the tree walking interpreter and the bytecode vm have in
+// common, every test runs against both.
+type evaluator interface {
+	Evaluate(stmt ast.Stmt) (values.RtVal, error)
+	SetStepLimit(limit int)
+}
+
+var backends = []struct {
+	name string
+	new  func(out io.Writer) evaluator
+}{
+	{"interpreter", func(out io.Writer) evaluator {
+		runtime := interpreter.NewRuntime(out)
+		return &runtime
+	}},
+	{"vm", func(out io.Writer) evaluator { return vm.New(out) }},
+}
+
 func TestInterpreter(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			testBackend(t, func() evaluator { return backend.new(io.Discard) })
+		})
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	inputs := []string{
+		"while (true) { }",
+		"for (let i: int = 0; i >= 0; i = i + 1) { continue }",
+		"def f(n: int): int { if (n == 0) { return 0 } return f(n - 1) }\nfor (x in [1, 2, 3]) { f(500) }",
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			for _, input := range inputs {
+				runtime := backend.new(io.Discard)
+				runtime.SetStepLimit(1000)
+				_, err := runtime.Evaluate(parseString(input, t))
+				if err == nil || !strings.Contains(err.Error(), "step limit of 1000 exceeded") {
+					t.Errorf("Expected the step limit evaluating %q, got %v", input, err)
+				}
+			}
+
+			// The steps are counted per program
+			runtime := backend.new(io.Discard)
+			runtime.SetStepLimit(1000)
+			loop := parseString("let n: int = 0\nwhile (n < 600) { n = n + 1 }\nn", t)
+			for range 3 {
+				if _, err := runtime.Evaluate(loop); err != nil {
+					t.Fatalf("Error evaluating a loop under the limit: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{`print("a", 1)` + "\n" + `print(2.0, true)`, "a 12.0 true"},
+		{`println([1, 2], {"k": "v"})` + "\n" + `println()`, "[1, 2] {\"k\": \"v\"}\n\n"},
+		{`printf("%d|%5.2f|%q|%v|%s|%t%%\n", 42, 3.14159, "x", [1.0], push([0], 1), false)`, "42| 3.14|\"x\"|[1.0]|none|false%\n"},
+		{"def show(x: int) { println(\"x =\", x) }\nlet out: fn = println\nshow(1)\nout(2)", "x = 1\n2\n"},
+		{"map([1, 2], println)", "1\n2\n"},
+		{"def print(x: int): int { return x }\nprint(1)", ""},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			for _, c := range cases {
+				program := parseString(c.input, t)
+				if err := types.NewChecker().Check(program); err != nil {
+					t.Errorf("Error checking %q: %v", c.input, err)
+					continue
+				}
+
+				var out strings.Builder
+				if _, err := backend.new(&out).Evaluate(program); err != nil {
+					t.Errorf("Error evaluating %q: %v", c.input, err)
+					continue
+				}
+				if out.String() != c.expected {
+					t.Errorf("Evaluating %q: expected output %q, got %q", c.input, c.expected, out.String())
+				}
+			}
+
+			errs := map[string]string{
+				`printf("%d %d", 1)`: `printf format "%d %d" takes 2 arguments, got 1`,
+				`printf("%[1]d", 1)`: "uses [, which is not supported",
+				`printf(1)`:          "argument 1 of built-in 'printf' must be a String, got Int",
+			}
+			for input, message := range errs {
+				_, err := backend.new(io.Discard).Evaluate(parseString(input, t))
+				if err == nil || !strings.Contains(err.Error(), message) {
+					t.Errorf("Expected %q evaluating %q, got %v", message, input, err)
+				}
+			}
+		})
+	}
+}
+
+func testBackend(t *testing.T, newRuntime func() evaluator) {
 	// Have seperate tests for each case, lets start with var_decl.berl
 	t.Run("var_decl.berl", func(t *testing.T) {
 
-		runtime := interpreter.NewRuntime()
+		runtime := newRuntime()
 		parsed := parseString("let x: int = 5", t)
 		result, err := runtime.Evaluate(parsed)
 		if err != nil {
 			t.Fatalf("Error evaluating file: %v", err)
 		}
 
-		expected := values.NumVal{Value: 5, Type: values.NumberValue}
+		expected := values.IntVal{Value: 5, Type: values.IntValue}
 		if !reflect.DeepEqual(result, &expected) {
 			t.Fatalf("Expected %v, got %v", expected, result)
 		}
@@ -36,21 +144,21 @@ func TestInterpreter(t *testing.T) {
 
 	t.Run("var_assign.berl", func(t *testing.T) {
 
-		runtime := interpreter.NewRuntime()
+		runtime := newRuntime()
 		parsed := parseString("let x: int = 5\n\nx = 10", t)
 		result, err := runtime.Evaluate(parsed)
 		if err != nil {
 			t.Fatalf("Error evaluating file: %v", err)
 		}
 
-		expected := values.NumVal{Value: 10, Type: values.NumberValue}
+		expected := values.IntVal{Value: 10, Type: values.IntValue}
 		if !reflect.DeepEqual(result, &expected) {
 			t.Fatalf("Expected %v, got %v", expected, result)
 		}
 	})
 
 	t.Run("recursive_var_assign.berl", func(t *testing.T) {
-		runtime := interpreter.NewRuntime()
+		runtime := newRuntime()
 		parsed := parseString("let x: int = 5\nx = x + 5", t)
 
 		result, err := runtime.Evaluate(parsed)
@@ -58,34 +166,627 @@ func TestInterpreter(t *testing.T) {
 			t.Fatalf("Error evaluating file: %v", err)
 		}
 
-		expected := values.NumVal{Value: 10, Type: values.NumberValue}
+		expected := values.IntVal{Value: 10, Type: values.IntValue}
 		if !reflect.DeepEqual(result, &expected) {
 			t.Fatalf("Expected %v, got %v", expected, result)
 		}
 	})
 
+	t.Run("bool_decl.berl", func(t *testing.T) {
+		expectValue(t, newRuntime, "let b: bool = true\nb", &values.BoolVal{Value: true, Type: values.BoolValue})
+	})
+
+	t.Run("comparison.berl", func(t *testing.T) {
+		expectValue(t, newRuntime, "1 + 1 == 2 && 3 >= 4 == !(1 < 2)", &values.BoolVal{Value: true, Type: values.BoolValue})
+	})
+
+	t.Run("short_circuit.berl", func(t *testing.T) {
+		// The right hand sides would fail with a division by zero if evaluated
+		expectValue(t, newRuntime, "false && 1 / 0 == 1", &values.BoolVal{Value: false, Type: values.BoolValue})
+		expectValue(t, newRuntime, "true || 1 / 0 == 1", &values.BoolVal{Value: true, Type: values.BoolValue})
+	})
+
+	t.Run("unary_minus.berl", func(t *testing.T) {
+		expectValue(t, newRuntime, "3 - -2 * 2", &values.IntVal{Value: 7, Type: values.IntValue})
+	})
+
+	t.Run("logical_operand_types.berl", func(t *testing.T) {
+		runtime := newRuntime()
+		if _, err := runtime.Evaluate(parseString("1 && true", t)); err == nil {
+			t.Fatalf("Expected an error for a Number operand of &&")
+		}
+	})
+
+	t.Run("if_else.berl", func(t *testing.T) {
+		input := `
+let x: int = 5
+let y: int = 0
+if (x < 3) {
+	y = 1
+} else if (x < 10) {
+	y = 2
+} else {
+	y = 3
+}
+y`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 2, Type: values.IntValue})
+	})
+
+	t.Run("block_scope.berl", func(t *testing.T) {
+		runtime := newRuntime()
+		result, err := runtime.Evaluate(parseString("let a: int = 1; if (true) { let b: int = 2; a = a + b; } a", t))
+		if err != nil {
+			t.Fatalf("Error evaluating file: %v", err)
+		}
+
+		expected := values.IntVal{Value: 3, Type: values.IntValue}
+		if !reflect.DeepEqual(result, &expected) {
+			t.Fatalf("Expected %v, got %v", expected, result)
+		}
+
+		if _, err := runtime.Evaluate(parseString("b", t)); err == nil {
+			t.Fatalf("Expected b to be dropped at the end of its block")
+		}
+	})
+
+	t.Run("while.berl", func(t *testing.T) {
+		input := `
+let i: int = 0
+let sum: int = 0
+while (true) {
+	i = i + 1
+	if (i > 10) { break }
+	if (i == 5) { continue }
+	sum = sum + i
+}
+sum`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 50, Type: values.IntValue})
+	})
+
+	t.Run("for.berl", func(t *testing.T) {
+		runtime := newRuntime()
+		input := "let n: int = 0\nfor (let i: int = 0; i < 4; i = i + 1) { n = n + i; }\nn"
+		result, err := runtime.Evaluate(parseString(input, t))
+		if err != nil {
+			t.Fatalf("Error evaluating file: %v", err)
+		}
+
+		expected := values.IntVal{Value: 6, Type: values.IntValue}
+		if !reflect.DeepEqual(result, &expected) {
+			t.Fatalf("Expected %v, got %v", expected, result)
+		}
+
+		if _, err := runtime.Evaluate(parseString("i", t)); err == nil {
+			t.Fatalf("Expected the loop variable to be scoped to the loop")
+		}
+	})
+
+	t.Run("function.berl", func(t *testing.T) {
+		input := `
+def add(a: int, b: int): int {
+	return a + b;
+}
+add(2, 3) * 2`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 10, Type: values.IntValue})
+	})
+
+	t.Run("recursion.berl", func(t *testing.T) {
+		input := `
+def fib(n: int): int {
+	if (n < 2) { return n; }
+	return fib(n - 1) + fib(n - 2);
+}
+fib(15)`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 610, Type: values.IntValue})
+	})
+
+	t.Run("return_from_loop.berl", func(t *testing.T) {
+		input := `
+def firstOver(limit: int): int {
+	for (let i: int = 0; true; i = i + 1) {
+		if (i * i > limit) { return i; }
+	}
+}
+firstOver(50)`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 8, Type: values.IntValue})
+	})
+
+	t.Run("call_arity.berl", func(t *testing.T) {
+		runtime := newRuntime()
+		if _, err := runtime.Evaluate(parseString("def f(a: int) { return a; }\nf(1, 2)", t)); err == nil {
+			t.Fatalf("Expected an error for a call with the wrong number of arguments")
+		}
+	})
+
+	t.Run("closure_counter.berl", func(t *testing.T) {
+		input := `
+def makeCounter(): fn {
+	let count: int = 0
+	return def(): int {
+		count = count + 1
+		return count
+	}
+}
+let a: fn = makeCounter()
+let b: fn = makeCounter()
+a(); a(); b()
+a()`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 3, Type: values.IntValue})
+	})
+
+	t.Run("higher_order.berl", func(t *testing.T) {
+		input := `
+def apply(f: fn, x: int): int { return f(x) }
+def adder(n: int): fn { return def(x: int) { return x + n } }
+apply(def(x: int) { return x * 2 }, 20) + adder(1)(1)`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 42, Type: values.IntValue})
+	})
+
+	t.Run("string_concat.berl", func(t *testing.T) {
+		input := `let greeting: string = "Merhaba"
+greeting + ", " + "d\u{fc}nya\t\"!\""`
+		expectValue(t, newRuntime, input, &values.StringVal{Value: "Merhaba, dünya\t\"!\"", Type: values.StringValue})
+	})
+
+	t.Run("string_compare.berl", func(t *testing.T) {
+		expectValue(t, newRuntime, `"abc" < "abd" && "x" == "x" && "x" != "y"`, &values.BoolVal{Value: true, Type: values.BoolValue})
+	})
+
+	t.Run("string_index_slice.berl", func(t *testing.T) {
+		expectValue(t, newRuntime, `"dünya"[1]`, &values.StringVal{Value: "ü", Type: values.StringValue})
+		expectValue(t, newRuntime, `"berlang"[3:]`, &values.StringVal{Value: "lang", Type: values.StringValue})
+		expectValue(t, newRuntime, `"berlang"[:3] + "berlang"[1:2]`, &values.StringVal{Value: "bere", Type: values.StringValue})
+	})
+
+	t.Run("string_index_out_of_range.berl", func(t *testing.T) {
+		runtime := newRuntime()
+		if _, err := runtime.Evaluate(parseString(`"abc"[3]`, t)); err == nil {
+			t.Fatalf("Expected an out of range error")
+		}
+	})
+
+	t.Run("array.berl", func(t *testing.T) {
+		input := `
+let xs: int[] = [1, 2, 3,]
+xs[0] = xs[1] + xs[2]
+push(xs, 10)
+len(xs) * 100 + xs[0] + pop(xs) + len(xs[1:])`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 417, Type: values.IntValue})
+		expectValue(t, newRuntime, `[[1, 2], [3]][1][0]`, &values.IntVal{Value: 3, Type: values.IntValue})
+		expectValue(t, newRuntime, `len("dünya") + len([])`, &values.IntVal{Value: 5, Type: values.IntValue})
+	})
+
+	t.Run("array_slice_copies.berl", func(t *testing.T) {
+		input := `
+let xs: int[] = [1, 2, 3]
+let ys: int[] = slice(xs, 0, 2)
+ys[0] = 9
+xs[0]`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 1, Type: values.IntValue})
+	})
+
+	t.Run("array_higher_order.berl", func(t *testing.T) {
+		input := `
+let xs: int[] = map([1, 2, 3, 4], def(x: int): int { return x * x })
+let even: int[] = filter(xs, def(x: int): bool { return x % 2 == 0 })
+reduce(even, def(acc: int, x: int): int { return acc + x }, 0)`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 20, Type: values.IntValue})
+	})
+
+	t.Run("array_errors.berl", func(t *testing.T) {
+		for _, input := range []string{
+			"[1, 2][2]",
+			"let xs: int[] = [1]\nxs[-1] = 2",
+			"pop([])",
+			"slice([1], 0, 2)",
+			`let s: string = "abc"` + "\n" + `s[0] = "x"`,
+		} {
+			runtime := newRuntime()
+			if _, err := runtime.Evaluate(parseString(input, t)); err == nil {
+				t.Errorf("Expected an error evaluating %q", input)
+			}
+		}
+	})
+
+	t.Run("builtin_shadowing.berl", func(t *testing.T) {
+		expectValue(t, newRuntime, "def len(x: int): int { return x }\nlen(7)", &values.IntVal{Value: 7, Type: values.IntValue})
+	})
+
+	t.Run("map.berl", func(t *testing.T) {
+		input := `
+let ages: {string: int} = {"ada": 36, "alan": 41,}
+ages["grace"] = 85
+ages["ada"] = ages["ada"] + 1
+delete(ages, "alan")
+delete(ages, "nobody")
+len(ages) * 1000 + ages["ada"] + ages["grace"]`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 2122, Type: values.IntValue})
+		expectValue(t, newRuntime, `has({"a": 1}, "a") && !has({"a": 1}, "b")`, &values.BoolVal{Value: true, Type: values.BoolValue})
+	})
+
+	t.Run("map_keys.berl", func(t *testing.T) {
+		// Numbers are keyed by value, so 1 and 1.0 are the same key
+		expectValue(t, newRuntime, `len({1: "a", true: "b", "1": "c"})`, &values.IntVal{Value: 3, Type: values.IntValue})
+		expectValue(t, newRuntime, `{1: "a", 1.0: "b", 1.5: "c"}[1]`, &values.StringVal{Value: "b", Type: values.StringValue})
+		expectValue(t, newRuntime, `len({-0.0: 1, 0: 2})`, &values.IntVal{Value: 1, Type: values.IntValue})
+	})
+
+	t.Run("map_order.berl", func(t *testing.T) {
+		runtime := newRuntime()
+		result, err := runtime.Evaluate(parseString(`let m: {string: int} = {"b": 1, "a": 2, "c": 3}
+delete(m, "a")
+m["a"] = 4
+m["b"] = 5
+m`, t))
+		if err != nil {
+			t.Fatalf("Error evaluating: %v", err)
+		}
+		if got := result.String(); got != `{"b": 5, "c": 3, "a": 4}` {
+			t.Errorf("Expected the keys in insertion order, got %s", got)
+		}
+	})
+
+	t.Run("for_in.berl", func(t *testing.T) {
+		input := `
+let total: int = 0
+for (name, score in {"a": 1, "b": 2}) {
+	total = total + score * 10
+}
+for (x in [1, 2, 3]) {
+	if (x == 3) { break }
+	total = total + x
+}
+for (i, ch in "abc") {
+	total = total + i * 100
+}
+total`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 333, Type: values.IntValue})
+		expectValue(t, newRuntime, `let s: string = ""
+for (k in {"x": 1, "y": 2}) { s = s + k }
+s`, &values.StringVal{Value: "xy", Type: values.StringValue})
+	})
+
+	t.Run("map_errors.berl", func(t *testing.T) {
+		for _, input := range []string{
+			`{"a": 1}["b"]`,
+			`len({[1]: 2})`,
+			`let m: {float: int} = {}` + "\n" + `m[0.0 / 0.0] = 1`,
+			`has([1], 1)`,
+			`for (x in 5) { }`,
+		} {
+			runtime := newRuntime()
+			if _, err := runtime.Evaluate(parseString(input, t)); err == nil {
+				t.Errorf("Expected an error evaluating %q", input)
+			}
+		}
+	})
+
+	t.Run("struct.berl", func(t *testing.T) {
+		input := `
+struct Point { x: int, y: int }
+struct Line { from: Point, to: Point, }
+let a: Point = Point{ x: 1, y: 2 }
+let line: Line = Line{ to: Point{ x: 3, y: 4 }, from: a }
+line.to.x = line.from.x + 10
+a.y = 20
+line.from.y + line.to.x`
+		expectValue(t, newRuntime, input, &values.IntVal{Value: 31, Type: values.IntValue})
+	})
+
+	t.Run("struct_string.berl", func(t *testing.T) {
+		runtime := newRuntime()
+		result, err := runtime.Evaluate(parseString(`struct User { name: string, tags: string[] }
+User{ name: "ada", tags: ["admin"] }`, t))
+		if err != nil {
+			t.Fatalf("Error evaluating: %v", err)
+		}
+		if got := result.String(); got != `User{name: "ada", tags: ["admin"]}` {
+			t.Errorf("Unexpected struct formatting %s", got)
+		}
+	})
+
+	t.Run("struct_errors.berl", func(t *testing.T) {
+		for _, input := range []string{
+			"struct P { x: int }\nP{ y: 1 }",
+			"struct P { x: int, y: int }\nP{ x: 1 }",
+			"struct P { x: int }\nP{ x: 1, x: 2 }",
+			"struct P { x: int }\nP{ x: 1 }.z",
+			"let n: int = 1\nn.x",
+			"Missing{}",
+		} {
+			runtime := newRuntime()
+			if _, err := runtime.Evaluate(parseString(input, t)); err == nil {
+				t.Errorf("Expected an error evaluating %q", input)
+			}
+		}
+	})
+
+	t.Run("enum_match.berl", func(t *testing.T) {
+		input := `
+enum Shape { Circle(r: float), Rect(w: float, h: float), Empty }
+def area(s: Shape): float {
+	return match (s) {
+		Shape.Circle(r) => 3.0 * r * r,
+		Shape.Rect(w, h) if w == h => w * w + 100.0,
+		Shape.Rect(w, h) => w * h,
+		Shape.Empty => 0.0,
+	}
+}
+let total: float = 0.0
+for (s in [Shape.Circle(1.0), Shape.Rect(2.0, 3.0), Shape.Empty, Shape.Rect(2.0, 2.0)]) {
+	total = total + area(s)
+}
+total`
+		expectValue(t, newRuntime, input, &values.FloatVal{Value: 113, Type: values.FloatValue})
+	})
+
+	t.Run("match_patterns.berl", func(t *testing.T) {
+		input := `
+enum Opt { Some(v: int), None }
+def describe(o: Opt): string {
+	return match (o) {
+		Opt.Some(0) => "zero",
+		Opt.Some(-1) => "minus one",
+		Opt.Some(n) if n > 10 => "big",
+		Opt.Some(_) => "small",
+		Opt.None => { "none" }
+	}
+}
+describe(Opt.Some(0)) + describe(Opt.Some(-1)) + describe(Opt.Some(11)) + describe(Opt.Some(5)) + describe(Opt.None)`
+		expectValue(t, newRuntime, input, &values.StringVal{Value: "zerominus onebigsmallnone", Type: values.StringValue})
+		expectValue(t, newRuntime, `match ("b") { "a" => 1, "b" => 2, _ => 3 }`, &values.IntVal{Value: 2, Type: values.IntValue})
+		expectValue(t, newRuntime, `match (2.0) { 2 => true, _ => false }`, &values.BoolVal{Value: true, Type: values.BoolValue})
+	})
+
+	t.Run("match_errors.berl", func(t *testing.T) {
+		for _, input := range []string{
+			`match (1) { 2 => 1 }`,
+			"enum E { A(x: int) }\nE.A(1, 2)",
+			"enum E { A }\nE.B",
+			"enum E { A(x: int) }\nmatch (E.A(1)) { E.A(x, y) => 1 }",
+		} {
+			runtime := newRuntime()
+			if _, err := runtime.Evaluate(parseString(input, t)); err == nil {
+				t.Errorf("Expected an error evaluating %q", input)
+			}
+		}
+	})
+
+	t.Run("int_division.berl", func(t *testing.T) {
+		expectValue(t, newRuntime, "let x: int = 7 / 2\nx", &values.IntVal{Value: 3, Type: values.IntValue})
+		expectValue(t, newRuntime, "-7 / 2", &values.IntVal{Value: -3, Type: values.IntValue})
+		expectValue(t, newRuntime, "-7 % 3", &values.IntVal{Value: -1, Type: values.IntValue})
+	})
+
+	t.Run("float_promotion.berl", func(t *testing.T) {
+		expectValue(t, newRuntime, "7 / 2.0", &values.FloatVal{Value: 3.5, Type: values.FloatValue})
+		expectValue(t, newRuntime, "1e3 + 1", &values.FloatVal{Value: 1001, Type: values.FloatValue})
+		expectValue(t, newRuntime, "2.5E-1 * 4 == 1", &values.BoolVal{Value: true, Type: values.BoolValue})
+		expectValue(t, newRuntime, "7.5 % 2", &values.FloatVal{Value: 1.5, Type: values.FloatValue})
+	})
+
+	t.Run("int_overflow.berl", func(t *testing.T) {
+		for _, input := range []string{
+			"9223372036854775807 + 1",
+			"-9223372036854775807 - 2",
+			"4611686018427387904 * 2",
+			"1 % 0",
+		} {
+			runtime := newRuntime()
+			if _, err := runtime.Evaluate(parseString(input, t)); err == nil {
+				t.Errorf("Expected an error evaluating %s", input)
+			}
+		}
+	})
+
+	t.Run("const_assign.berl", func(t *testing.T) {
+		runtime := newRuntime()
+		if _, err := runtime.Evaluate(parseString("const c: int = 1\nc = 2", t)); err == nil {
+			t.Fatalf("Expected an error reassigning a constant")
+		}
+	})
+
+	t.Run("scopes.berl", func(t *testing.T) {
+		expectValue(t, newRuntime, `
+			let x: int = 1
+			let total: int = 0
+			{
+				let x: int = 10
+				{
+					let y: int = x + 5
+					total = total + y
+				}
+				total = total + x
+			}
+			total + x
+		`, &values.IntVal{Value: 26, Type: values.IntValue})
+
+		// A function may use a global declared after it
+		expectValue(t, newRuntime, `
+			def first(): int { return second() + 1 }
+			def second(): int { return 41 }
+			first()
+		`, &values.IntVal{Value: 42, Type: values.IntValue})
+
+		expectValue(t, newRuntime, `
+			def adder(n: int) {
+				let base: int = n * 10
+				return def(m: int) { return base + n + m }
+			}
+			let add: any = adder(2)
+			add(3)
+		`, &values.IntVal{Value: 25, Type: values.IntValue})
+
+		// So may a function of a nested scope use the functions, structs
+		// and enums declared after it in that scope
+		expectValue(t, newRuntime, `
+			def outer(): int {
+				def even(n: int): bool { if (n == 0) { return true } return odd(n - 1) }
+				def odd(n: int): bool { if (n == 0) { return false } return even(n - 1) }
+				def make(): P { return P{ s: S.A(7) } }
+				struct P { s: S }
+				enum S { A(v: int) }
+				if (even(10) && odd(3)) {
+					return match (make().s) { S.A(v) => v }
+				}
+				return 0
+			}
+			outer()
+		`, &values.IntVal{Value: 7, Type: values.IntValue})
+
+		// Called before the declaration has run, the name is not there yet
+		runtime := newRuntime()
+		if _, err := runtime.Evaluate(parseString(`
+			def outer(): int {
+				def early(): int { return late() }
+				early()
+				def late(): int { return 1 }
+				return 0
+			}
+			outer()
+		`, t)); err == nil {
+			t.Errorf("Expected an error calling a function before its declaration ran")
+		}
+
+		// Globals outlive the program that declared them
+		runtime = newRuntime()
+		for _, input := range []string{"let g: int = 5", "def get(): int { return g }", "let g: int = 7", "get()"} {
+			if _, err := runtime.Evaluate(parseString(input, t)); err != nil {
+				t.Fatalf("Error evaluating %q: %v", input, err)
+			}
+		}
+		result, err := runtime.Evaluate(parseString("get()", t))
+		if err != nil || !reflect.DeepEqual(result, &values.IntVal{Value: 7, Type: values.IntValue}) {
+			t.Fatalf("Expected get() to return 7, got %v, %v", result, err)
+		}
+	})
+
+	t.Run("resolve_errors.berl", func(t *testing.T) {
+		cases := []struct {
+			input     string
+			message   string
+			line, col int
+		}{
+			{"let x: int = y\nlet y: int = 1", "'y' is used before its declaration", 1, 14},
+			{"{\n  let a: int = a + 1\n}", "'a' is used before its declaration", 2, 16},
+			{"let x: int = 1\nlet x: int = 2", "'x' is already declared in this scope", 2, 1},
+			{"def f(a: int, a: int) { return a }", "'a' is already declared in this scope", 1, 1},
+			{"def f() {\n  def g() { return h }\n  let h: int = 1\n}", "'h' is used before its declaration", 2, 20},
+			{"match (1) {\n  x => { let x: int = 2\n x },\n  _ => 0 }", "", 0, 0},
+		}
+		for _, c := range cases {
+			runtime := newRuntime()
+			_, err := runtime.Evaluate(parseString(c.input, t))
+			if c.message == "" {
+				if err != nil {
+					t.Errorf("Unexpected error evaluating %q: %v", c.input, err)
+				}
+				continue
+			}
+
+			diags := diagnostics.From(err)
+			if len(diags) != 1 {
+				t.Fatalf("Expected a diagnostic evaluating %q, got %v", c.input, err)
+			}
+			d := diags[0]
+			if d.Code != diagnostics.CodeResolve || d.Message != c.message {
+				t.Errorf("Expected %s %q, got %s %q", diagnostics.CodeResolve, c.message, d.Code, d.Message)
+			}
+			if start := d.Span.Start; start.Line != c.line || start.Column != c.col {
+				t.Errorf("Expected the error at %d:%d, got %d:%d", c.line, c.col, start.Line, start.Column)
+			}
+		}
+	})
+
+	t.Run("error_location.berl", func(t *testing.T) {
+		cases := []struct {
+			input     string
+			line, col int
+		}{
+			{"let x: int = 1\nlet y: int = 2 + x / 0", 2, 18},
+			{"def f() {\n  return missing\n}\nf()", 2, 10},
+		}
+		for _, c := range cases {
+			runtime := newRuntime()
+			_, err := runtime.Evaluate(parseString(c.input, t))
+
+			var d *diagnostics.Diagnostic
+			if !errors.As(err, &d) {
+				t.Fatalf("Expected a diagnostic evaluating %q, got %v", c.input, err)
+			}
+			if start := d.Span.Start; start.Line != c.line || start.Column != c.col {
+				t.Errorf("Expected the error at %d:%d, got %d:%d", c.line, c.col, start.Line, start.Column)
+			}
+		}
+	})
+
+	t.Run("000-variable.bl", func(t *testing.T) {
+		runtime := newRuntime()
+		if _, err := runtime.Evaluate(parseFile("../../berlang/000-variable.bl", t)); err != nil {
+			t.Fatalf("Error evaluating file: %v", err)
+		}
+	})
+}
+
+// expectValue evaluates input in a fresh runtime and compares the result.
+func expectValue(t *testing.T, newRuntime func() evaluator, input string, expected values.RtVal) {
+	t.Helper()
+
+	runtime := newRuntime()
+	result, err := runtime.Evaluate(parseString(input, t))
+	if err != nil {
+		t.Fatalf("Error evaluating %q: %v", input, err)
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, result)
+	}
 }
 
 func BenchmarkInterpreter(b *testing.B) {
-    var expressions []string
-    for i := 0; i < b.N; i++ {
-        expressions = append(expressions, generateExpression(100, b))
-    }
-
-    b.ResetTimer()
-    for i := 0; i < b.N; i++ {
-        expression := expressions[i]
-        runtime := interpreter.NewRuntime()
-        parsed := parseString(expression, b)
-        _, err := runtime.Evaluate(parsed)
-        if err != nil {
-            b.Fatalf("Error evaluating expression: %v", err)
-        }
-    }
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			var expressions []string
+			for i := 0; i < b.N; i++ {
+				expressions = append(expressions, generateExpression(100, b))
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				expression := expressions[i]
+				runtime := backend.new(io.Discard)
+				parsed := parseString(expression, b)
+				_, err := runtime.Evaluate(parsed)
+				if err != nil {
+					b.Fatalf("Error evaluating expression: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLoop(b *testing.B) {
+	parsed := parseString(`
+		let total: int = 0
+		for (let i: int = 0; i < 100000; i = i + 1) {
+			total = total + i % 7
+		}
+		total
+	`, b)
+
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := backend.new(io.Discard).Evaluate(parsed); err != nil {
+					b.Fatalf("Error evaluating loop: %v", err)
+				}
+			}
+		})
+	}
 }
 
 func parse(input io.Reader, tb testing.TB) ast.Stmt {
-    tb.Helper()
+	tb.Helper()
 
 	lexer := lexer.NewLexer(input)
 	tq, err := lexer.Lex()
@@ -102,11 +803,10 @@ func parse(input io.Reader, tb testing.TB) ast.Stmt {
 	return p
 }
 
-
 var operators = []string{"+", "-", "*", "/"}
 
 func generateExpression(length int, tb testing.TB) string {
-    tb.Helper()
+	tb.Helper()
 
 	var sb strings.Builder
 	openParentheses := 0
@@ -117,8 +817,9 @@ func generateExpression(length int, tb testing.TB) string {
 			openParentheses++
 		}
 
-        // Randomize something > 0 and < 2^31
-		sb.WriteString(fmt.Sprintf("%d", rand.Intn(1<<31)))
+		// Randomize something > 0 and < 2^31. The literals are Floats so
+		// long products can't hit the Int overflow check
+		sb.WriteString(fmt.Sprintf("%d.0", rand.Intn(1<<31)))
 
 		if openParentheses > 0 && rand.Intn(4) == 0 { // 25% chance
 			sb.WriteString(")")
@@ -0,0 +1,76 @@
+package interpreter
+
+import (
+	"berlang/frontend/ast"
+	"berlang/runtime/environment"
+	"berlang/runtime/ops"
+	"berlang/runtime/values"
+)
+
+func (r *Runtime) evalMapLiteral(lit *ast.MapLiteral) (values.RtVal, error) {
+	m := values.NewMapVal()
+	for _, entry := range lit.Entries {
+		key, err := r.eval(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		val, err := r.eval(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		// A key repeated in the literal keeps the last value, like assigning
+		// the entries one after another would
+		if err := m.Set(key, val); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// evalForInStmt runs the body once for every key of a map, element of an
+// array or character of a string. The loop works on a snapshot, changes made
+// by the body are not seen until the next loop.
+func (r *Runtime) evalForInStmt(f *ast.ForInStmt) (values.RtVal, error) {
+	iterable, err := r.eval(f.Iterable)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, vals, err := ops.Iterate(iterable)
+	if err != nil {
+		return nil, err
+	}
+
+	parent := r.CurEnv
+	defer func() { r.CurEnv = parent }()
+
+	for i, val := range vals {
+		var key values.RtVal = ops.NewInt(int64(i))
+		if keys != nil {
+			key = keys[i]
+		}
+
+		// Every iteration gets fresh variables, so closures created in the
+		// body keep the values of their own iteration
+		r.CurEnv = environment.NewEnvironment(parent)
+		if len(f.Names) == 1 {
+			if keys == nil {
+				key = val
+			}
+			r.CurEnv.Define(0, key, "let", "")
+		} else {
+			r.CurEnv.Define(0, key, "let", "")
+			r.CurEnv.Define(1, val, "let", "")
+		}
+
+		stop, err := r.runLoopBody(f.Body)
+		if err != nil {
+			return nil, err
+		}
+		if stop {
+			break
+		}
+	}
+	return ops.NewNone(), nil
+}
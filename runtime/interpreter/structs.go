@@ -0,0 +1,61 @@
+package interpreter
+
+import (
+	"berlang/frontend/ast"
+	"berlang/runtime/ops"
+	"berlang/runtime/values"
+	"fmt"
+)
+
+func (r *Runtime) evalStructDecl(decl *ast.StructDecl) (values.RtVal, error) {
+	def := ops.StructType(decl)
+	r.define(decl, decl.Name, def, "const", "struct")
+	return def, nil
+}
+
+// evalStructLiteral evaluates the fields in the order they are written.
+func (r *Runtime) evalStructLiteral(lit *ast.StructLiteral) (values.RtVal, error) {
+	def, err := r.lookup(lit, lit.Name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := def.(*values.StructTypeVal); !ok {
+		return nil, fmt.Errorf("'%s' is not a struct", lit.Name)
+	}
+
+	names := make([]string, len(lit.Fields))
+	vals := make([]values.RtVal, len(lit.Fields))
+	for i, field := range lit.Fields {
+		names[i] = field.Name
+		if vals[i], err = r.eval(field.Value); err != nil {
+			return nil, err
+		}
+	}
+	return ops.NewStruct(def, names, vals)
+}
+
+// evalFieldExpr reads a field of a struct, or a variant of an enum when the
+// object is the name of one.
+func (r *Runtime) evalFieldExpr(fe *ast.FieldExpr) (values.RtVal, error) {
+	object, err := r.eval(fe.Object)
+	if err != nil {
+		return nil, err
+	}
+	return ops.Field(object, fe.Field)
+}
+
+func (r *Runtime) evalFieldAssign(assign *ast.FieldAssign) (values.RtVal, error) {
+	object, err := r.eval(assign.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := r.eval(assign.Value)
+	if err != nil {
+		return nil, err
+	}
+	if err := ops.SetField(object, assign.Field, val); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
@@ -0,0 +1,57 @@
+package interpreter
+
+import (
+	"berlang/frontend/ast"
+	"berlang/runtime/ops"
+	"berlang/runtime/values"
+)
+
+func (r *Runtime) evalVarDecl(decl *ast.VarDecl) (values.RtVal, error) {
+	var val values.RtVal = ops.NewNone()
+	if decl.Value != nil {
+		var err error
+		if val, err = r.eval(*decl.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	r.define(decl, decl.Name, val, decl.VarType, decl.ValType)
+	return val, nil
+}
+
+func (r *Runtime) evalVarAssign(assign *ast.VarAssign) (values.RtVal, error) {
+	val, err := r.eval(*assign.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if binding := assign.Binding; !binding.Global {
+		err = r.CurEnv.Assign(assign.Name, binding.Depth, binding.Slot, val)
+	} else {
+		err = r.Globals.Assign(assign.Name, val)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// define binds the name declared by node where the resolver put it.
+func (r *Runtime) define(node ast.BoundNode, name string, val values.RtVal, varType string, valType string) {
+	if binding := node.GetBinding(); !binding.Global {
+		r.CurEnv.Define(binding.Slot, val, varType, valType)
+		return
+	}
+	r.Globals.Define(name, val, varType, valType)
+}
+
+// lookup returns the value of the variable called name that node uses.
+func (r *Runtime) lookup(node ast.BoundNode, name string) (values.RtVal, error) {
+	if binding := node.GetBinding(); !binding.Global {
+		return r.CurEnv.Resolve(name, binding.Depth, binding.Slot)
+	}
+	if native, found := r.natives[name]; found && !r.Globals.Has(name) {
+		return native, nil
+	}
+	return r.Globals.Resolve(name)
+}
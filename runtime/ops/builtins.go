@@ -0,0 +1,262 @@
+package ops
+
+import (
+	"berlang/runtime/values"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Caller calls back into the backend running the program, for the built-ins
+// that take a function.
+type Caller interface {
+	Call(callee values.RtVal, args []values.RtVal) (values.RtVal, error)
+}
+
+// Builtin is a function provided by the runtime. It is called by name when no
+// variable of that name is in scope.
+type Builtin func(c Caller, args []values.RtVal) (values.RtVal, error)
+
+var Builtins = map[string]Builtin{
+	"len":    builtinLen,
+	"push":   builtinPush,
+	"pop":    builtinPop,
+	"slice":  builtinSlice,
+	"map":    builtinMap,
+	"filter": builtinFilter,
+	"reduce": builtinReduce,
+	"has":    builtinHas,
+	"keys":   builtinKeys,
+	"values": builtinValues,
+	"delete": builtinDelete,
+}
+
+func checkArgCount(name string, args []values.RtVal, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("built-in '%s' expects %d arguments, got %d", name, n, len(args))
+	}
+	return nil
+}
+
+func arrayArg(name string, args []values.RtVal, i int) (*values.ArrayVal, error) {
+	array, ok := args[i].(*values.ArrayVal)
+	if !ok {
+		return nil, fmt.Errorf("argument %d of built-in '%s' must be an Array, got %s", i+1, name, args[i].GetType())
+	}
+	return array, nil
+}
+
+func mapArg(name string, args []values.RtVal, i int) (*values.MapVal, error) {
+	m, ok := args[i].(*values.MapVal)
+	if !ok {
+		return nil, fmt.Errorf("argument %d of built-in '%s' must be a Map, got %s", i+1, name, args[i].GetType())
+	}
+	return m, nil
+}
+
+func intArg(name string, args []values.RtVal, i int) (int, error) {
+	num, ok := args[i].(*values.IntVal)
+	if !ok {
+		return 0, fmt.Errorf("argument %d of built-in '%s' must be an Int, got %s", i+1, name, args[i].GetType())
+	}
+	return int(num.Value), nil
+}
+
+func builtinLen(c Caller, args []values.RtVal) (values.RtVal, error) {
+	if err := checkArgCount("len", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch arg := args[0].(type) {
+	case *values.StringVal:
+		return NewInt(int64(utf8.RuneCountInString(arg.Value))), nil
+	case *values.ArrayVal:
+		return NewInt(int64(len(arg.Elements))), nil
+	case *values.MapVal:
+		return NewInt(int64(arg.Len())), nil
+	default:
+		return nil, fmt.Errorf("argument 1 of built-in 'len' must be a String, an Array or a Map, got %s", arg.GetType())
+	}
+}
+
+func builtinPush(c Caller, args []values.RtVal) (values.RtVal, error) {
+	if err := checkArgCount("push", args, 2); err != nil {
+		return nil, err
+	}
+	array, err := arrayArg("push", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	array.Elements = append(array.Elements, args[1])
+	return NewNone(), nil
+}
+
+func builtinPop(c Caller, args []values.RtVal) (values.RtVal, error) {
+	if err := checkArgCount("pop", args, 1); err != nil {
+		return nil, err
+	}
+	array, err := arrayArg("pop", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(array.Elements)
+	if n == 0 {
+		return nil, fmt.Errorf("pop from an empty array")
+	}
+	last := array.Elements[n-1]
+	array.Elements[n-1] = nil
+	array.Elements = array.Elements[:n-1]
+	return last, nil
+}
+
+func builtinSlice(c Caller, args []values.RtVal) (values.RtVal, error) {
+	if err := checkArgCount("slice", args, 3); err != nil {
+		return nil, err
+	}
+	array, err := arrayArg("slice", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, err := intArg("slice", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	end, err := intArg("slice", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return sliceValue(array, start, end)
+}
+
+func builtinMap(c Caller, args []values.RtVal) (values.RtVal, error) {
+	if err := checkArgCount("map", args, 2); err != nil {
+		return nil, err
+	}
+	array, err := arrayArg("map", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]values.RtVal, len(array.Elements))
+	for i, element := range array.Elements {
+		if result[i], err = c.Call(args[1], []values.RtVal{element}); err != nil {
+			return nil, err
+		}
+	}
+	return NewArray(result), nil
+}
+
+func builtinFilter(c Caller, args []values.RtVal) (values.RtVal, error) {
+	if err := checkArgCount("filter", args, 2); err != nil {
+		return nil, err
+	}
+	array, err := arrayArg("filter", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]values.RtVal, 0)
+	for _, element := range array.Elements {
+		keep, err := c.Call(args[1], []values.RtVal{element})
+		if err != nil {
+			return nil, err
+		}
+
+		b, ok := keep.(*values.BoolVal)
+		if !ok {
+			return nil, fmt.Errorf("function passed to built-in 'filter' must return a Bool, got %s", keep.GetType())
+		}
+		if b.Value {
+			result = append(result, element)
+		}
+	}
+	return NewArray(result), nil
+}
+
+// builtinReduce folds the array from the left, reduce(a, f, initial) is
+// f(f(initial, a[0]), a[1]) and so on.
+func builtinReduce(c Caller, args []values.RtVal) (values.RtVal, error) {
+	if err := checkArgCount("reduce", args, 3); err != nil {
+		return nil, err
+	}
+	array, err := arrayArg("reduce", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := args[2]
+	for _, element := range array.Elements {
+		if acc, err = c.Call(args[1], []values.RtVal{acc, element}); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+func builtinHas(c Caller, args []values.RtVal) (values.RtVal, error) {
+	if err := checkArgCount("has", args, 2); err != nil {
+		return nil, err
+	}
+	m, err := mapArg("has", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	_, found, err := m.Get(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return NewBool(found), nil
+}
+
+// builtinKeys returns the keys of a map in the order they were added.
+func builtinKeys(c Caller, args []values.RtVal) (values.RtVal, error) {
+	if err := checkArgCount("keys", args, 1); err != nil {
+		return nil, err
+	}
+	m, err := mapArg("keys", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]values.RtVal, 0, m.Len())
+	for _, entry := range m.Entries() {
+		keys = append(keys, entry.Key)
+	}
+	return NewArray(keys), nil
+}
+
+// builtinValues returns the values of a map in the same order as keys.
+func builtinValues(c Caller, args []values.RtVal) (values.RtVal, error) {
+	if err := checkArgCount("values", args, 1); err != nil {
+		return nil, err
+	}
+	m, err := mapArg("values", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	vals := make([]values.RtVal, 0, m.Len())
+	for _, entry := range m.Entries() {
+		vals = append(vals, entry.Value)
+	}
+	return NewArray(vals), nil
+}
+
+// builtinDelete removes a key from a map, deleting a missing key does
+// nothing.
+func builtinDelete(c Caller, args []values.RtVal) (values.RtVal, error) {
+	if err := checkArgCount("delete", args, 2); err != nil {
+		return nil, err
+	}
+	m, err := mapArg("delete", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := m.Delete(args[1]); err != nil {
+		return nil, err
+	}
+	return NewNone(), nil
+}
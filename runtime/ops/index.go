@@ -0,0 +1,168 @@
+package ops
+
+import (
+	"berlang/runtime/values"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Index evaluates object[index]. Strings are indexed by character, not by
+// byte, and produce a string of length one. A missing map key is an error,
+// has checks for the key first.
+func Index(object, index values.RtVal) (values.RtVal, error) {
+	if m, ok := object.(*values.MapVal); ok {
+		val, found, err := m.Get(index)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("key %s not found in map", describeKey(index))
+		}
+		return val, nil
+	}
+
+	switch object := object.(type) {
+	case *values.StringVal:
+		i, err := intIndex(index)
+		if err != nil {
+			return nil, err
+		}
+		chars := []rune(object.Value)
+		if i < 0 || i >= len(chars) {
+			return nil, fmt.Errorf("index %d out of range for string of length %d", i, len(chars))
+		}
+		return NewString(string(chars[i])), nil
+	case *values.ArrayVal:
+		i, err := intIndex(index)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkArrayIndex(object, i); err != nil {
+			return nil, err
+		}
+		return object.Elements[i], nil
+	default:
+		return nil, fmt.Errorf("cannot index a value of type %s", object.GetType())
+	}
+}
+
+// SetIndex evaluates object[index] = val. Strings can not be changed, so
+// only arrays and maps can be assigned to.
+func SetIndex(object, index, val values.RtVal) error {
+	if m, ok := object.(*values.MapVal); ok {
+		return m.Set(index, val)
+	}
+
+	array, ok := object.(*values.ArrayVal)
+	if !ok {
+		return fmt.Errorf("cannot assign to an index of a value of type %s", object.GetType())
+	}
+	i, err := intIndex(index)
+	if err != nil {
+		return err
+	}
+	if err := checkArrayIndex(array, i); err != nil {
+		return err
+	}
+
+	array.Elements[i] = val
+	return nil
+}
+
+// Slice evaluates object[start:end], the end is exclusive and a nil bound
+// defaults to the start or the end of the string or array.
+func Slice(object, start, end values.RtVal) (values.RtVal, error) {
+	var length int
+	switch object := object.(type) {
+	case *values.StringVal:
+		length = utf8.RuneCountInString(object.Value)
+	case *values.ArrayVal:
+		length = len(object.Elements)
+	default:
+		return nil, fmt.Errorf("cannot slice a value of type %s", object.GetType())
+	}
+
+	from, to := 0, length
+	var err error
+	if start != nil {
+		if from, err = intIndex(start); err != nil {
+			return nil, err
+		}
+	}
+	if end != nil {
+		if to, err = intIndex(end); err != nil {
+			return nil, err
+		}
+	}
+	return sliceValue(object, from, to)
+}
+
+// intIndex checks that a value used as a string or array index is an Int.
+func intIndex(index values.RtVal) (int, error) {
+	num, ok := index.(*values.IntVal)
+	if !ok {
+		return 0, fmt.Errorf("index must be an Int, got %s", index.GetType())
+	}
+	return int(num.Value), nil
+}
+
+func checkArrayIndex(array *values.ArrayVal, index int) error {
+	if index < 0 || index >= len(array.Elements) {
+		return fmt.Errorf("index %d out of range for array of length %d", index, len(array.Elements))
+	}
+	return nil
+}
+
+// sliceValue returns the part of a string or an array from start up to, but
+// not including, end. A slice of an array is a new array, changing it does
+// not change the original.
+func sliceValue(object values.RtVal, start int, end int) (values.RtVal, error) {
+	switch object := object.(type) {
+	case *values.StringVal:
+		chars := []rune(object.Value)
+		if start < 0 || end > len(chars) || start > end {
+			return nil, fmt.Errorf("slice bounds [%d:%d] out of range for string of length %d", start, end, len(chars))
+		}
+		return NewString(string(chars[start:end])), nil
+
+	case *values.ArrayVal:
+		if start < 0 || end > len(object.Elements) || start > end {
+			return nil, fmt.Errorf("slice bounds [%d:%d] out of range for array of length %d", start, end, len(object.Elements))
+		}
+		return NewArray(append([]values.RtVal(nil), object.Elements[start:end]...)), nil
+
+	default:
+		return nil, fmt.Errorf("cannot slice a value of type %s", object.GetType())
+	}
+}
+
+// describeKey formats a key for an error message, quoting strings.
+func describeKey(key values.RtVal) string {
+	if str, ok := key.(*values.StringVal); ok {
+		return fmt.Sprintf("%q", str.Value)
+	}
+	return key.String()
+}
+
+// Iterate takes the snapshot a for-in loop runs over: the keys and values of
+// a map, the elements of an array or the characters of a string. keys is nil
+// unless v is a map, the loop then uses the positions instead.
+func Iterate(v values.RtVal) (keys, vals []values.RtVal, err error) {
+	switch v := v.(type) {
+	case *values.MapVal:
+		keys = make([]values.RtVal, 0, v.Len())
+		for _, entry := range v.Entries() {
+			keys = append(keys, entry.Key)
+			vals = append(vals, entry.Value)
+		}
+	case *values.ArrayVal:
+		vals = append(vals, v.Elements...)
+	case *values.StringVal:
+		for _, ch := range v.Value {
+			vals = append(vals, NewString(string(ch)))
+		}
+	default:
+		return nil, nil, fmt.Errorf("cannot iterate over a value of type %s", v.GetType())
+	}
+	return keys, vals, nil
+}
@@ -0,0 +1,128 @@
+package ops
+
+import (
+	"berlang/runtime/values"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Natives returns the built-ins that write to out. Unlike the ones in
+// Builtins they are function values, each backend makes its own set with
+// the writer it is given and looks them up like globals.
+func Natives(out io.Writer) map[string]*values.NativeFuncVal {
+	natives := map[string]*values.NativeFuncVal{
+		"print": {Fn: func(args []values.RtVal) (values.RtVal, error) {
+			return write(out, joinArgs(args))
+		}},
+		"println": {Fn: func(args []values.RtVal) (values.RtVal, error) {
+			return write(out, joinArgs(args)+"\n")
+		}},
+		"printf": {Fn: func(args []values.RtVal) (values.RtVal, error) {
+			text, err := sprintf(args)
+			if err != nil {
+				return nil, err
+			}
+			return write(out, text)
+		}},
+	}
+	for name, native := range natives {
+		native.Type = values.FunctionValue
+		native.Name = name
+	}
+	return natives
+}
+
+func write(out io.Writer, text string) (values.RtVal, error) {
+	if _, err := io.WriteString(out, text); err != nil {
+		return nil, err
+	}
+	return NewNone(), nil
+}
+
+// joinArgs formats the arguments of print and println the way the values
+// are shown to the user, separated by spaces.
+func joinArgs(args []values.RtVal) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+// sprintf formats the arguments of printf with the verbs of Go's fmt
+// package. The format must use every argument exactly once, in order.
+func sprintf(args []values.RtVal) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("built-in 'printf' expects a format")
+	}
+	format, ok := args[0].(*values.StringVal)
+	if !ok {
+		return "", fmt.Errorf("argument 1 of built-in 'printf' must be a String, got %s", args[0].GetType())
+	}
+
+	verbs, err := countVerbs(format.Value)
+	if err != nil {
+		return "", err
+	}
+	if verbs != len(args)-1 {
+		return "", fmt.Errorf("printf format %q takes %d arguments, got %d", format.Value, verbs, len(args)-1)
+	}
+
+	formatArgs := make([]any, len(args)-1)
+	for i, arg := range args[1:] {
+		formatArgs[i] = formatArg{arg}
+	}
+	return fmt.Sprintf(format.Value, formatArgs...), nil
+}
+
+// countVerbs returns how many arguments a format consumes. Explicit argument
+// indexes and * widths would make that depend on the arguments, they are not
+// supported.
+func countVerbs(format string) (int, error) {
+	verbs := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0123456789.", format[i]) >= 0 {
+			i++
+		}
+		switch {
+		case i == len(format):
+			return 0, fmt.Errorf("printf format %q ends in the middle of a verb", format)
+		case format[i] == '[' || format[i] == '*':
+			return 0, fmt.Errorf("printf format %q uses %c, which is not supported", format, format[i])
+		case format[i] != '%':
+			verbs++
+		}
+	}
+	return verbs, nil
+}
+
+// formatArg formats a value for printf. %v and %s show it the way print
+// does, the other verbs see the Go value inside, so %d, %.2f and %q work as
+// they do in Go.
+type formatArg struct {
+	value values.RtVal
+}
+
+func (a formatArg) Format(f fmt.State, verb rune) {
+	if verb == 'v' || verb == 's' {
+		fmt.Fprintf(f, fmt.FormatString(f, 's'), a.value.String())
+		return
+	}
+
+	var v any = a.value.String()
+	switch val := a.value.(type) {
+	case *values.IntVal:
+		v = val.Value
+	case *values.FloatVal:
+		v = val.Value
+	case *values.BoolVal:
+		v = val.Value
+	}
+	fmt.Fprintf(f, fmt.FormatString(f, verb), v)
+}
@@ -0,0 +1,270 @@
+// Package ops implements the operators, indexing and built-in functions of
+// Berlang on runtime values. The tree walking interpreter and the bytecode
+// vm both go through it, so the two agree on every result and every error.
+package ops
+
+import (
+	"berlang/frontend/ast"
+	"berlang/runtime/values"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+var (
+	ErrDivisionByZero = errors.New("division by zero")
+	ErrIntOverflow    = errors.New("integer overflow")
+)
+
+// Number converts a numeric literal to an Int or, when it has a decimal
+// point or an exponent, a Float.
+func Number(lit *ast.NumericLiteral) (values.RtVal, error) {
+	if lit.IsFloat() {
+		casted, err := strconv.ParseFloat(lit.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float literal %s", lit.Value)
+		}
+		return NewFloat(casted), nil
+	}
+
+	casted, err := strconv.ParseInt(lit.Value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("integer literal %s does not fit in an Int", lit.Value)
+	}
+	return NewInt(casted), nil
+}
+
+// Binary applies a binary operator other than && and ||, which only
+// evaluate their right hand side when needed and are left to the caller.
+func Binary(op string, lhs, rhs values.RtVal) (values.RtVal, error) {
+	switch l := lhs.(type) {
+	case *values.IntVal:
+		switch r := rhs.(type) {
+		case *values.IntVal:
+			return intBinary(op, l.Value, r.Value)
+		case *values.FloatVal:
+			return floatBinary(op, float64(l.Value), r.Value)
+		}
+	case *values.FloatVal:
+		switch r := rhs.(type) {
+		case *values.IntVal:
+			return floatBinary(op, l.Value, float64(r.Value))
+		case *values.FloatVal:
+			return floatBinary(op, l.Value, r.Value)
+		}
+	case *values.StringVal:
+		if r, ok := rhs.(*values.StringVal); ok {
+			return stringBinary(op, l.Value, r.Value)
+		}
+	case *values.BoolVal:
+		if r, ok := rhs.(*values.BoolVal); ok {
+			return boolBinary(op, l.Value, r.Value)
+		}
+	}
+	return nil, fmt.Errorf("unsupported operand types for %s: %s and %s", op, lhs.GetType(), rhs.GetType())
+}
+
+// IsArithmetic reports whether op is one of + - * / %.
+func IsArithmetic(op string) bool {
+	switch op {
+	case "+", "-", "*", "/", "%":
+		return true
+	}
+	return false
+}
+
+// IntArith does 64 bit integer arithmetic, reporting overflow instead of
+// wrapping around. Division truncates towards zero and the result of % has
+// the sign of the dividend.
+func IntArith(op string, lhs, rhs int64) (int64, error) {
+	switch op {
+	case "+":
+		sum := lhs + rhs
+		if (sum > lhs) != (rhs > 0) {
+			return 0, ErrIntOverflow
+		}
+		return sum, nil
+	case "-":
+		diff := lhs - rhs
+		if (diff < lhs) != (rhs > 0) {
+			return 0, ErrIntOverflow
+		}
+		return diff, nil
+	case "*":
+		if lhs == 0 || rhs == 0 {
+			return 0, nil
+		}
+		product := lhs * rhs
+		if product/rhs != lhs || (lhs == -1 && rhs == math.MinInt64) || (rhs == -1 && lhs == math.MinInt64) {
+			return 0, ErrIntOverflow
+		}
+		return product, nil
+	case "/", "%":
+		if rhs == 0 {
+			return 0, ErrDivisionByZero
+		}
+		if lhs == math.MinInt64 && rhs == -1 {
+			if op == "%" {
+				return 0, nil
+			}
+			return 0, ErrIntOverflow
+		}
+		if op == "%" {
+			return lhs % rhs, nil
+		}
+		return lhs / rhs, nil
+	default:
+		return 0, fmt.Errorf("unsupported operator: %s", op)
+	}
+}
+
+// FloatArith is IntArith for Floats. Dividing by zero is an error here too
+// rather than producing an infinity.
+func FloatArith(op string, lhs, rhs float64) (float64, error) {
+	switch op {
+	case "+":
+		return lhs + rhs, nil
+	case "-":
+		return lhs - rhs, nil
+	case "*":
+		return lhs * rhs, nil
+	case "/":
+		if rhs == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return lhs / rhs, nil
+	case "%":
+		if rhs == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return math.Mod(lhs, rhs), nil
+	default:
+		return 0, fmt.Errorf("unsupported operator: %s", op)
+	}
+}
+
+// Compare applies a comparison operator to two values of an ordered Go type.
+func Compare[T int64 | float64 | string](op string, lhs, rhs T) (bool, error) {
+	switch op {
+	case "==":
+		return lhs == rhs, nil
+	case "!=":
+		return lhs != rhs, nil
+	case "<":
+		return lhs < rhs, nil
+	case "<=":
+		return lhs <= rhs, nil
+	case ">":
+		return lhs > rhs, nil
+	case ">=":
+		return lhs >= rhs, nil
+	default:
+		return false, fmt.Errorf("unsupported operator: %s", op)
+	}
+}
+
+// intBinary keeps Ints as Ints, as soon as one side is a Float the other one
+// is promoted and floatBinary is used instead.
+func intBinary(op string, lhs, rhs int64) (values.RtVal, error) {
+	if IsArithmetic(op) {
+		result, err := IntArith(op, lhs, rhs)
+		if err != nil {
+			return nil, err
+		}
+		return NewInt(result), nil
+	}
+	result, err := Compare(op, lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
+	return NewBool(result), nil
+}
+
+func floatBinary(op string, lhs, rhs float64) (values.RtVal, error) {
+	if IsArithmetic(op) {
+		result, err := FloatArith(op, lhs, rhs)
+		if err != nil {
+			return nil, err
+		}
+		return NewFloat(result), nil
+	}
+	result, err := Compare(op, lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
+	return NewBool(result), nil
+}
+
+func stringBinary(op string, lhs, rhs string) (values.RtVal, error) {
+	if op == "+" {
+		return NewString(lhs + rhs), nil
+	}
+	result, err := Compare(op, lhs, rhs)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported operator for strings: %s", op)
+	}
+	return NewBool(result), nil
+}
+
+func boolBinary(op string, lhs, rhs bool) (values.RtVal, error) {
+	switch op {
+	case "==":
+		return NewBool(lhs == rhs), nil
+	case "!=":
+		return NewBool(lhs != rhs), nil
+	default:
+		return nil, fmt.Errorf("unsupported operator for booleans: %s", op)
+	}
+}
+
+// Negate applies unary minus.
+func Negate(v values.RtVal) (values.RtVal, error) {
+	switch v := v.(type) {
+	case *values.IntVal:
+		if v.Value == math.MinInt64 {
+			return nil, ErrIntOverflow
+		}
+		return NewInt(-v.Value), nil
+	case *values.FloatVal:
+		return NewFloat(-v.Value), nil
+	default:
+		return nil, fmt.Errorf("unsupported unary expression: -%s", v.GetType())
+	}
+}
+
+// Condition checks that a value used as a condition is a Bool, what names
+// the construct in the error message.
+func Condition(v values.RtVal, what string) (bool, error) {
+	boolean, ok := v.(*values.BoolVal)
+	if !ok {
+		return false, fmt.Errorf("%s expects a Bool, got %s", what, v.GetType())
+	}
+	return boolean.Value, nil
+}
+
+func NewInt(i int64) *values.IntVal {
+	return &values.IntVal{Value: i, Type: values.IntValue}
+}
+
+func NewFloat(f float64) *values.FloatVal {
+	return &values.FloatVal{Value: f, Type: values.FloatValue}
+}
+
+func NewBool(b bool) *values.BoolVal {
+	return &values.BoolVal{Value: b, Type: values.BoolValue}
+}
+
+func NewString(s string) *values.StringVal {
+	return &values.StringVal{Value: s, Type: values.StringValue}
+}
+
+// NewArray wraps elements in an ArrayVal, the array takes ownership of the
+// slice.
+func NewArray(elements []values.RtVal) *values.ArrayVal {
+	return &values.ArrayVal{Type: values.ArrayValue, Elements: elements}
+}
+
+func NewNone() *values.NoneVal {
+	return &values.NoneVal{Type: values.NoneValue}
+}
@@ -0,0 +1,143 @@
+package ops
+
+import (
+	"berlang/frontend/ast"
+	"berlang/runtime/values"
+	"fmt"
+)
+
+// StructType builds the value the name of a struct declaration is bound to.
+func StructType(decl *ast.StructDecl) *values.StructTypeVal {
+	fields := make([]string, len(decl.Fields))
+	for i, field := range decl.Fields {
+		fields[i] = field.Name
+	}
+	return &values.StructTypeVal{Type: values.StructType, Name: decl.Name, Fields: fields}
+}
+
+// NewStruct builds a value of the struct def from a literal, names and vals
+// are the fields in the order they are written. They are stored in the
+// order of the declaration.
+func NewStruct(def values.RtVal, names []string, vals []values.RtVal) (values.RtVal, error) {
+	st, ok := def.(*values.StructTypeVal)
+	if !ok {
+		return nil, fmt.Errorf("a value of type %s is not a struct", def.GetType())
+	}
+
+	fields := make([]values.RtVal, len(st.Fields))
+	for j, name := range names {
+		i := st.FieldIndex(name)
+		if i < 0 {
+			return nil, fmt.Errorf("struct %s has no field '%s'", st.Name, name)
+		}
+		if fields[i] != nil {
+			return nil, fmt.Errorf("field '%s' is given twice", name)
+		}
+		fields[i] = vals[j]
+	}
+
+	for i, field := range fields {
+		if field == nil {
+			return nil, fmt.Errorf("missing field '%s' in %s literal", st.Fields[i], st.Name)
+		}
+	}
+	return &values.StructVal{Type: values.StructValue, Def: st, Fields: fields}, nil
+}
+
+// Field reads a field of a struct, or a variant of an enum when object is
+// the enum itself.
+func Field(object values.RtVal, name string) (values.RtVal, error) {
+	if enum, ok := object.(*values.EnumTypeVal); ok {
+		return Variant(enum, name)
+	}
+
+	sv, i, err := structField(object, name)
+	if err != nil {
+		return nil, err
+	}
+	return sv.Fields[i], nil
+}
+
+// SetField evaluates object.name = val.
+func SetField(object values.RtVal, name string, val values.RtVal) error {
+	sv, i, err := structField(object, name)
+	if err != nil {
+		return err
+	}
+	sv.Fields[i] = val
+	return nil
+}
+
+// structField finds the position of the field called name in a struct value.
+func structField(val values.RtVal, name string) (*values.StructVal, int, error) {
+	sv, ok := val.(*values.StructVal)
+	if !ok {
+		return nil, 0, fmt.Errorf("a value of type %s has no fields", val.GetType())
+	}
+
+	i := sv.Def.FieldIndex(name)
+	if i < 0 {
+		return nil, 0, fmt.Errorf("struct %s has no field '%s'", sv.Def.Name, name)
+	}
+	return sv, i, nil
+}
+
+// EnumType builds the value the name of an enum declaration is bound to.
+func EnumType(decl *ast.EnumDecl) *values.EnumTypeVal {
+	variants := make([]values.VariantDef, len(decl.Variants))
+	for i, variant := range decl.Variants {
+		variants[i].Name = variant.Name
+		for _, field := range variant.Fields {
+			variants[i].Fields = append(variants[i].Fields, field.Name)
+		}
+	}
+	return &values.EnumTypeVal{Type: values.EnumType, Name: decl.Name, Variants: variants}
+}
+
+// Variant evaluates Enum.Variant, which is the value itself for a variant
+// without fields and a constructor to call for the others.
+func Variant(enum *values.EnumTypeVal, name string) (values.RtVal, error) {
+	i := enum.VariantIndex(name)
+	if i < 0 {
+		return nil, fmt.Errorf("enum %s has no variant '%s'", enum.Name, name)
+	}
+
+	if len(enum.Variants[i].Fields) == 0 {
+		return &values.EnumVal{Type: values.EnumValue, Def: enum, Variant: i}, nil
+	}
+	return &values.ConstructorVal{Type: values.ConstructorValue, Def: enum, Variant: i}, nil
+}
+
+// Construct calls the constructor of a variant with fields.
+func Construct(cv *values.ConstructorVal, args []values.RtVal) (values.RtVal, error) {
+	variant := cv.Def.Variants[cv.Variant]
+	if len(args) != len(variant.Fields) {
+		return nil, fmt.Errorf("variant %s.%s expects %d arguments, got %d", cv.Def.Name, variant.Name, len(variant.Fields), len(args))
+	}
+	return &values.EnumVal{Type: values.EnumValue, Def: cv.Def, Variant: cv.Variant, Fields: args}, nil
+}
+
+// MatchVariant returns val when it is the variant called variant of the enum
+// called enum, nil otherwise. A pattern with the wrong number of fields is
+// an error.
+func MatchVariant(enum, variant string, fields int, val values.RtVal) (*values.EnumVal, error) {
+	ev, ok := val.(*values.EnumVal)
+	if !ok || ev.Def.Name != enum || ev.Def.Variants[ev.Variant].Name != variant {
+		return nil, nil
+	}
+	if fields != len(ev.Fields) {
+		return nil, fmt.Errorf("variant %s.%s has %d fields, the pattern has %d", enum, variant, len(ev.Fields), fields)
+	}
+	return ev, nil
+}
+
+// MatchLiteral reports whether val matches a literal pattern. Literals
+// compare like map keys, so 1 matches 1.0 as it does with ==.
+func MatchLiteral(lit, val values.RtVal) (bool, error) {
+	want, err := values.KeyOf(lit)
+	if err != nil {
+		return false, err
+	}
+	got, err := values.KeyOf(val)
+	return err == nil && got == want, nil
+}
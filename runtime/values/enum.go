@@ -0,0 +1,66 @@
+package values
+
+import "strings"
+
+// EnumTypeVal is what the name of an enum declaration is bound to, its
+// variants are reached with Enum.Variant.
+type EnumTypeVal struct {
+	Type     ValueType
+	Name     string
+	Variants []VariantDef
+}
+
+// VariantDef is a variant of an enum and the names of its fields.
+type VariantDef struct {
+	Name   string
+	Fields []string
+}
+
+func (et *EnumTypeVal) GetType() ValueType { return et.Type }
+func (et *EnumTypeVal) String() string     { return "<enum " + et.Name + ">" }
+
+// VariantIndex returns the position of the variant called name, or -1.
+func (et *EnumTypeVal) VariantIndex(name string) int {
+	for i, variant := range et.Variants {
+		if variant.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// EnumVal is one variant of an enum together with the values of its fields.
+type EnumVal struct {
+	Type    ValueType
+	Def     *EnumTypeVal
+	Variant int
+	Fields  []RtVal
+}
+
+func (ev *EnumVal) GetType() ValueType { return ev.Type }
+
+// String shows the value the way it is built, Shape.Circle(1.5).
+func (ev *EnumVal) String() string {
+	name := ev.Def.Name + "." + ev.Def.Variants[ev.Variant].Name
+	if len(ev.Fields) == 0 {
+		return name
+	}
+
+	fields := make([]string, len(ev.Fields))
+	for i, field := range ev.Fields {
+		fields[i] = quoted(field)
+	}
+	return name + "(" + strings.Join(fields, ", ") + ")"
+}
+
+// ConstructorVal builds values of a variant with fields when it is called.
+type ConstructorVal struct {
+	Type    ValueType
+	Def     *EnumTypeVal
+	Variant int
+}
+
+func (cv *ConstructorVal) GetType() ValueType { return cv.Type }
+func (cv *ConstructorVal) String() string {
+	return "<constructor " + cv.Def.Name + "." + cv.Def.Variants[cv.Variant].Name + ">"
+}
@@ -0,0 +1,132 @@
+package values
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// MapKey is the hashable form of a value used as a map key. Only strings,
+// numbers and bools can be keys. Numbers are compared by value, so 1 and
+// 1.0 are the same key.
+type MapKey struct {
+	kind  ValueType
+	str   string
+	int   int64
+	float float64
+	bool  bool
+}
+
+// KeyOf returns the key for v, or an error when v can not be a map key.
+func KeyOf(v RtVal) (MapKey, error) {
+	switch v := v.(type) {
+	case *StringVal:
+		return MapKey{kind: StringValue, str: v.Value}, nil
+	case *IntVal:
+		return MapKey{kind: IntValue, int: v.Value}, nil
+	case *FloatVal:
+		if math.IsNaN(v.Value) {
+			return MapKey{}, fmt.Errorf("NaN can not be used as a map key")
+		}
+		// Whole floats share their key with the Int of the same value, this
+		// also makes -0.0 and 0.0 the same key
+		if v.Value == math.Trunc(v.Value) && v.Value >= math.MinInt64 && v.Value < math.MaxInt64 {
+			return MapKey{kind: IntValue, int: int64(v.Value)}, nil
+		}
+		return MapKey{kind: FloatValue, float: v.Value}, nil
+	case *BoolVal:
+		return MapKey{kind: BoolValue, bool: v.Value}, nil
+	default:
+		return MapKey{}, fmt.Errorf("a value of type %s can not be used as a map key", v.GetType())
+	}
+}
+
+// MapEntry is a key and the value stored under it.
+type MapEntry struct {
+	Key   RtVal
+	Value RtVal
+}
+
+// MapVal maps keys to values and remembers the order the keys were added
+// in, which is the order they are iterated in. Like ArrayVal it is always
+// used through a pointer.
+type MapVal struct {
+	Type    ValueType
+	index   map[MapKey]int
+	entries []MapEntry
+}
+
+func NewMapVal() *MapVal {
+	return &MapVal{Type: MapValue, index: make(map[MapKey]int)}
+}
+
+func (mv *MapVal) GetType() ValueType { return mv.Type }
+
+// String shows the entries between braces in the same form as a map literal.
+func (mv *MapVal) String() string {
+	entries := make([]string, len(mv.entries))
+	for i, entry := range mv.entries {
+		entries[i] = quoted(entry.Key) + ": " + quoted(entry.Value)
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+// Len returns the number of entries in the map.
+func (mv *MapVal) Len() int { return len(mv.entries) }
+
+// Get returns the value stored under key and whether there was one.
+func (mv *MapVal) Get(key RtVal) (RtVal, bool, error) {
+	k, err := KeyOf(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	i, ok := mv.index[k]
+	if !ok {
+		return nil, false, nil
+	}
+	return mv.entries[i].Value, true, nil
+}
+
+// Set stores val under key. Replacing the value of a key keeps its place in
+// the iteration order and the key it was first added with.
+func (mv *MapVal) Set(key RtVal, val RtVal) error {
+	k, err := KeyOf(key)
+	if err != nil {
+		return err
+	}
+
+	if i, ok := mv.index[k]; ok {
+		mv.entries[i].Value = val
+		return nil
+	}
+	mv.index[k] = len(mv.entries)
+	mv.entries = append(mv.entries, MapEntry{Key: key, Value: val})
+	return nil
+}
+
+// Delete removes key from the map and reports whether it was there.
+func (mv *MapVal) Delete(key RtVal) (bool, error) {
+	k, err := KeyOf(key)
+	if err != nil {
+		return false, err
+	}
+
+	i, ok := mv.index[k]
+	if !ok {
+		return false, nil
+	}
+	delete(mv.index, k)
+	mv.entries = append(mv.entries[:i], mv.entries[i+1:]...)
+	for j := i; j < len(mv.entries); j++ {
+		k, _ := KeyOf(mv.entries[j].Key)
+		mv.index[k] = j
+	}
+	return true, nil
+}
+
+// Entries returns a copy of the entries in iteration order, so the map can
+// be changed while looping over them.
+func (mv *MapVal) Entries() []MapEntry {
+	return append([]MapEntry(nil), mv.entries...)
+}
@@ -0,0 +1,43 @@
+package values
+
+import "strings"
+
+// StructTypeVal is what the name of a struct declaration is bound to. It is
+// used to build values of the struct.
+type StructTypeVal struct {
+	Type   ValueType
+	Name   string
+	Fields []string
+}
+
+func (st *StructTypeVal) GetType() ValueType { return st.Type }
+func (st *StructTypeVal) String() string     { return "<struct " + st.Name + ">" }
+
+// FieldIndex returns the position of the field called name, or -1.
+func (st *StructTypeVal) FieldIndex(name string) int {
+	for i, field := range st.Fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// StructVal is a value of a struct type, with the fields in the order of the
+// declaration. Like ArrayVal it is always used through a pointer.
+type StructVal struct {
+	Type   ValueType
+	Def    *StructTypeVal
+	Fields []RtVal
+}
+
+func (sv *StructVal) GetType() ValueType { return sv.Type }
+
+// String shows the value in the same form as a struct literal.
+func (sv *StructVal) String() string {
+	fields := make([]string, len(sv.Fields))
+	for i, field := range sv.Fields {
+		fields[i] = sv.Def.Fields[i] + ": " + quoted(field)
+	}
+	return sv.Def.Name + "{" + strings.Join(fields, ", ") + "}"
+}
@@ -1,22 +1,102 @@
 package values
 
+import (
+	"berlang/frontend/ast"
+	"strconv"
+	"strings"
+)
+
 type ValueType string
 
 const (
-	NoneValue   ValueType = "None"
-	NumberValue ValueType = "Number"
+	NoneValue        ValueType = "None"
+	IntValue         ValueType = "Int"
+	FloatValue       ValueType = "Float"
+	BoolValue        ValueType = "Bool"
+	FunctionValue    ValueType = "Function"
+	StringValue      ValueType = "String"
+	ArrayValue       ValueType = "Array"
+	MapValue         ValueType = "Map"
+	StructValue      ValueType = "Struct"
+	StructType       ValueType = "StructType"
+	EnumValue        ValueType = "Enum"
+	EnumType         ValueType = "EnumType"
+	ConstructorValue ValueType = "Constructor"
 )
 
 type RtVal interface {
 	GetType() ValueType
+	// String formats the value the way it is shown to the user
+	String() string
+}
+
+type IntVal struct {
+	Type  ValueType `json:"type"`
+	Value int64     `json:"value"`
 }
 
-type NumVal struct {
+func (iv *IntVal) GetType() ValueType { return iv.Type }
+func (iv *IntVal) String() string     { return strconv.FormatInt(iv.Value, 10) }
+
+type FloatVal struct {
 	Type  ValueType `json:"type"`
 	Value float64   `json:"value"`
 }
 
-func (nv *NumVal) GetType() ValueType { return nv.Type }
+func (fv *FloatVal) GetType() ValueType { return fv.Type }
+
+// String always shows a decimal point or an exponent so Floats can be told
+// apart from Ints.
+func (fv *FloatVal) String() string {
+	s := strconv.FormatFloat(fv.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+type BoolVal struct {
+	Type  ValueType `json:"type"`
+	Value bool      `json:"value"`
+}
+
+func (bv *BoolVal) GetType() ValueType { return bv.Type }
+func (bv *BoolVal) String() string     { return strconv.FormatBool(bv.Value) }
+
+type StringVal struct {
+	Type  ValueType `json:"type"`
+	Value string    `json:"value"`
+}
+
+func (sv *StringVal) GetType() ValueType { return sv.Type }
+func (sv *StringVal) String() string     { return sv.Value }
+
+// ArrayVal is a growable list of values. It is always used through a
+// pointer, so every variable holding the array sees changes made to it.
+type ArrayVal struct {
+	Type     ValueType
+	Elements []RtVal
+}
+
+func (av *ArrayVal) GetType() ValueType { return av.Type }
+
+// String shows the elements between brackets, with strings quoted so
+// ["1"] and [1] look different.
+func (av *ArrayVal) String() string {
+	elements := make([]string, len(av.Elements))
+	for i, element := range av.Elements {
+		elements[i] = quoted(element)
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// quoted formats a value inside an array or a map.
+func quoted(v RtVal) string {
+	if str, ok := v.(*StringVal); ok {
+		return strconv.Quote(str.Value)
+	}
+	return v.String()
+}
 
 type NoneVal struct {
 	Type  ValueType
@@ -24,3 +104,37 @@ type NoneVal struct {
 }
 
 func (nov *NoneVal) GetType() ValueType { return nov.Type }
+func (nov *NoneVal) String() string     { return "none" }
+
+// FunctionVal is a user defined function together with the environment it was
+// declared in, so the body can see the variables around the declaration.
+type FunctionVal struct {
+	Type       ValueType
+	Name       string
+	Params     []ast.Param
+	ReturnType string
+	Body       *ast.BlockStmt
+	// Env is the defining *environment.Environment. It is kept opaque here
+	// since the environment package depends on this one.
+	Env any
+}
+
+func (fv *FunctionVal) GetType() ValueType { return fv.Type }
+
+func (fv *FunctionVal) String() string {
+	if fv.Name == "" {
+		return "<anonymous fn>"
+	}
+	return "<fn " + fv.Name + ">"
+}
+
+// NativeFuncVal is a function written in Go, like the print built-ins. It is
+// a value of its own, so it can be passed around like any other function.
+type NativeFuncVal struct {
+	Type ValueType
+	Name string
+	Fn   func(args []RtVal) (RtVal, error)
+}
+
+func (nf *NativeFuncVal) GetType() ValueType { return nf.Type }
+func (nf *NativeFuncVal) String() string     { return "<native fn " + nf.Name + ">" }
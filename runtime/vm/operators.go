@@ -0,0 +1,274 @@
+package vm
+
+import (
+	"berlang/runtime/compiler"
+	"berlang/runtime/ops"
+	"berlang/runtime/values"
+	"fmt"
+	"math"
+)
+
+// operators maps the instructions of the binary operators back to the
+// operators, which is how package ops names them.
+var operators = [...]string{
+	compiler.OpAdd:          "+",
+	compiler.OpSub:          "-",
+	compiler.OpMul:          "*",
+	compiler.OpDiv:          "/",
+	compiler.OpMod:          "%",
+	compiler.OpEqual:        "==",
+	compiler.OpNotEqual:     "!=",
+	compiler.OpLess:         "<",
+	compiler.OpLessEqual:    "<=",
+	compiler.OpGreater:      ">",
+	compiler.OpGreaterEqual: ">=",
+}
+
+// arith applies + - * / %, numbers are handled here without boxing them.
+func arith(op string, lhs, rhs Value) (Value, error) {
+	if lhs.kind == kindInt && rhs.kind == kindInt {
+		result, err := ops.IntArith(op, lhs.int(), rhs.int())
+		return intValue(result), err
+	}
+	if lhs.isNumber() && rhs.isNumber() {
+		result, err := ops.FloatArith(op, lhs.float(), rhs.float())
+		return floatValue(result), err
+	}
+	return binary(op, lhs, rhs)
+}
+
+func compare(op string, lhs, rhs Value) (Value, error) {
+	if lhs.kind == kindInt && rhs.kind == kindInt {
+		result, err := ops.Compare(op, lhs.int(), rhs.int())
+		return boolValue(result), err
+	}
+	if lhs.isNumber() && rhs.isNumber() {
+		result, err := ops.Compare(op, lhs.float(), rhs.float())
+		return boolValue(result), err
+	}
+	return binary(op, lhs, rhs)
+}
+
+func binary(op string, lhs, rhs Value) (Value, error) {
+	result, err := ops.Binary(op, lhs.box(), rhs.box())
+	if err != nil {
+		return Value{}, err
+	}
+	return unbox(result), nil
+}
+
+func negate(v Value) (Value, error) {
+	switch {
+	case v.kind == kindInt && v.int() != math.MinInt64:
+		return intValue(-v.int()), nil
+	case v.kind == kindFloat:
+		return floatValue(-v.float()), nil
+	}
+	result, err := ops.Negate(v.box())
+	if err != nil {
+		return Value{}, err
+	}
+	return unbox(result), nil
+}
+
+// condition checks that a value tested by the construct what is a Bool.
+func condition(v Value, what int) (bool, error) {
+	if v.kind == kindBool {
+		return v.bits != 0, nil
+	}
+	name := "condition"
+	if what < len(compiler.Conditions) {
+		name = compiler.Conditions[what]
+	}
+	return ops.Condition(v.box(), name)
+}
+
+// index evaluates object[i], reading arrays without boxing the index.
+func index(object, i Value) (Value, error) {
+	if array, ok := object.ref.(*values.ArrayVal); ok && i.kind == kindInt {
+		if n := i.int(); n >= 0 && n < int64(len(array.Elements)) {
+			return unbox(array.Elements[n]), nil
+		}
+	}
+
+	result, err := ops.Index(object.box(), i.box())
+	if err != nil {
+		return Value{}, err
+	}
+	return unbox(result), nil
+}
+
+func setIndex(object, i, val Value) error {
+	if array, ok := object.ref.(*values.ArrayVal); ok && i.kind == kindInt {
+		if n := i.int(); n >= 0 && n < int64(len(array.Elements)) {
+			array.Elements[n] = val.box()
+			return nil
+		}
+	}
+	return ops.SetIndex(object.box(), i.box(), val.box())
+}
+
+// slice evaluates OpSlice, bounds says which of the bounds are on the stack.
+func (vm *VM) slice(bounds int) error {
+	var start, end values.RtVal
+	if bounds&2 != 0 {
+		end = vm.pop().box()
+	}
+	if bounds&1 != 0 {
+		start = vm.pop().box()
+	}
+
+	result, err := ops.Slice(vm.stack[vm.sp-1].box(), start, end)
+	if err != nil {
+		return err
+	}
+	vm.stack[vm.sp-1] = unbox(result)
+	return nil
+}
+
+// newStruct builds a struct from its declaration and the values of the
+// fields called names, all on the stack.
+func (vm *VM) newStruct(names []values.RtVal) error {
+	fields := make([]string, len(names))
+	for i, name := range names {
+		fields[i] = name.(*values.StringVal).Value
+	}
+
+	def := vm.stack[vm.sp-len(names)-1].box()
+	result, err := ops.NewStruct(def, fields, vm.boxTop(len(names)))
+	if err != nil {
+		return err
+	}
+	vm.drop(len(names) + 1)
+	vm.push(unbox(result))
+	return nil
+}
+
+// boxTop returns the top n values of the stack as runtime values.
+func (vm *VM) boxTop(n int) []values.RtVal {
+	boxed := make([]values.RtVal, n)
+	for i, v := range vm.stack[vm.sp-n : vm.sp] {
+		boxed[i] = v.box()
+	}
+	return boxed
+}
+
+// callAt calls the value under the top argc values of the stack. A closure
+// gets a frame that run goes on with, anything else is called right away.
+func (vm *VM) callAt(argc int) error {
+	callee := vm.stack[vm.sp-argc-1]
+	if cl, ok := callee.ref.(*closure); ok {
+		return vm.pushFrame(cl, argc, vm.sp-argc-1)
+	}
+
+	result, err := callValue(callee.box(), vm.boxTop(argc))
+	if err != nil {
+		return err
+	}
+	vm.drop(argc + 1)
+	vm.push(unbox(result))
+	return nil
+}
+
+// callValue calls an enum constructor or a native function, closures are
+// handled by the callers.
+func callValue(callee values.RtVal, args []values.RtVal) (values.RtVal, error) {
+	switch callee := callee.(type) {
+	case *values.ConstructorVal:
+		return ops.Construct(callee, args)
+	case *values.NativeFuncVal:
+		return callee.Fn(args)
+	default:
+		return nil, fmt.Errorf("cannot call a value of type %s", callee.GetType())
+	}
+}
+
+// callBuiltin calls the built-in called name with the top argc values of
+// the stack, or the global of the same name when there is one.
+func (vm *VM) callBuiltin(name string, argc int) error {
+	if g := vm.globals[name]; g != nil {
+		// The global goes under the arguments, where callAt expects it
+		vm.push(Value{})
+		copy(vm.stack[vm.sp-argc:vm.sp], vm.stack[vm.sp-argc-1:vm.sp-1])
+		vm.stack[vm.sp-argc-1] = g.value
+		return vm.callAt(argc)
+	}
+
+	builtin, found := ops.Builtins[name]
+	if !found {
+		return fmt.Errorf("unknown built-in '%s'", name)
+	}
+	args := vm.boxTop(argc)
+	vm.drop(argc)
+
+	result, err := builtin(vm, args)
+	if err != nil {
+		return err
+	}
+	vm.push(unbox(result))
+	return nil
+}
+
+// match tests v against a pattern, pushing the values it binds. On a failed
+// match the caller drops whatever was pushed.
+func (vm *VM) match(p *compiler.Pattern, v Value) (bool, error) {
+	switch p.Kind {
+	case compiler.PatternWildcard:
+		return true, nil
+
+	case compiler.PatternBinding:
+		vm.push(v)
+		return true, nil
+
+	case compiler.PatternLiteral:
+		return ops.MatchLiteral(p.Literal, v.box())
+
+	case compiler.PatternVariant:
+		ev, err := ops.MatchVariant(p.Enum, p.Variant, len(p.Fields), v.box())
+		if ev == nil || err != nil {
+			return false, err
+		}
+		for i := range p.Fields {
+			if matched, err := vm.match(&p.Fields[i], unbox(ev.Fields[i])); err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+
+	default:
+		return false, fmt.Errorf("unrecognized pattern kind %d", p.Kind)
+	}
+}
+
+// iterator is the state of a for-in loop, kept in a slot under the loop
+// variables. Like in the interpreter it works on a snapshot.
+type iterator struct {
+	keys []values.RtVal // nil unless iterating over a map
+	vals []values.RtVal
+	next int
+}
+
+func (it *iterator) GetType() values.ValueType { return "Iterator" }
+func (it *iterator) String() string            { return "<iterator>" }
+
+// advance pushes the loop variables of the next iteration. A single name
+// gets the key of a map, or the element of an array or string, two names get
+// the key or position and the element.
+func (it *iterator) advance(vm *VM, names int) {
+	i := it.next
+	it.next++
+
+	key := intValue(int64(i))
+	if it.keys != nil {
+		key = unbox(it.keys[i])
+	}
+	if names == 1 {
+		if it.keys == nil {
+			key = unbox(it.vals[i])
+		}
+		vm.push(key)
+		return
+	}
+	vm.push(key)
+	vm.push(unbox(it.vals[i]))
+}
@@ -0,0 +1,233 @@
+package vm
+
+import (
+	"berlang/runtime/compiler"
+	"berlang/runtime/ops"
+	"berlang/runtime/values"
+	"fmt"
+)
+
+// run executes instructions until the frame at index stop returns, and
+// returns its result.
+func (vm *VM) run(stop int) (Value, error) {
+	f := &vm.frames[len(vm.frames)-1]
+	for {
+		offset := f.ip
+		op := compiler.Op(f.code[offset])
+		f.ip++
+
+		var err error
+		switch op {
+		case compiler.OpConstant:
+			vm.push(f.proto.consts[f.u16()])
+		case compiler.OpNone:
+			vm.push(noneValue)
+		case compiler.OpTrue:
+			vm.push(boolValue(true))
+		case compiler.OpFalse:
+			vm.push(boolValue(false))
+		case compiler.OpPop:
+			vm.pop()
+		case compiler.OpPopN:
+			vm.drop(f.u16())
+		case compiler.OpCloseScope:
+			top := vm.pop()
+			vm.drop(f.u16())
+			vm.push(top)
+
+		case compiler.OpGetLocal:
+			vm.push(vm.stack[f.base+f.u16()])
+		case compiler.OpSetLocal:
+			vm.stack[f.base+f.u16()] = vm.stack[vm.sp-1]
+		case compiler.OpGetUpvalue:
+			uv := f.closure.upvalues[f.u16()]
+			if uv.slot >= 0 {
+				vm.push(vm.stack[uv.slot])
+			} else {
+				vm.push(uv.closed)
+			}
+		case compiler.OpSetUpvalue:
+			uv := f.closure.upvalues[f.u16()]
+			if uv.slot >= 0 {
+				vm.stack[uv.slot] = vm.stack[vm.sp-1]
+			} else {
+				uv.closed = vm.stack[vm.sp-1]
+			}
+
+		case compiler.OpDefineGlobal:
+			name, constant := f.proto.name(f.u16()), f.u8() == 1
+			if g := vm.globals[name]; g != nil {
+				// Keep the same global so the lookups cached by other
+				// functions see the new value
+				g.value, g.constant = vm.pop(), constant
+			} else {
+				vm.globals[name] = &global{value: vm.pop(), constant: constant}
+			}
+		case compiler.OpGetGlobal:
+			i := f.u16()
+			if g := vm.global(f.proto, i); g != nil {
+				vm.push(g.value)
+			} else {
+				err = fmt.Errorf("identifier '%s' not found", f.proto.name(i))
+			}
+		case compiler.OpSetGlobal:
+			i := f.u16()
+			switch g := vm.global(f.proto, i); {
+			case g == nil:
+				err = fmt.Errorf("variable '%s' not found", f.proto.name(i))
+			case g.constant:
+				err = fmt.Errorf("variable '%s' is a constant and cannot be reassigned", f.proto.name(i))
+			default:
+				g.value = vm.stack[vm.sp-1]
+			}
+
+		case compiler.OpAdd, compiler.OpSub, compiler.OpMul, compiler.OpDiv, compiler.OpMod:
+			var result Value
+			if result, err = arith(operators[op], vm.stack[vm.sp-2], vm.stack[vm.sp-1]); err == nil {
+				vm.pop()
+				vm.stack[vm.sp-1] = result
+			}
+		case compiler.OpEqual, compiler.OpNotEqual, compiler.OpLess, compiler.OpLessEqual, compiler.OpGreater, compiler.OpGreaterEqual:
+			var result Value
+			if result, err = compare(operators[op], vm.stack[vm.sp-2], vm.stack[vm.sp-1]); err == nil {
+				vm.pop()
+				vm.stack[vm.sp-1] = result
+			}
+		case compiler.OpNegate:
+			var result Value
+			if result, err = negate(vm.stack[vm.sp-1]); err == nil {
+				vm.stack[vm.sp-1] = result
+			}
+		case compiler.OpNot:
+			var b bool
+			if b, err = condition(vm.stack[vm.sp-1], f.u8()); err == nil {
+				vm.stack[vm.sp-1] = boolValue(!b)
+			}
+		case compiler.OpCheckBool:
+			_, err = condition(vm.stack[vm.sp-1], f.u8())
+
+		case compiler.OpJump:
+			jump := f.u16()
+			f.ip += jump
+		case compiler.OpJumpIfFalse, compiler.OpJumpIfTrue:
+			what, jump := f.u8(), f.u16()
+			var b bool
+			if b, err = condition(vm.pop(), what); err == nil && b == (op == compiler.OpJumpIfTrue) {
+				f.ip += jump
+			}
+		case compiler.OpLoop:
+			jump := f.u16()
+			f.ip -= jump
+			err = vm.step()
+
+		case compiler.OpCall:
+			if err = vm.callAt(f.u8()); err == nil {
+				f = &vm.frames[len(vm.frames)-1]
+			}
+		case compiler.OpBuiltin:
+			name, argc := f.proto.name(f.u16()), f.u8()
+			if err = vm.callBuiltin(name, argc); err == nil {
+				f = &vm.frames[len(vm.frames)-1]
+			}
+		case compiler.OpClosure:
+			p := f.proto.program[f.u16()]
+			cl := &closure{proto: p, upvalues: make([]*upvalue, len(p.fn.Upvalues))}
+			for i, uv := range p.fn.Upvalues {
+				if uv.Local {
+					cl.upvalues[i] = vm.capture(f.base + uv.Index)
+				} else {
+					cl.upvalues[i] = f.closure.upvalues[uv.Index]
+				}
+			}
+			vm.push(Value{kind: kindRef, ref: cl})
+		case compiler.OpReturn:
+			result := vm.pop()
+			vm.drop(vm.sp - f.ret)
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == stop {
+				return result, nil
+			}
+			vm.push(result)
+			f = &vm.frames[len(vm.frames)-1]
+
+		case compiler.OpArray:
+			n := f.u16()
+			elements := vm.boxTop(n)
+			vm.drop(n)
+			vm.push(Value{kind: kindRef, ref: ops.NewArray(elements)})
+		case compiler.OpMap:
+			n := f.u16()
+			m := values.NewMapVal()
+			for i := vm.sp - 2*n; i < vm.sp && err == nil; i += 2 {
+				err = m.Set(vm.stack[i].box(), vm.stack[i+1].box())
+			}
+			vm.drop(2 * n)
+			vm.push(Value{kind: kindRef, ref: m})
+		case compiler.OpIndex:
+			var result Value
+			if result, err = index(vm.stack[vm.sp-2], vm.stack[vm.sp-1]); err == nil {
+				vm.pop()
+				vm.stack[vm.sp-1] = result
+			}
+		case compiler.OpSetIndex:
+			if err = setIndex(vm.stack[vm.sp-3], vm.stack[vm.sp-2], vm.stack[vm.sp-1]); err == nil {
+				val := vm.pop()
+				vm.drop(2)
+				vm.push(val)
+			}
+		case compiler.OpSlice:
+			err = vm.slice(f.u8())
+		case compiler.OpStruct:
+			names := f.proto.fn.Constants[f.u16()].(*values.ArrayVal).Elements
+			err = vm.newStruct(names)
+		case compiler.OpGetField:
+			var result values.RtVal
+			if result, err = ops.Field(vm.stack[vm.sp-1].box(), f.proto.name(f.u16())); err == nil {
+				vm.stack[vm.sp-1] = unbox(result)
+			}
+		case compiler.OpSetField:
+			name := f.proto.name(f.u16())
+			if err = ops.SetField(vm.stack[vm.sp-2].box(), name, vm.stack[vm.sp-1].box()); err == nil {
+				val := vm.pop()
+				vm.stack[vm.sp-1] = val
+			}
+
+		case compiler.OpMatch:
+			pattern, slot := f.u16(), f.u16()
+			sp := vm.sp
+			var matched bool
+			if matched, err = vm.match(&f.proto.fn.Patterns[pattern], vm.stack[f.base+slot]); !matched {
+				vm.drop(vm.sp - sp)
+			}
+			vm.push(boolValue(matched))
+		case compiler.OpNoMatch:
+			err = fmt.Errorf("no arm of the match matched %s", vm.stack[f.base+f.u16()].box())
+		case compiler.OpIter:
+			var keys, vals []values.RtVal
+			if keys, vals, err = ops.Iterate(vm.stack[vm.sp-1].box()); err == nil {
+				vm.stack[vm.sp-1] = Value{kind: kindRef, ref: &iterator{keys: keys, vals: vals}}
+			}
+		case compiler.OpNext:
+			slot, names, jump := f.u16(), f.u8(), f.u16()
+			it, ok := vm.stack[f.base+slot].ref.(*iterator)
+			if !ok {
+				// Only a changed .blc file gets here, the verifier can not
+				// tell what the slots hold
+				err = fmt.Errorf("malformed bytecode: slot %d holds no iterator", slot)
+				break
+			}
+			if it.next == len(it.vals) {
+				f.ip += jump
+				break
+			}
+			it.advance(vm, names)
+
+		default:
+			err = fmt.Errorf("unknown instruction %d", op)
+		}
+
+		if err != nil {
+			return Value{}, wrap(err, f, offset)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package vm
+
+import (
+	"berlang/runtime/ops"
+	"berlang/runtime/values"
+	"math"
+)
+
+type kind uint8
+
+const (
+	kindNone kind = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindRef
+)
+
+// Value is a slot of the stack. Ints, Floats and Bools are stored in it
+// directly so arithmetic does not allocate, everything else refers to the
+// same runtime values the interpreter uses.
+type Value struct {
+	kind kind
+	bits uint64 // The Int, the bits of the Float or 1 for true
+	ref  values.RtVal
+}
+
+var noneValue = Value{kind: kindNone}
+
+func intValue(i int64) Value {
+	return Value{kind: kindInt, bits: uint64(i)}
+}
+
+func floatValue(f float64) Value {
+	return Value{kind: kindFloat, bits: math.Float64bits(f)}
+}
+
+func boolValue(b bool) Value {
+	if b {
+		return Value{kind: kindBool, bits: 1}
+	}
+	return Value{kind: kindBool}
+}
+
+func (v Value) int() int64 {
+	return int64(v.bits)
+}
+
+// float returns a number as a Float, promoting Ints.
+func (v Value) float() float64 {
+	if v.kind == kindInt {
+		return float64(int64(v.bits))
+	}
+	return math.Float64frombits(v.bits)
+}
+
+func (v Value) isNumber() bool {
+	return v.kind == kindInt || v.kind == kindFloat
+}
+
+// box returns v as a runtime value, allocating one for the kinds stored in
+// the slot.
+func (v Value) box() values.RtVal {
+	switch v.kind {
+	case kindInt:
+		return ops.NewInt(v.int())
+	case kindFloat:
+		return ops.NewFloat(v.float())
+	case kindBool:
+		return ops.NewBool(v.bits != 0)
+	case kindNone:
+		return ops.NewNone()
+	default:
+		return v.ref
+	}
+}
+
+// unbox is the opposite of box.
+func unbox(v values.RtVal) Value {
+	switch v := v.(type) {
+	case *values.IntVal:
+		return intValue(v.Value)
+	case *values.FloatVal:
+		return floatValue(v.Value)
+	case *values.BoolVal:
+		return boolValue(v.Value)
+	case *values.NoneVal, nil:
+		return noneValue
+	default:
+		return Value{kind: kindRef, ref: v}
+	}
+}
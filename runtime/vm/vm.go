@@ -0,0 +1,298 @@
+// Package vm runs the bytecode of the compiler package. Values live on a
+// single stack, the locals of a call are the slots from its frame's base
+// up, and globals are kept by name so they persist between programs run on
+// the same VM.
+package vm
+
+import (
+	"berlang/diagnostics"
+	"berlang/frontend/ast"
+	"berlang/runtime/compiler"
+	"berlang/runtime/ops"
+	"berlang/runtime/values"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxCallDepth bounds recursion so runaway programs fail with an error, the
+// same limit as the interpreter's.
+const maxCallDepth = 10000
+
+type VM struct {
+	stack  []Value
+	sp     int
+	frames []frame
+	// open holds the upvalues that still point into the stack, ordered by
+	// their slot
+	open    []*upvalue
+	globals map[string]*global
+	// steps counts the backward jumps and calls of the program being run,
+	// stepLimit bounds them when it is not 0
+	steps     int
+	stepLimit int
+}
+
+type global struct {
+	value    Value
+	constant bool
+}
+
+type frame struct {
+	proto   *proto
+	closure *closure
+	code    []byte
+	ip      int
+	base    int // The stack index of slot 0
+	ret     int // The stack height to go back to when the call returns
+}
+
+// u16 reads a 16 bit operand.
+func (f *frame) u16() int {
+	v := int(f.code[f.ip])<<8 | int(f.code[f.ip+1])
+	f.ip += 2
+	return v
+}
+
+func (f *frame) u8() int {
+	v := int(f.code[f.ip])
+	f.ip++
+	return v
+}
+
+// proto is a function of a running program, with its constants already
+// turned into values.
+type proto struct {
+	fn     *compiler.Function
+	consts []Value
+	// globals caches the globals looked up by name constant
+	globals []*global
+	program []*proto
+}
+
+func (p *proto) name(i int) string {
+	return p.fn.Constants[i].(*values.StringVal).Value
+}
+
+// closure is a function value created by OpClosure.
+type closure struct {
+	proto    *proto
+	upvalues []*upvalue
+}
+
+func (c *closure) GetType() values.ValueType { return values.FunctionValue }
+
+func (c *closure) String() string {
+	if c.proto.fn.Name == "" {
+		return "<anonymous fn>"
+	}
+	return "<fn " + c.proto.fn.Name + ">"
+}
+
+func (c *closure) describe() string {
+	if c.proto.fn.Name == "" {
+		return "anonymous function"
+	}
+	return fmt.Sprintf("function '%s'", c.proto.fn.Name)
+}
+
+// upvalue is a variable captured by a closure. It points to the slot of the
+// variable until the variable goes out of scope, then the value moves into
+// the upvalue.
+type upvalue struct {
+	slot   int // -1 once closed
+	closed Value
+}
+
+// New creates a VM whose programs print to out.
+func New(out io.Writer) *VM {
+	vm := &VM{stack: make([]Value, 256), globals: make(map[string]*global)}
+	// The natives are globals that programs may declare over
+	for name, native := range ops.Natives(out) {
+		vm.globals[name] = &global{value: unbox(native)}
+	}
+	return vm
+}
+
+// SetStepLimit makes Run fail once a program has run more than limit loop
+// iterations and calls together, like the interpreter's limit. 0 means no
+// limit.
+func (vm *VM) SetStepLimit(limit int) {
+	vm.stepLimit = limit
+}
+
+// step counts a loop iteration or a call against the step limit.
+func (vm *VM) step() error {
+	vm.steps++
+	if vm.stepLimit > 0 && vm.steps > vm.stepLimit {
+		return fmt.Errorf("step limit of %d exceeded, the program ran too long", vm.stepLimit)
+	}
+	return nil
+}
+
+// Evaluate compiles and runs a program, a drop-in for the interpreter's
+// Evaluate.
+func (vm *VM) Evaluate(stmt ast.Stmt) (values.RtVal, error) {
+	if program, ok := stmt.(*ast.Program); ok && len(program.Body) == 0 {
+		return nil, nil
+	}
+
+	program, err := compiler.Compile(stmt)
+	if err != nil {
+		return nil, err
+	}
+	return vm.Run(program)
+}
+
+// Run runs a compiled program and returns the value of its last statement.
+func (vm *VM) Run(program *compiler.Program) (values.RtVal, error) {
+	protos := make([]*proto, len(program.Functions))
+	for i, fn := range program.Functions {
+		consts := make([]Value, len(fn.Constants))
+		for j, constant := range fn.Constants {
+			consts[j] = unbox(constant)
+		}
+		protos[i] = &proto{fn: fn, consts: consts, globals: make([]*global, len(fn.Constants)), program: protos}
+	}
+
+	if err := vm.pushFrame(&closure{proto: protos[0]}, 0, vm.sp); err != nil {
+		return nil, err
+	}
+	// Running the script itself is not a call
+	vm.steps = 0
+	result, err := vm.run(len(vm.frames) - 1)
+	if err != nil {
+		vm.reset()
+		return nil, err
+	}
+	return result.box(), nil
+}
+
+// Call calls a function for the built-ins that take one, like map.
+func (vm *VM) Call(callee values.RtVal, args []values.RtVal) (values.RtVal, error) {
+	cl, ok := callee.(*closure)
+	if !ok {
+		return callValue(callee, args)
+	}
+
+	ret := vm.sp
+	for _, arg := range args {
+		vm.push(unbox(arg))
+	}
+	if err := vm.pushFrame(cl, len(args), ret); err != nil {
+		vm.sp = ret
+		return nil, err
+	}
+
+	result, err := vm.run(len(vm.frames) - 1)
+	if err != nil {
+		return nil, err
+	}
+	return result.box(), nil
+}
+
+// reset drops everything left over by a program that failed.
+func (vm *VM) reset() {
+	vm.closeUpvalues(0)
+	clear(vm.stack[:vm.sp])
+	vm.sp = 0
+	vm.frames = vm.frames[:0]
+}
+
+// pushFrame starts a call of cl with the top argc values of the stack as
+// its arguments.
+func (vm *VM) pushFrame(cl *closure, argc int, ret int) error {
+	if argc != cl.proto.fn.Arity {
+		return fmt.Errorf("%s expects %d arguments, got %d", cl.describe(), cl.proto.fn.Arity, argc)
+	}
+	if len(vm.frames) > maxCallDepth {
+		return fmt.Errorf("stack overflow: maximum call depth of %d exceeded", maxCallDepth)
+	}
+	if err := vm.step(); err != nil {
+		return err
+	}
+
+	vm.frames = append(vm.frames, frame{
+		proto:   cl.proto,
+		closure: cl,
+		code:    cl.proto.fn.Code,
+		base:    vm.sp - argc,
+		ret:     ret,
+	})
+	return nil
+}
+
+func (vm *VM) push(v Value) {
+	if vm.sp == len(vm.stack) {
+		vm.stack = append(vm.stack, make([]Value, len(vm.stack))...)
+	}
+	vm.stack[vm.sp] = v
+	vm.sp++
+}
+
+func (vm *VM) pop() Value {
+	vm.sp--
+	v := vm.stack[vm.sp]
+	vm.stack[vm.sp] = Value{}
+	return v
+}
+
+// drop pops n values, closing the upvalues of any of them.
+func (vm *VM) drop(n int) {
+	vm.closeUpvalues(vm.sp - n)
+	clear(vm.stack[vm.sp-n : vm.sp])
+	vm.sp -= n
+}
+
+// capture returns the upvalue for a slot, sharing it with the closures that
+// already captured the same variable.
+func (vm *VM) capture(slot int) *upvalue {
+	i := len(vm.open)
+	for i > 0 && vm.open[i-1].slot >= slot {
+		if vm.open[i-1].slot == slot {
+			return vm.open[i-1]
+		}
+		i--
+	}
+
+	uv := &upvalue{slot: slot}
+	vm.open = append(vm.open, nil)
+	copy(vm.open[i+1:], vm.open[i:])
+	vm.open[i] = uv
+	return uv
+}
+
+// closeUpvalues moves the variables in the slots from from up into their
+// upvalues, as those slots are about to be dropped.
+func (vm *VM) closeUpvalues(from int) {
+	for len(vm.open) > 0 {
+		uv := vm.open[len(vm.open)-1]
+		if uv.slot < from {
+			return
+		}
+		uv.closed = vm.stack[uv.slot]
+		uv.slot = -1
+		vm.open = vm.open[:len(vm.open)-1]
+	}
+}
+
+// global finds the global named by constant i of p.
+func (vm *VM) global(p *proto, i int) *global {
+	if g := p.globals[i]; g != nil {
+		return g
+	}
+	g := vm.globals[p.name(i)]
+	p.globals[i] = g
+	return g
+}
+
+// wrap turns err into a diagnostic at the source of the instruction at
+// offset. Errors that already are diagnostics come from a call deeper down
+// and are left alone.
+func wrap(err error, f *frame, offset int) error {
+	var d *diagnostics.Diagnostic
+	if errors.As(err, &d) {
+		return err
+	}
+	return diagnostics.Errorf(diagnostics.CodeRuntime, f.proto.fn.SpanAt(offset), "%v", err)
+}
@@ -0,0 +1,175 @@
+package terminal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// errInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// newLineReader returns an editing line reader when in is a terminal, and a
+// plain one otherwise, e.g. when input is piped in.
+func newLineReader(in *os.File, out io.Writer, history func() []string) lineReader {
+	if isTerminal(in) {
+		return &lineEditor{file: in, in: bufio.NewReader(in), out: out, history: history}
+	}
+	return &plainReader{in: bufio.NewReader(in), out: out}
+}
+
+type plainReader struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+
+	line, err := r.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// lineEditor is a small readline: it supports cursor movement, the usual
+// Emacs style shortcuts and walking through the history with the arrow keys.
+type lineEditor struct {
+	file    *os.File
+	in      *bufio.Reader
+	out     io.Writer
+	history func() []string
+}
+
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	restore, err := enableRawMode(e.file)
+	if err != nil {
+		return (&plainReader{in: e.in, out: e.out}).ReadLine(prompt)
+	}
+	defer restore()
+
+	// Multi-line history entries are recalled on a single line
+	history := e.history()
+	for i, entry := range history {
+		history[i] = strings.ReplaceAll(entry, "\n", " ")
+	}
+	histIdx := len(history)
+	var draft []rune
+
+	var buf []rune
+	pos := 0
+
+	refresh := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if back := len(buf) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	recall := func(idx int) {
+		if histIdx == len(history) {
+			draft = buf
+		}
+		histIdx = idx
+		if idx == len(history) {
+			buf = draft
+		} else {
+			buf = []rune(history[idx])
+		}
+		pos = len(buf)
+	}
+
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 127, 8: // Backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(buf)
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+		case 21: // Ctrl-U
+			buf = append([]rune(nil), buf[pos:]...)
+			pos = 0
+		case 23: // Ctrl-W
+			start := pos
+			for start > 0 && buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && buf[start-1] != ' ' {
+				start--
+			}
+			buf = append(buf[:start], buf[pos:]...)
+			pos = start
+		case 27: // Escape sequences for the arrow, home, end and delete keys
+			if b, _ := e.in.ReadByte(); b != '[' && b != 'O' {
+				break
+			}
+			code, _ := e.in.ReadByte()
+			switch code {
+			case 'A':
+				if histIdx > 0 {
+					recall(histIdx - 1)
+				}
+			case 'B':
+				if histIdx < len(history) {
+					recall(histIdx + 1)
+				}
+			case 'C':
+				if pos < len(buf) {
+					pos++
+				}
+			case 'D':
+				if pos > 0 {
+					pos--
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(buf)
+			case '3':
+				if next, _ := e.in.ReadByte(); next == '~' && pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if r < 32 {
+				break
+			}
+			buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+			pos++
+		}
+		refresh()
+	}
+}
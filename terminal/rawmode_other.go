@@ -0,0 +1,19 @@
+//go:build !linux
+
+package terminal
+
+import (
+	"errors"
+	"os"
+)
+
+// Line editing is only implemented for Linux terminals, everywhere else the
+// REPL falls back to plain line reading.
+
+func isTerminal(f *os.File) bool {
+	return false
+}
+
+func enableRawMode(f *os.File) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
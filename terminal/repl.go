@@ -0,0 +1,122 @@
+package terminal
+
+import (
+	"berlang/frontend/lexer"
+	"berlang/utils"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const replHelp = `Meta commands:
+  :env          list the variables in the global environment
+  :reset        forget every declared variable
+  :load <file>  run a script and keep its declarations
+  :help         show this message
+  :quit         leave the REPL
+`
+
+// RunREPL reads commands from in until EOF or :quit, evaluating each one
+// against the terminal's runtime so declarations persist between inputs.
+// Input with unbalanced ( or { keeps reading lines before evaluating.
+func (t *Terminal) RunREPL(in *os.File, out io.Writer) error {
+	fmt.Fprintln(out, "Berlang REPL, type :help for help.")
+
+	reader := newLineReader(in, out, t.History)
+	var pending []string
+
+	for {
+		prompt := "> "
+		if len(pending) > 0 {
+			prompt = "... "
+		}
+
+		line, err := reader.ReadLine(prompt)
+		if errors.Is(err, errInterrupted) {
+			pending = nil
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(pending) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := t.runMetaCommand(strings.TrimSpace(line), out); quit {
+				return nil
+			}
+			continue
+		}
+
+		pending = append(pending, line)
+		command := strings.Join(pending, "\n")
+		if IsIncomplete(command) {
+			continue
+		}
+		pending = nil
+
+		printResult(out, t.ExecuteCommand(command))
+	}
+}
+
+// runMetaCommand handles a REPL command starting with ':'. It reports whether
+// the REPL should exit.
+func (t *Terminal) runMetaCommand(line string, out io.Writer) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":env":
+		fmt.Fprint(out, t.Env())
+	case ":reset":
+		t.Reset()
+		fmt.Fprintln(out, "Environment cleared.")
+	case ":load":
+		if arg == "" {
+			fmt.Fprintln(out, "usage: :load <file>")
+			break
+		}
+		printResult(out, t.LoadFile(arg))
+	case ":help":
+		fmt.Fprint(out, replHelp)
+	case ":quit", ":q":
+		return true
+	default:
+		fmt.Fprintf(out, "unknown command %s, type :help for help\n", name)
+	}
+	return false
+}
+
+func printResult(out io.Writer, result CommandResult) {
+	if result.Output != "" {
+		fmt.Fprintln(out, result.Output)
+	}
+	if result.Error != "" {
+		fmt.Fprintln(out, result.Error)
+	}
+}
+
+// IsIncomplete reports whether src has more opening (, { or [ than closing ones,
+// meaning the user is still in the middle of typing it.
+func IsIncomplete(src string) bool {
+	tokens, err := lexer.NewLexer(strings.NewReader(src)).Lex()
+	if err != nil {
+		// Let the evaluation report the error
+		return false
+	}
+
+	depth := 0
+	for _, tok := range tokens.Tokens() {
+		switch tok.Type {
+		case utils.TOKEN_LPAREN, utils.TOKEN_LBRACE, utils.TOKEN_LBRACKET:
+			depth++
+		case utils.TOKEN_RPAREN, utils.TOKEN_RBRACE, utils.TOKEN_RBRACKET:
+			depth--
+		}
+	}
+	return depth > 0
+}
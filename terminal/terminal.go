@@ -1,73 +1,199 @@
 package terminal
 
 import (
+	"berlang/diagnostics"
 	"berlang/frontend/lexer"
 	"berlang/frontend/parser"
+	"berlang/frontend/types"
+	"berlang/runtime/environment"
 	"berlang/runtime/interpreter"
+	"berlang/runtime/values"
+	"bytes"
 	"fmt"
+	"html"
+	"html/template"
+	"os"
 	"strings"
 	"sync"
 )
 
 type Terminal struct {
-    runtime interpreter.Runtime
-    mu      sync.Mutex
-    history []string
+	checker *types.Checker
+	runtime interpreter.Runtime
+	// out collects what the command being executed prints
+	out       *bytes.Buffer
+	stepLimit int
+	mu        sync.Mutex
+	history   []string
 }
 
-
 func NewTerminal() *Terminal {
-    return &Terminal{
-        runtime: interpreter.NewRuntime(),
-        history: make([]string, 0),
-    }
+	out := &bytes.Buffer{}
+	return &Terminal{
+		checker: types.NewChecker(),
+		runtime: interpreter.NewRuntime(out),
+		out:     out,
+		history: make([]string, 0),
+	}
 }
 
 type CommandResult struct {
-    Command string
-    Output  string
-    Error   string
+	Command string
+	// Output is what the command printed followed by its value, it is set
+	// even when the command failed half way
+	Output string
+	Error  string
+	// ErrorHTML is Error rendered for the web terminal, with the source
+	// snippets of any diagnostics already escaped. It is the only field the
+	// views put in the page as it is, the others are escaped
+	ErrorHTML template.HTML
 }
 
+// inputName stands in for a file name when rendering diagnostics about
+// commands typed into the terminal.
+const inputName = "<input>"
+
 func (t *Terminal) ExecuteCommand(command string) CommandResult {
-    t.mu.Lock()
-    defer t.mu.Unlock()
-
-    command = strings.TrimSpace(command)
-    if command == "" {
-        return CommandResult{}
-    }
-
-    t.history = append(t.history, command)
-
-    lexer := lexer.NewLexer(strings.NewReader(command))
-    ts, err := lexer.Lex()
-    if err != nil {
-        return CommandResult{
-            Command: command,
-            Error: "Lexing error: " + err.Error(),
-        }
-    }
-
-    parser := parser.NewParser(ts)
-    result, err := parser.Parse()
-    if err != nil {
-        return CommandResult{
-            Command: command,
-            Error: "Parsing error: " + err.Error(),
-        }
-    }
-
-    rtresult, err := t.runtime.Evaluate(result)
-    if err != nil {
-        return CommandResult{
-            Command: command,
-            Error: "Runtime error: " + err.Error(),
-        }
-    }
-
-    return CommandResult{
-        Command: command,
-        Output: fmt.Sprintf("%+v", rtresult),
-    }
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return CommandResult{}
+	}
+
+	t.history = append(t.history, command)
+
+	return t.execute(inputName, command)
+}
+
+// LoadFile runs a script against the terminal's runtime, keeping everything it
+// declares. The file is not added to the history.
+func (t *Terminal) LoadFile(path string) CommandResult {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return CommandResult{Command: ":load " + path, Error: err.Error()}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := t.execute(path, string(src))
+	result.Command = ":load " + path
+	return result
+}
+
+// Reset throws away every declared variable. The history is kept.
+func (t *Terminal) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.checker = types.NewChecker()
+	t.runtime = interpreter.NewRuntime(t.out)
+	t.runtime.SetStepLimit(t.stepLimit)
+}
+
+// SetStepLimit bounds the loop iterations and calls of every command, so a
+// command that never stops fails instead of holding the terminal. 0 means
+// no limit.
+func (t *Terminal) SetStepLimit(limit int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stepLimit = limit
+	t.runtime.SetStepLimit(limit)
+}
+
+// History returns a copy of the commands executed so far, oldest first.
+func (t *Terminal) History() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string(nil), t.history...)
+}
+
+// Env describes the variables in the global environment, one per line.
+func (t *Terminal) Env() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var sb strings.Builder
+	t.runtime.Globals.Each(func(name string, v environment.Variable) {
+		fmt.Fprintf(&sb, "%s: %s = %s\n", name, v.ValType(), formatValue(v.Value()))
+	})
+	return sb.String()
+}
+
+func (t *Terminal) execute(filename string, command string) CommandResult {
+	parser := parser.NewParser(lexer.NewLexer(strings.NewReader(command)))
+	result, err := parser.Parse()
+	if err != nil {
+		return errorResult(filename, command, "Parsing error", err)
+	}
+
+	// A command that fails at run time is undone in the runtime's globals
+	// and never reaches the checker's, so the two keep agreeing on what is
+	// declared
+	if err := t.checker.CheckPending(result); err != nil {
+		return errorResult(filename, command, "Type error", err)
+	}
+
+	t.out.Reset()
+	globals := t.runtime.Globals.Snapshot()
+	rtresult, err := t.runtime.Evaluate(result)
+	printed := strings.TrimSuffix(t.out.String(), "\n")
+	if err != nil {
+		t.runtime.Globals.Restore(globals)
+		res := errorResult(filename, command, "Runtime error", err)
+		res.Output = printed
+		return res
+	}
+	t.checker.Commit()
+
+	return CommandResult{
+		Command: command,
+		Output:  joinOutput(printed, rtresult),
+	}
+}
+
+// joinOutput puts the value of a command on the line after what it printed.
+// A none after printed text is the value of print itself, it is left out.
+func joinOutput(printed string, result values.RtVal) string {
+	value := formatValue(result)
+	if _, none := result.(*values.NoneVal); none && printed != "" || value == "" {
+		return printed
+	}
+	if printed == "" {
+		return value
+	}
+	return printed + "\n" + value
+}
+
+// errorResult describes err for both the REPL and the web terminal. Errors
+// without a location fall back to a single line prefixed with the stage
+// that failed.
+func errorResult(filename string, command string, stage string, err error) CommandResult {
+	diags := diagnostics.From(err)
+	if diags == nil {
+		msg := stage + ": " + err.Error()
+		return CommandResult{Command: command, Error: msg, ErrorHTML: template.HTML(html.EscapeString(msg))}
+	}
+
+	var text, markup strings.Builder
+	for _, d := range diags {
+		diagnostics.Render(&text, d, filename, command)
+		markup.WriteString(diagnostics.RenderHTML(d, filename, command))
+	}
+	return CommandResult{
+		Command:   command,
+		Error:     strings.TrimSuffix(text.String(), "\n"),
+		ErrorHTML: template.HTML(markup.String()),
+	}
+}
+
+func formatValue(v values.RtVal) string {
+	if v == nil {
+		return ""
+	}
+	return v.String()
 }
@@ -0,0 +1,115 @@
+package terminal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsIncomplete(t *testing.T) {
+	tests := map[string]bool{
+		"1 + 2":                         false,
+		"def f() {":                     true,
+		"def f() {\n  return (1 +":      true,
+		"def f() {\n  return [1, 2]\n}": false,
+		"let xs: int[] = [1,":           true,
+		"}":                             false,
+		`let s: string = "{"`:           false,
+		// A lexing error is left for the evaluation to report
+		`"unterminated {`: false,
+	}
+
+	for input, expected := range tests {
+		if got := IsIncomplete(input); got != expected {
+			t.Errorf("IsIncomplete(%q): expected %v, got %v", input, expected, got)
+		}
+	}
+}
+
+func TestExecuteCommand(t *testing.T) {
+	term := NewTerminal()
+	if result := term.ExecuteCommand("let a: int = 1"); result.Error != "" {
+		t.Fatalf("Unexpected error: %s", result.Error)
+	}
+	if result := term.ExecuteCommand("println(a)\na + 1"); result.Output != "1\n2" {
+		t.Errorf("Expected the printed text and the value, got %q", result.Output)
+	}
+
+	// A declaration that fails at run time is unknown to the checker too
+	if result := term.ExecuteCommand("let b: int = 1 / 0"); result.Error == "" {
+		t.Fatalf("Expected a runtime error dividing by zero")
+	}
+	if result := term.ExecuteCommand("b"); !strings.Contains(result.Error, "undeclared identifier 'b'") {
+		t.Errorf("Expected 'b' to be undeclared, got %q", result.Error)
+	}
+	if result := term.ExecuteCommand("let b: int = 2\nb"); result.Error != "" || result.Output != "2" {
+		t.Errorf("Expected b to be declared again, got %+v", result)
+	}
+
+	// So are the declarations and assignments that ran before the failure
+	if result := term.ExecuteCommand("let c: int = 1; a = 5; let z: int = 1 / 0"); result.Error == "" {
+		t.Fatalf("Expected a runtime error dividing by zero")
+	}
+	if env := term.Env(); strings.Contains(env, "c:") || !strings.Contains(env, "a: int = 1\n") {
+		t.Errorf("Expected the failed command to be undone, got the environment:\n%s", env)
+	}
+	if result := term.ExecuteCommand("c"); !strings.Contains(result.Error, "undeclared identifier 'c'") {
+		t.Errorf("Expected 'c' to be undeclared, got %q", result.Error)
+	}
+	if result := term.ExecuteCommand("let c: int = 3\nc + a"); result.Error != "" || result.Output != "4" {
+		t.Errorf("Expected c to be declared again, got %+v", result)
+	}
+}
+
+func TestMetaCommands(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.bl")
+	if err := os.WriteFile(script, []byte("let loaded: int = 7\nprintln(\"loading\")"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	term := NewTerminal()
+	term.ExecuteCommand("let x: int = 1")
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{":env", "x: int = 1\n"},
+		{":load " + script, "loading\n"},
+		{":load", "usage: :load <file>\n"},
+		{":load " + filepath.Join(t.TempDir(), "missing.bl"), "no such file or directory\n"},
+		{":help", replHelp},
+		{":nope", "unknown command :nope, type :help for help\n"},
+		{":reset", "Environment cleared.\n"},
+		{":env", ""},
+	}
+
+	for _, test := range tests {
+		var out strings.Builder
+		if quit := term.runMetaCommand(test.line, &out); quit {
+			t.Errorf("%s: unexpected quit", test.line)
+		}
+		if !strings.HasSuffix(out.String(), test.expected) {
+			t.Errorf("%s: expected output ending in %q, got %q", test.line, test.expected, out.String())
+		}
+
+		// What :load declares is kept
+		if strings.HasPrefix(test.line, ":load "+script) {
+			if result := term.ExecuteCommand("loaded + x"); result.Output != "8" {
+				t.Errorf("Expected the loaded variable to be declared, got %+v", result)
+			}
+		}
+	}
+
+	if result := term.ExecuteCommand("x"); result.Error == "" {
+		t.Errorf("Expected x to be forgotten after :reset")
+	}
+
+	for _, line := range []string{":quit", ":q"} {
+		var out strings.Builder
+		if quit := term.runMetaCommand(line, &out); !quit {
+			t.Errorf("%s: expected the REPL to quit", line)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Package trace lets the lexer, the parser and the interpreter report what
+// they are doing, for debugging Berlang itself. They stay silent unless they
+// are given a Tracer.
+package trace
+
+import (
+	"berlang/utils"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Stage names the part of Berlang an event comes from.
+type Stage string
+
+const (
+	Lexer  Stage = "lexer"
+	Parser Stage = "parser"
+	Eval   Stage = "eval"
+)
+
+// Stages lists every stage in the order they run.
+var Stages = []Stage{Lexer, Parser, Eval}
+
+// Tracer receives events about the source in span. Building an event is not
+// free, so callers ask Enabled first.
+type Tracer interface {
+	Enabled(stage Stage) bool
+	Event(stage Stage, msg string, span utils.Span, attrs ...slog.Attr)
+}
+
+// Discard is the default Tracer, it wants no events.
+var Discard Tracer = discard{}
+
+type discard struct{}
+
+func (discard) Enabled(Stage) bool                            { return false }
+func (discard) Event(Stage, string, utils.Span, ...slog.Attr) {}
+
+// Slog is a Tracer that logs the events of some stages to a slog.Logger, at
+// debug level.
+type Slog struct {
+	logger *slog.Logger
+	stages map[Stage]bool
+}
+
+func NewSlog(logger *slog.Logger, stages ...Stage) *Slog {
+	s := &Slog{logger: logger, stages: make(map[Stage]bool)}
+	for _, stage := range stages {
+		s.stages[stage] = true
+	}
+	return s
+}
+
+func (s *Slog) Enabled(stage Stage) bool {
+	return s.stages[stage]
+}
+
+// Event logs msg with the stage and span first, then attrs.
+func (s *Slog) Event(stage Stage, msg string, span utils.Span, attrs ...slog.Attr) {
+	if !s.stages[stage] {
+		return
+	}
+
+	all := make([]slog.Attr, 0, len(attrs)+2)
+	all = append(all, slog.String("stage", string(stage)), slog.String("span", formatSpan(span)))
+	all = append(all, attrs...)
+	s.logger.LogAttrs(context.Background(), slog.LevelDebug, msg, all...)
+}
+
+// formatSpan writes a span as line:column-line:column.
+func formatSpan(span utils.Span) string {
+	return fmt.Sprintf("%d:%d-%d:%d", span.Start.Line, span.Start.Column, span.End.Line, span.End.Column)
+}
+
+// ParseStages reads a comma separated list of stages, as the --trace flag
+// takes it.
+func ParseStages(list string) ([]Stage, error) {
+	var stages []Stage
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		stage := Stage(name)
+		found := false
+		for _, known := range Stages {
+			found = found || stage == known
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown stage %q, expected one of lexer, parser, eval", name)
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
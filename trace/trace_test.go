@@ -0,0 +1,54 @@
+package trace
+
+import (
+	"berlang/utils"
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseStages(t *testing.T) {
+	stages, err := ParseStages("lexer, eval,")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stages) != 2 || stages[0] != Lexer || stages[1] != Eval {
+		t.Errorf("Expected [lexer eval], got %v", stages)
+	}
+
+	if stages, err := ParseStages(""); err != nil || len(stages) != 0 {
+		t.Errorf("Expected no stages, got %v, %v", stages, err)
+	}
+
+	if _, err := ParseStages("lexer,types"); err == nil || !strings.Contains(err.Error(), `unknown stage "types"`) {
+		t.Errorf("Expected an unknown stage error, got %v", err)
+	}
+}
+
+func TestSlog(t *testing.T) {
+	var out bytes.Buffer
+	handler := slog.NewTextHandler(&out, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	tracer := NewSlog(slog.New(handler), Eval)
+
+	if tracer.Enabled(Lexer) || !tracer.Enabled(Eval) {
+		t.Fatalf("Expected only the eval stage to be enabled")
+	}
+
+	span := utils.Span{Start: utils.Position{Line: 1, Column: 2}, End: utils.Position{Line: 3, Column: 4}}
+	tracer.Event(Lexer, "token", span)
+	tracer.Event(Eval, "evaluated", span, slog.String("value", "3"))
+
+	expected := "level=DEBUG msg=evaluated stage=eval span=1:2-3:4 value=3\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
@@ -2,7 +2,6 @@ package utils
 
 import (
 	"errors"
-	"fmt"
 	"sync"
 )
 
@@ -30,20 +29,61 @@ const (
 	TOKEN_MINUS    TokenType = "MINUS"
 	TOKEN_MULT     TokenType = "MULTIPLY"
 	TOKEN_DIV      TokenType = "DIVIDE"
+	TOKEN_BANG     TokenType = "BANG"
+	TOKEN_LT       TokenType = "LT"
+	TOKEN_GT       TokenType = "GT"
+	TOKEN_LTE      TokenType = "LTE"
+	TOKEN_GTE      TokenType = "GTE"
+	TOKEN_EQ       TokenType = "EQ"
+	TOKEN_NOT_EQ   TokenType = "NOT_EQ"
+	TOKEN_AND      TokenType = "AND"
+	TOKEN_OR       TokenType = "OR"
+	TOKEN_IF       TokenType = "IF"
+	TOKEN_ELSE     TokenType = "ELSE"
+	TOKEN_WHILE    TokenType = "WHILE"
+	TOKEN_FOR      TokenType = "FOR"
+	TOKEN_IN       TokenType = "IN"
+	TOKEN_BREAK    TokenType = "BREAK"
+	TOKEN_CONTINUE TokenType = "CONTINUE"
+	TOKEN_RETURN   TokenType = "RETURN"
+	TOKEN_COMMA    TokenType = "COMMA"
+	TOKEN_STRING   TokenType = "STRING"
+	TOKEN_LBRACKET TokenType = "LBRACKET"
+	TOKEN_RBRACKET TokenType = "RBRACKET"
+	TOKEN_MOD      TokenType = "MODULO"
+	TOKEN_DOC      TokenType = "DOC_COMMENT"
+	TOKEN_DOT      TokenType = "DOT"
+	TOKEN_STRUCT   TokenType = "STRUCT"
+	TOKEN_ENUM     TokenType = "ENUM"
+	TOKEN_MATCH    TokenType = "MATCH"
+	TOKEN_ARROW    TokenType = "ARROW"
 )
 
 var Keywords = map[string]TokenType{
-	"let":    TOKEN_LET,
-	"const":  TOKEN_CONST,
-	"def":    TOKEN_FUNCTION,
-	"int":    TOKEN_TYPE,
-	"string": TOKEN_TYPE,
-	"bool":   TOKEN_TYPE,
-	"true":   TOKEN_TRUE,
-	"false":  TOKEN_FALSE,
+	"let":      TOKEN_LET,
+	"const":    TOKEN_CONST,
+	"def":      TOKEN_FUNCTION,
+	"int":      TOKEN_TYPE,
+	"float":    TOKEN_TYPE,
+	"string":   TOKEN_TYPE,
+	"bool":     TOKEN_TYPE,
+	"fn":       TOKEN_TYPE,
+	"true":     TOKEN_TRUE,
+	"false":    TOKEN_FALSE,
+	"if":       TOKEN_IF,
+	"else":     TOKEN_ELSE,
+	"while":    TOKEN_WHILE,
+	"for":      TOKEN_FOR,
+	"in":       TOKEN_IN,
+	"break":    TOKEN_BREAK,
+	"continue": TOKEN_CONTINUE,
+	"return":   TOKEN_RETURN,
+	"struct":   TOKEN_STRUCT,
+	"enum":     TOKEN_ENUM,
+	"match":    TOKEN_MATCH,
 }
 
-var SingleCharTokens = map[byte]TokenType{
+var SingleCharTokens = map[rune]TokenType{
 	':': TOKEN_COLON,
 	'=': TOKEN_ASSIGN,
 	';': TOKEN_SEMI,
@@ -55,6 +95,26 @@ var SingleCharTokens = map[byte]TokenType{
 	'-': TOKEN_MINUS,
 	'*': TOKEN_MULT,
 	'/': TOKEN_DIV,
+	'%': TOKEN_MOD,
+	'!': TOKEN_BANG,
+	'<': TOKEN_LT,
+	'>': TOKEN_GT,
+	',': TOKEN_COMMA,
+	'[': TOKEN_LBRACKET,
+	']': TOKEN_RBRACKET,
+	'.': TOKEN_DOT,
+}
+
+// DoubleCharTokens are checked before SingleCharTokens so that, for example,
+// >= is not lexed as > followed by =.
+var DoubleCharTokens = map[string]TokenType{
+	"<=": TOKEN_LTE,
+	">=": TOKEN_GTE,
+	"==": TOKEN_EQ,
+	"!=": TOKEN_NOT_EQ,
+	"&&": TOKEN_AND,
+	"||": TOKEN_OR,
+	"=>": TOKEN_ARROW,
 }
 
 func GetKeyByValue(m map[string]TokenType, value TokenType) (string, bool) {
@@ -71,11 +131,37 @@ type Token struct {
 	Literal string
 	Line    int
 	Column  int
+	// EndLine and EndColumn are the position of the last character of the
+	// token, so a single character token starts and ends at the same place
+	EndLine   int
+	EndColumn int
+}
+
+func (t Token) Span() Span {
+	return Span{
+		Start: Position{Line: t.Line, Column: t.Column},
+		End:   Position{Line: t.EndLine, Column: t.EndColumn},
+	}
+}
+
+// Position is a place in the source, lines and columns start at 1.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Span is the part of the source between two positions, both inclusive.
+type Span struct {
+	Start Position
+	End   Position
 }
 
 type TokenQueue struct {
 	lock   sync.Mutex
 	tokens []Token
+	// head is the index of the first token still in the queue, popping
+	// moves it forward instead of reslicing so the array is reused
+	head int
 }
 
 func NewTokenQueue() *TokenQueue {
@@ -93,30 +179,51 @@ func (ts *TokenQueue) Pop() (Token, error) {
 	ts.lock.Lock()
 	defer ts.lock.Unlock()
 
-	l := len(ts.tokens)
-	if l == 0 {
+	if ts.head == len(ts.tokens) {
 		return Token{}, errors.New("Tried popping on an empty queue")
 	}
 
-	res := ts.tokens[0]
-	ts.tokens = ts.tokens[1:l]
+	res := ts.tokens[ts.head]
+	ts.tokens[ts.head] = Token{}
+	ts.head++
+
+	// Move the remaining tokens to the front once most of the array is
+	// popped, so pushing afterwards does not keep growing it
+	if ts.head > len(ts.tokens)/2 {
+		n := copy(ts.tokens, ts.tokens[ts.head:])
+		clear(ts.tokens[n:])
+		ts.tokens = ts.tokens[:n]
+		ts.head = 0
+	}
 
 	return res, nil
 }
+
+// Next pops the next token, so a TokenQueue can feed the parser like a
+// lexer does. An empty queue gives an EOF token.
+func (ts *TokenQueue) Next() (Token, error) {
+	tok, err := ts.Pop()
+	if err != nil {
+		return Token{Type: TOKEN_EOF}, nil
+	}
+	return tok, nil
+}
+
 func (ts *TokenQueue) Peek() (Token, error) {
 	ts.lock.Lock()
 	defer ts.lock.Unlock()
 
-	if len(ts.tokens) == 0 {
+	if ts.head == len(ts.tokens) {
 		return Token{}, errors.New("Tried peeking on an empty queue")
 	}
 
-	return ts.tokens[0], nil
+	return ts.tokens[ts.head], nil
 }
+
 func (ts *TokenQueue) Len() int {
 	ts.lock.Lock()
 	defer ts.lock.Unlock()
-	return len(ts.tokens)
+	return len(ts.tokens) - ts.head
 }
 
 // WARN Use this for testing or debugging
@@ -124,11 +231,7 @@ func (ts *TokenQueue) Tokens() []Token {
 	ts.lock.Lock()
 	defer ts.lock.Unlock()
 
-	copiedTokens := make([]Token, len(ts.tokens))
-	copy(copiedTokens, ts.tokens)
+	copiedTokens := make([]Token, len(ts.tokens)-ts.head)
+	copy(copiedTokens, ts.tokens[ts.head:])
 	return copiedTokens
 }
-
-func NewParseError(expected string, found string, line, col float64) error {
-	return fmt.Errorf("Expected %v, found: %v at line: %f, col: %f", expected, found, line, col)
-}